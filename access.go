@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// AccessMode controls who may browse and download from the library.
+type AccessMode string
+
+const (
+	// AccessPublic allows anonymous browsing and downloading.
+	AccessPublic AccessMode = "public"
+
+	// AccessLogin allows anonymous browsing but requires authentication to download.
+	AccessLogin AccessMode = "login"
+
+	// AccessPrivate requires authentication for every API call.
+	AccessPrivate AccessMode = "private"
+)
+
+// parseAccessMode validates an ACCESS_MODE value. An empty value selects AccessPublic.
+func parseAccessMode(v string) (AccessMode, error) {
+	switch mode := AccessMode(v); mode {
+	case "":
+		return AccessPublic, nil
+	case AccessPublic, AccessLogin, AccessPrivate:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid access mode %q: must be public, login or private", v)
+	}
+}
+
+// isAuthenticated reports whether the request carries valid credentials:
+// a signed-in session, an API token or the admin token.
+func (s *Server) isAuthenticated(r *http.Request) bool {
+	return userFromContext(r.Context()) != nil || s.isAdmin(r)
+}
+
+// requireBrowseAccess is middleware rejecting unauthenticated requests in private mode.
+func (s *Server) requireBrowseAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.AccessMode == AccessPrivate && !s.hasScope(r, ScopeRead) {
+			writeError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// canDownload reports whether the request may download files: anyone in public
+// mode, otherwise only authenticated callers with the download scope.
+func (s *Server) canDownload(r *http.Request) bool {
+	return s.cfg.AccessMode == AccessPublic || s.hasScope(r, ScopeDownload)
+}
+
+// requireDownloadAccess is middleware rejecting unauthenticated downloads
+// unless the library is fully public.
+func (s *Server) requireDownloadAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.canDownload(r) {
+			writeError(w, http.StatusUnauthorized, "authentication required to download")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleAccessInfo handles GET /api/access - reports the access mode so the
+// frontend can decide whether to prompt for login.
+func (s *Server) handleAccessInfo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"mode":          s.cfg.AccessMode,
+		"authenticated": s.isAuthenticated(r),
+	})
+}
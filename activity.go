@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// activeDownloadsKey is the Redis sorted set of streams in progress, scored by start time.
+	activeDownloadsKey = "gdrive:activity:downloads"
+
+	// activeReadersKey is the Redis sorted set of readers, scored by their last progress ping.
+	activeReadersKey = "gdrive:activity:readers"
+
+	// readerPresenceWindow is how long a reader counts as active after their last ping.
+	readerPresenceWindow = 5 * time.Minute
+
+	// maxDownloadAge bounds how long a stream is listed, so streams of a crashed
+	// server eventually disappear.
+	maxDownloadAge = 6 * time.Hour
+)
+
+// Activity is a download in progress or a file being read.
+type Activity struct {
+	Reader   string    `json:"reader,omitempty"` // Only shown to admins
+	FileID   string    `json:"file_id"`
+	FileName string    `json:"file_name"`
+	Since    time.Time `json:"since,omitzero"` // Set from the score, not stored in the member
+
+	// Key distinguishes readers without exposing their address; it makes the
+	// members of different readers and streams unique.
+	Key string `json:"key"`
+}
+
+// readerIdentity returns a display name for the requester and a key that is stable
+// per user (or per address for guests). Email addresses are never used as names.
+func readerIdentity(r *http.Request) (name, key string) {
+	if user := userFromContext(r.Context()); user != nil {
+		name = user.Name
+		if name == "" {
+			name = "user"
+		}
+		return name, "user:" + strconv.FormatInt(user.ID, 10)
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	sum := sha256.Sum256([]byte(host))
+	return "guest", "guest:" + hex.EncodeToString(sum[:6])
+}
+
+// trackDownload lists a stream as in progress until the returned function is called.
+func (s *Server) trackDownload(ctx context.Context, r *http.Request, downloadID int64, fileID, fileName string) func() {
+	name, key := readerIdentity(r)
+	data, _ := json.Marshal(Activity{
+		Reader:   name,
+		FileID:   fileID,
+		FileName: fileName,
+		Key:      key + ":" + strconv.FormatInt(downloadID, 10),
+	})
+
+	member := redis.Z{Score: float64(time.Now().Unix()), Member: string(data)}
+	if err := s.redis.ZAdd(ctx, activeDownloadsKey, member).Err(); err != nil {
+		logf(ctx, "Warning: Failed to track download: %v", err)
+		return func() {}
+	}
+
+	return func() {
+		// The request context may already be canceled
+		if err := s.redis.ZRem(context.WithoutCancel(ctx), activeDownloadsKey, string(data)).Err(); err != nil {
+			logf(ctx, "Warning: Failed to untrack download: %v", err)
+		}
+	}
+}
+
+// handleProgressPing handles POST /api/files/:id/progress - marks the requester as
+// currently reading the file. Readers should ping every few minutes while a file is open.
+func (s *Server) handleProgressPing(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	file, err := s.findFile(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if file == nil {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	name, key := readerIdentity(r)
+	data, _ := json.Marshal(Activity{Reader: name, FileID: file.ID, FileName: file.Name, Key: key})
+	member := redis.Z{Score: float64(time.Now().Unix()), Member: string(data)}
+	if err := s.redis.ZAdd(ctx, activeReadersKey, member).Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// activeSince returns the members of a presence set scored after cutoff, newest
+// first, and removes the older ones.
+func (s *Server) activeSince(ctx context.Context, key string, cutoff time.Time) ([]Activity, error) {
+	cutoffScore := strconv.FormatInt(cutoff.Unix(), 10)
+	if err := s.redis.ZRemRangeByScore(ctx, key, "-inf", "("+cutoffScore).Err(); err != nil {
+		return nil, err
+	}
+
+	members, err := s.redis.ZRevRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: cutoffScore, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	activities := make([]Activity, 0, len(members))
+	for _, m := range members {
+		var a Activity
+		if err := json.Unmarshal([]byte(m.Member.(string)), &a); err != nil {
+			continue
+		}
+		a.Since = time.Unix(int64(m.Score), 0)
+		activities = append(activities, a)
+	}
+	return activities, nil
+}
+
+// handleGetActivity handles GET /api/activity - returns the downloads in progress and
+// the readers active in the last few minutes, for a live usage widget. Readers are
+// named for admins only; everyone else sees their opaque keys.
+func (s *Server) handleGetActivity(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	now := time.Now()
+
+	downloads, err := s.activeSince(ctx, activeDownloadsKey, now.Add(-maxDownloadAge))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	readers, err := s.activeSince(ctx, activeReadersKey, now.Add(-readerPresenceWindow))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !s.isAdmin(r) {
+		for _, list := range [][]Activity{downloads, readers} {
+			for i := range list {
+				list[i].Reader = ""
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"downloads":      downloads,
+		"readers":        readers,
+		"download_count": len(downloads),
+		"reader_count":   len(readers),
+	})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AuditEntry represents a single administrative action recorded in the audit log.
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	Action     string    `json:"action"`
+	FileID     string    `json:"file_id"`
+	Detail     string    `json:"detail"`
+	RemoteAddr string    `json:"remote_addr"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// DownloadEntry is a recorded download.
+type DownloadEntry struct {
+	ID           int64     `json:"id"`
+	FileID       string    `json:"file_id"`
+	FileName     string    `json:"file_name"`
+	UserID       *int64    `json:"user_id"`
+	Bytes        int64     `json:"bytes"`
+	BytesSent    *int64    `json:"bytes_sent"`
+	Status       string    `json:"status"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+}
+
+// requireAdmin is middleware that restricts access to requests carrying the
+// configured admin token as "Authorization: Bearer <token>".
+// All admin routes are rejected when no ADMIN_TOKEN is configured.
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.AdminToken == "" {
+			writeError(w, http.StatusForbidden, "admin access is disabled")
+			return
+		}
+
+		if !s.isAdmin(r) {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isAdmin reports whether the request carries the configured admin token.
+func (s *Server) isAdmin(r *http.Request) bool {
+	if s.cfg.AdminToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminToken)) == 1
+}
+
+// audit records an administrative action in the audit log.
+// Failures are logged and never interrupt the request.
+func (s *Server) audit(r *http.Request, action, fileID, detail string) {
+	_, err := s.execWrite(context.WithoutCancel(r.Context()),
+		"INSERT INTO audit_log (action, file_id, detail, remote_addr) VALUES (?, ?, ?, ?)",
+		action, fileID, detail, r.RemoteAddr,
+	)
+	if err != nil {
+		logf(r.Context(), "Failed to record audit entry %q for %s: %v", action, fileID, err)
+	}
+}
+
+// handleListAudit handles GET /api/admin/audit?cursor=&limit= - returns a page of audit log entries, newest first.
+func (s *Server) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	q, ok := decodePage(w, r)
+	if !ok {
+		return
+	}
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM audit_log").Scan(&total); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	where, args := q.keyset("created_at")
+	rows, err := s.db.Query(`
+		SELECT id, action, COALESCE(file_id, ''), COALESCE(detail, ''), COALESCE(remote_addr, ''), created_at
+		FROM audit_log
+		`+where+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, append(args, q.Limit+1)...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	entries := make([]AuditEntry, 0)
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.Action, &e.FileID, &e.Detail, &e.RemoteAddr, &e.CreatedAt); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	if rows.Err() != nil {
+		writeError(w, http.StatusInternalServerError, rows.Err().Error())
+		return
+	}
+
+	entries, next := paginate(entries, q, func(e AuditEntry) (time.Time, int64) { return e.CreatedAt, e.ID })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"entries":     entries,
+		"count":       len(entries),
+		"total":       total,
+		"next_cursor": next,
+	})
+}
+
+// handleListDownloads handles GET /api/admin/downloads?cursor=&limit= - returns a page of
+// the download history, newest first.
+func (s *Server) handleListDownloads(w http.ResponseWriter, r *http.Request) {
+	q, ok := decodePage(w, r)
+	if !ok {
+		return
+	}
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM downloads").Scan(&total); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	where, args := q.keyset("downloaded_at")
+	rows, err := s.db.Query(`
+		SELECT id, file_id, file_name, user_id, bytes, bytes_sent, status, downloaded_at
+		FROM downloads
+		`+where+`
+		ORDER BY downloaded_at DESC, id DESC
+		LIMIT ?
+	`, append(args, q.Limit+1)...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	downloads := make([]DownloadEntry, 0)
+	for rows.Next() {
+		var d DownloadEntry
+		if err := rows.Scan(&d.ID, &d.FileID, &d.FileName, &d.UserID, &d.Bytes, &d.BytesSent, &d.Status, &d.DownloadedAt); err != nil {
+			continue
+		}
+		downloads = append(downloads, d)
+	}
+
+	if rows.Err() != nil {
+		writeError(w, http.StatusInternalServerError, rows.Err().Error())
+		return
+	}
+
+	downloads, next := paginate(downloads, q, func(d DownloadEntry) (time.Time, int64) { return d.DownloadedAt, d.ID })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"downloads":   downloads,
+		"count":       len(downloads),
+		"total":       total,
+		"next_cursor": next,
+	})
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// hexColorPattern matches "#RRGGBB" colors for the hexcolor validation rule.
+var hexColorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// APIError is the error object of every error response, sent as {"error": {...}}.
+type APIError struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+// FieldError describes why a single request field failed validation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// errorCode derives a machine-readable error code from an HTTP status,
+// e.g. 404 becomes "not_found".
+func errorCode(status int) string {
+	if status == http.StatusUnprocessableEntity {
+		return "validation_failed"
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// writeAPIError writes apiErr wrapped in the error envelope.
+func writeAPIError(w http.ResponseWriter, status int, apiErr APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]APIError{"error": apiErr})
+}
+
+// writeError writes an error response with the code derived from status.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, APIError{Code: errorCode(status), Message: message})
+}
+
+// writeValidationError writes a 422 response listing the invalid fields.
+func writeValidationError(w http.ResponseWriter, details ...FieldError) {
+	writeAPIError(w, http.StatusUnprocessableEntity, APIError{
+		Code:    errorCode(http.StatusUnprocessableEntity),
+		Message: "request validation failed",
+		Details: details,
+	})
+}
+
+// decodeJSON decodes the request body into the struct pointed to by dst and
+// validates it. On failure the error response is written and false is returned.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return false
+	}
+
+	if details := validateStruct(dst, "json"); len(details) > 0 {
+		writeValidationError(w, details...)
+		return false
+	}
+	return true
+}
+
+// decodeQuery fills the struct pointed to by dst from the query parameters named
+// by its `query` tags, then validates it. Fields whose parameter is absent keep
+// their current value, so defaults can be set before decoding.
+// On failure the error response is written and false is returned.
+func decodeQuery(w http.ResponseWriter, r *http.Request, dst any) bool {
+	query := r.URL.Query()
+	v := reflect.ValueOf(dst).Elem()
+	t := v.Type()
+
+	var details []FieldError
+	for i := range t.NumField() {
+		name := t.Field(i).Tag.Get("query")
+		if name == "" || !query.Has(name) {
+			continue
+		}
+
+		raw, field := query.Get(name), v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(raw)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				details = append(details, FieldError{Field: name, Message: "must be true or false"})
+				continue
+			}
+			field.SetBool(b)
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				details = append(details, FieldError{Field: name, Message: "must be an integer"})
+				continue
+			}
+			field.SetInt(n)
+		}
+	}
+
+	if len(details) == 0 {
+		details = validateStruct(dst, "query")
+	}
+
+	if len(details) > 0 {
+		writeValidationError(w, details...)
+		return false
+	}
+	return true
+}
+
+// validateStruct checks the fields of the struct pointed to by v against their
+// `validate` tags and returns one error per invalid field. Fields are reported
+// under the name given by nameTag (json or query). Supported rules:
+//
+//	required       the field must not be the zero value
+//	omitempty      skip the remaining rules when the field is the zero value
+//	email          the string must be an email address
+//	hexcolor       the string must be a "#RRGGBB" color
+//	min=N, max=N   bounds on string length, slice length or integer value
+//	oneof=a b c    the string must be one of the listed values
+func validateStruct(v any, nameTag string) []FieldError {
+	rv := reflect.ValueOf(v).Elem()
+	rt := rv.Type()
+
+	var details []FieldError
+	for i := range rt.NumField() {
+		sf := rt.Field(i)
+		rules := sf.Tag.Get("validate")
+		if rules == "" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(sf.Tag.Get(nameTag), ",")
+		if name == "" {
+			name = sf.Name
+		}
+
+		if msg := validateField(rv.Field(i), rules); msg != "" {
+			details = append(details, FieldError{Field: name, Message: msg})
+		}
+	}
+	return details
+}
+
+// validateField applies a comma-separated rule list to a field and returns
+// the message of the first failing rule, or "" if the field is valid.
+func validateField(field reflect.Value, rules string) string {
+	for _, rule := range strings.Split(rules, ",") {
+		key, arg, _ := strings.Cut(rule, "=")
+		switch key {
+		case "required":
+			if field.IsZero() {
+				return "is required"
+			}
+		case "omitempty":
+			if field.IsZero() {
+				return ""
+			}
+		case "email":
+			if addr, err := mail.ParseAddress(field.String()); err != nil || addr.Name != "" {
+				return "must be a valid email address"
+			}
+		case "hexcolor":
+			if !hexColorPattern.MatchString(field.String()) {
+				return "must be a color of the form #RRGGBB"
+			}
+		case "min", "max":
+			bound, _ := strconv.ParseInt(arg, 10, 64)
+			var n int64
+			unit := ""
+			switch field.Kind() {
+			case reflect.String:
+				n, unit = int64(len([]rune(field.String()))), " characters"
+			case reflect.Slice:
+				n, unit = int64(field.Len()), " items"
+			case reflect.Int, reflect.Int64:
+				n = field.Int()
+			}
+			if key == "min" && n < bound {
+				return fmt.Sprintf("must be at least %d%s", bound, unit)
+			}
+			if key == "max" && n > bound {
+				return fmt.Sprintf("must be at most %d%s", bound, unit)
+			}
+		case "oneof":
+			options := strings.Fields(arg)
+			if !slices.Contains(options, field.String()) {
+				return "must be one of: " + strings.Join(options, ", ")
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// GoogleIssuer is the OpenID Connect issuer of Google Sign-In.
+	GoogleIssuer = "https://accounts.google.com"
+
+	// oauthStateTTL bounds how long a login redirect may take to complete.
+	oauthStateTTL = 10 * time.Minute
+
+	// oauthStateKeyPrefix prefixes the Redis keys holding pending login states.
+	oauthStateKeyPrefix = "gdrive:oauth:state:"
+
+	// jwksRefreshInterval is the minimum time between fetches of an issuer's signing
+	// keys, so tokens with unknown key IDs cannot force a fetch per request.
+	jwksRefreshInterval = time.Minute
+)
+
+// Identity is a user identity asserted by an auth provider.
+type Identity struct {
+	Subject string // Stable user identifier within the provider
+	Email   string
+	Name    string
+}
+
+// AuthProvider is a source of user identities.
+// Implementations are either a PasswordProvider or a RedirectProvider.
+type AuthProvider interface {
+	Name() string
+}
+
+// PasswordProvider authenticates users with a username and password,
+// such as local accounts or a directory server like LDAP.
+type PasswordProvider interface {
+	AuthProvider
+	Authenticate(ctx context.Context, username, password string) (*Identity, error)
+}
+
+// RedirectProvider authenticates users by redirecting them to an external
+// login page, such as an OpenID Connect identity provider.
+type RedirectProvider interface {
+	AuthProvider
+	AuthCodeURL(ctx context.Context, state string) (string, error)
+	Exchange(ctx context.Context, code string) (*Identity, error)
+}
+
+// AssertionProvider authenticates users by a signed identity assertion obtained
+// by the client itself, such as an OIDC ID token from a native sign-in SDK.
+type AssertionProvider interface {
+	AuthProvider
+	VerifyAssertion(ctx context.Context, assertion string) (*Identity, error)
+}
+
+// OIDCConfig configures an OpenID Connect identity provider.
+type OIDCConfig struct {
+	Name         string // Provider name used in login URLs
+	Issuer       string // Issuer URL serving /.well-known/openid-configuration
+	ClientID     string
+	ClientSecret string
+}
+
+// LoginRequest represents a password login request.
+type LoginRequest struct {
+	Provider string `json:"provider"` // Defaults to the local provider
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// oidcProvider implements RedirectProvider using the OpenID Connect authorization
+// code flow. Endpoints are discovered from the issuer on first use.
+type oidcProvider struct {
+	cfg         OIDCConfig
+	redirectURL string
+
+	mu          sync.Mutex
+	oauth       *oauth2.Config // nil until discovery succeeds
+	issuer      string
+	userinfoURL string
+	jwksURL     string
+	keys        map[string]*rsa.PublicKey // ID token signing keys by key ID
+	keysFetched time.Time                 // Last fetch of the signing keys
+}
+
+// newOIDCProvider creates a provider whose callback is served below publicURL.
+func newOIDCProvider(cfg OIDCConfig, publicURL string) *oidcProvider {
+	return &oidcProvider{
+		cfg:         cfg,
+		redirectURL: strings.TrimRight(publicURL, "/") + "/api/auth/" + cfg.Name + "/callback",
+	}
+}
+
+// Name returns the provider name.
+func (p *oidcProvider) Name() string { return p.cfg.Name }
+
+// discover fetches the issuer's discovery document and builds the OAuth2 configuration.
+// The document must name the configured issuer.
+func (p *oidcProvider) discover(ctx context.Context) (*oauth2.Config, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth != nil {
+		return p.oauth, p.userinfoURL, nil
+	}
+
+	url := strings.TrimRight(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to fetch discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unable to fetch discovery document: %s", resp.Status)
+	}
+
+	var doc struct {
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserinfoEndpoint      string `json:"userinfo_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+		Issuer                string `json:"issuer"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, "", fmt.Errorf("invalid discovery document: %w", err)
+	}
+
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.UserinfoEndpoint == "" {
+		return nil, "", errors.New("discovery document is missing required endpoints")
+	}
+	if doc.Issuer == "" || strings.TrimRight(doc.Issuer, "/") != strings.TrimRight(p.cfg.Issuer, "/") {
+		return nil, "", fmt.Errorf("discovery document issuer %q does not match %q", doc.Issuer, p.cfg.Issuer)
+	}
+
+	p.oauth = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.redirectURL,
+		Scopes:       []string{"openid", "email", "profile"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  doc.AuthorizationEndpoint,
+			TokenURL: doc.TokenEndpoint,
+		},
+	}
+	p.issuer = doc.Issuer
+	p.userinfoURL = doc.UserinfoEndpoint
+	p.jwksURL = doc.JWKSURI
+	return p.oauth, p.userinfoURL, nil
+}
+
+// AuthCodeURL returns the URL of the provider's login page.
+func (p *oidcProvider) AuthCodeURL(ctx context.Context, state string) (string, error) {
+	conf, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return conf.AuthCodeURL(state), nil
+}
+
+// Exchange redeems an authorization code and fetches the user's identity
+// from the userinfo endpoint.
+func (p *oidcProvider) Exchange(ctx context.Context, code string) (*Identity, error) {
+	conf, userinfoURL, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := conf.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("unable to exchange code: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, userinfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := conf.Client(ctx, token).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch user info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch user info: %s", resp.Status)
+	}
+
+	var info struct {
+		Subject       string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified *bool  `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("invalid user info: %w", err)
+	}
+
+	if info.Subject == "" || info.Email == "" {
+		return nil, errors.New("user info is missing subject or email")
+	}
+
+	if info.EmailVerified != nil && !*info.EmailVerified {
+		return nil, errors.New("email address is not verified")
+	}
+
+	if info.Name == "" {
+		info.Name = info.Email
+	}
+	return &Identity{Subject: info.Subject, Email: info.Email, Name: info.Name}, nil
+}
+
+// signingKey returns the issuer's RSA key with the given key ID, refetching the
+// key set when the ID is unknown so rotated keys are picked up. The key set is
+// fetched at most once per jwksRefreshInterval.
+func (p *oidcProvider) signingKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	if _, _, err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	if p.jwksURL == "" {
+		return nil, errors.New("issuer does not publish signing keys")
+	}
+	if time.Since(p.keysFetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	p.keysFetched = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch signing keys: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch signing keys: %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("invalid signing keys: %w", err)
+	}
+
+	p.keys = make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		p.keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// VerifyAssertion verifies an RS256 ID token issued to this client and returns
+// the identity it asserts.
+func (p *oidcProvider) VerifyAssertion(ctx context.Context, assertion string) (*Identity, error) {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("malformed ID token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil || header.Alg != "RS256" {
+		return nil, errors.New("unsupported ID token algorithm")
+	}
+
+	key, err := p.signingKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed ID token")
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, errors.New("invalid ID token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed ID token")
+	}
+
+	var claims struct {
+		Issuer        string          `json:"iss"`
+		Audience      json.RawMessage `json:"aud"` // String or array
+		Subject       string          `json:"sub"`
+		Expiry        int64           `json:"exp"`
+		Email         string          `json:"email"`
+		EmailVerified *bool           `json:"email_verified"`
+		Name          string          `json:"name"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.New("malformed ID token")
+	}
+
+	// Google issues tokens with and without the scheme in iss
+	if claims.Issuer == "" {
+		return nil, errors.New("ID token has no issuer")
+	}
+	if claims.Issuer != p.issuer && "https://"+claims.Issuer != p.issuer {
+		return nil, errors.New("ID token issuer mismatch")
+	}
+
+	var audiences []string
+	if json.Unmarshal(claims.Audience, &audiences) != nil {
+		var aud string
+		json.Unmarshal(claims.Audience, &aud)
+		audiences = []string{aud}
+	}
+	if !slices.Contains(audiences, p.cfg.ClientID) {
+		return nil, errors.New("ID token was not issued to this client")
+	}
+
+	if time.Now().Unix() >= claims.Expiry {
+		return nil, errors.New("ID token has expired")
+	}
+
+	if claims.Subject == "" || claims.Email == "" {
+		return nil, errors.New("ID token is missing subject or email")
+	}
+
+	if claims.EmailVerified != nil && !*claims.EmailVerified {
+		return nil, errors.New("email address is not verified")
+	}
+
+	if claims.Name == "" {
+		claims.Name = claims.Email
+	}
+	return &Identity{Subject: claims.Subject, Email: claims.Email, Name: claims.Name}, nil
+}
+
+// newAuthProviders builds the configured auth providers keyed by name.
+// Local password accounts are always available.
+func newAuthProviders(s *Server) map[string]AuthProvider {
+	providers := map[string]AuthProvider{
+		localProviderName: &localProvider{db: s.db},
+	}
+
+	for _, c := range s.cfg.OIDCProviders {
+		if _, exists := providers[c.Name]; exists {
+			log.Printf("Warning: duplicate auth provider %q ignored", c.Name)
+			continue
+		}
+		providers[c.Name] = newOIDCProvider(c, s.cfg.PublicURL)
+	}
+	return providers
+}
+
+// handleListAuthProviders handles GET /api/auth/providers - lists the available
+// login methods so the frontend can render them.
+func (s *Server) handleListAuthProviders(w http.ResponseWriter, r *http.Request) {
+	type ProviderInfo struct {
+		Name string `json:"name"`
+		Type string `json:"type"` // "password" or "redirect"
+	}
+
+	providers := make([]ProviderInfo, 0, len(s.authProviders))
+	for name, p := range s.authProviders {
+		info := ProviderInfo{Name: name, Type: "password"}
+		if _, ok := p.(RedirectProvider); ok {
+			info.Type = "redirect"
+		}
+		providers = append(providers, info)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"providers": providers,
+	})
+}
+
+// handleLogin handles POST /api/auth/login - signs in with a password provider.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.Provider == "" {
+		req.Provider = localProviderName
+	}
+
+	provider, ok := s.authProviders[req.Provider].(PasswordProvider)
+	if !ok {
+		writeValidationError(w, FieldError{Field: "provider", Message: "must be a password provider"})
+		return
+	}
+
+	ctx := r.Context()
+	identity, err := provider.Authenticate(ctx, req.Email, req.Password)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	user, err := s.resolveUser(ctx, provider.Name(), identity)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := s.startSession(w, r, user); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// handleOAuthLogin handles GET /api/auth/:provider/login - redirects to the
+// identity provider's login page.
+func (s *Server) handleOAuthLogin(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provider")
+	provider, ok := s.authProviders[name].(RedirectProvider)
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown identity provider")
+		return
+	}
+
+	ctx := r.Context()
+	state := randomToken()
+	if err := s.redis.Set(ctx, oauthStateKeyPrefix+state, name, oauthStateTTL).Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	url, err := provider.AuthCodeURL(ctx, state)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// handleOAuthCallback handles GET /api/auth/:provider/callback - completes a login
+// redirect, starts a session and returns to the frontend.
+func (s *Server) handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provider")
+	provider, ok := s.authProviders[name].(RedirectProvider)
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown identity provider")
+		return
+	}
+
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		writeError(w, http.StatusUnauthorized, "login failed: "+e)
+		return
+	}
+
+	// States are single use and bound to the provider that issued the redirect
+	ctx := r.Context()
+	issuedBy, err := s.redis.GetDel(ctx, oauthStateKeyPrefix+query.Get("state")).Result()
+	if err != nil || issuedBy != name {
+		writeError(w, http.StatusBadRequest, "invalid or expired login state")
+		return
+	}
+
+	identity, err := provider.Exchange(ctx, query.Get("code"))
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	user, err := s.resolveUser(ctx, name, identity)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := s.startSession(w, r, user); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// handleLogout handles POST /api/auth/logout - ends the current session.
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if err := s.endSession(w, r); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "signed out"})
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abiiranathan/gdrive"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+const (
+	// benchFiles is the size of the synthetic library used by the benchmarks.
+	benchFiles = 10000
+
+	// benchPageSize is the number of files the fake Drive returns per listing page.
+	benchPageSize = 1000
+
+	// benchContentBytes is the size of the file streamed from the fake Drive.
+	benchContentBytes = 16 << 20
+)
+
+// benchLibrary returns a synthetic library of n files spread over nested folders.
+func benchLibrary(n int) []gdrive.FileInfo {
+	files := make([]gdrive.FileInfo, n)
+	for i := range files {
+		files[i] = gdrive.FileInfo{
+			ID:          fmt.Sprintf("file%06d", i),
+			Name:        fmt.Sprintf("Book %d - Volume %d.pdf", i/10, i%10),
+			MimeType:    "application/pdf",
+			Size:        int64(1<<20 + i),
+			WebViewLink: fmt.Sprintf("https://drive.google.com/file/d/file%06d/view", i),
+			FolderPath:  fmt.Sprintf("My Drive/Shelf %d/Section %d", i%20, i%7),
+		}
+	}
+	return files
+}
+
+// newFakeDrive starts an in-process stand-in for the Drive API serving paged
+// listings of benchFiles files and the content of any file, with range support, and
+// returns a server whose Drive service talks to it.
+func newFakeDrive(b *testing.B) *Server {
+	content := bytes.Repeat([]byte("0123456789abcdef"), benchContentBytes/16)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /drive/v3/files", func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+		list := drive.FileList{}
+		for i := start; i < min(start+benchPageSize, benchFiles); i++ {
+			list.Files = append(list.Files, &drive.File{
+				Id:          fmt.Sprintf("file%06d", i),
+				Md5Checksum: fmt.Sprintf("%032x", i),
+			})
+		}
+		if start+benchPageSize < benchFiles {
+			list.NextPageToken = strconv.Itoa(start + benchPageSize)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	})
+	mux.HandleFunc("GET /drive/v3/files/{id}", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	})
+
+	ts := httptest.NewServer(mux)
+	b.Cleanup(ts.Close)
+
+	svc, err := drive.NewService(context.Background(),
+		option.WithHTTPClient(ts.Client()),
+		option.WithEndpoint(ts.URL+"/drive/v3/"),
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return &Server{driveService: svc}
+}
+
+// BenchmarkListChecksums measures paged listing throughput against the fake Drive.
+func BenchmarkListChecksums(b *testing.B) {
+	s := newFakeDrive(b)
+	ctx := context.Background()
+	for b.Loop() {
+		checksums, err := s.listChecksums(ctx)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(checksums) != benchFiles {
+			b.Fatalf("listed %d files, want %d", len(checksums), benchFiles)
+		}
+	}
+	b.ReportMetric(float64(benchFiles*b.N)/b.Elapsed().Seconds(), "files/s")
+}
+
+// BenchmarkStreamCopy measures copying a file from the fake Drive through the ranged
+// reader serving media playback, with various copy buffer sizes.
+func BenchmarkStreamCopy(b *testing.B) {
+	s := newFakeDrive(b)
+	for _, size := range []int{32 << 10, 256 << 10, 1 << 20, 4 << 20} {
+		b.Run(fmt.Sprintf("buffer=%dKiB", size>>10), func(b *testing.B) {
+			buf := make([]byte, size)
+			b.SetBytes(benchContentBytes)
+			for b.Loop() {
+				f := &driveFile{ctx: context.Background(), s: s, fileID: "file000001", size: benchContentBytes}
+				cw := &countingWriter{w: io.Discard}
+				if _, err := io.CopyBuffer(cw, f, buf); err != nil {
+					b.Fatal(err)
+				}
+				f.Close()
+				if cw.n != benchContentBytes {
+					b.Fatalf("copied %d bytes, want %d", cw.n, benchContentBytes)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkSiteBundle measures building the static catalog archive, without covers.
+func BenchmarkSiteBundle(b *testing.B) {
+	files := benchLibrary(benchFiles)
+	for b.Loop() {
+		site := &SiteCatalog{GeneratedAt: time.Now(), Count: len(files)}
+		for _, f := range files {
+			site.Files = append(site.Files, SiteEntry{
+				ID:          f.ID,
+				Name:        f.Name,
+				MimeType:    f.MimeType,
+				Size:        f.Size,
+				Folder:      f.FolderPath,
+				Tags:        []string{},
+				Collections: []string{},
+			})
+		}
+		if _, err := writeSiteBundle(context.Background(), io.Discard, site, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCacheCodec measures encoding and decoding the cached file listing.
+func BenchmarkCacheCodec(b *testing.B) {
+	files := benchLibrary(benchFiles)
+	data, err := marshalCache(files)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("marshal", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := marshalCache(files); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("unmarshal", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for b.Loop() {
+			var decoded []gdrive.FileInfo
+			if err := unmarshalCache(data, &decoded); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkApplyOverlay measures applying the visibility overlay to a listing.
+func BenchmarkApplyOverlay(b *testing.B) {
+	files := benchLibrary(benchFiles)
+	overlay := fileOverlay{hidden: map[string]bool{}, featured: map[string]bool{}, pinned: map[string]bool{}}
+	for i := 0; i < benchFiles; i += 50 {
+		overlay.hidden[files[i].ID] = true
+		overlay.pinned[files[i+1].ID] = true
+	}
+
+	id := func(f gdrive.FileInfo) string { return f.ID }
+	for b.Loop() {
+		applyOverlay(files, overlay, id)
+	}
+}
+
+// BenchmarkNegotiateExport measures picking an export format from a browser-like
+// and an API client Accept header.
+func BenchmarkNegotiateExport(b *testing.B) {
+	types, err := parseWorkspaceTypes("docs")
+	if err != nil {
+		b.Fatal(err)
+	}
+	var docs WorkspaceType
+	for _, t := range types {
+		docs = t
+	}
+
+	for _, accept := range []string{
+		"text/plain;q=0.5, application/vnd.openxmlformats-officedocument.wordprocessingml.document;q=0.9, */*;q=0.1",
+		"application/epub+zip, application/pdf;q=0.8",
+	} {
+		b.Run(strings.SplitN(accept, ",", 2)[0], func(b *testing.B) {
+			for b.Loop() {
+				negotiateExport(accept, docs)
+			}
+		})
+	}
+}
+
+// BenchmarkSuggest measures building the suggestion index and looking up prefixes.
+func BenchmarkSuggest(b *testing.B) {
+	files := benchLibrary(benchFiles)
+
+	b.Run("build", func(b *testing.B) {
+		for b.Loop() {
+			var idx suggestIndex
+			idx.build(files, 1)
+		}
+	})
+	b.Run("lookup", func(b *testing.B) {
+		var idx suggestIndex
+		idx.build(files, 1)
+		for b.Loop() {
+			idx.lookup("book 12", 10, func(string) bool { return false })
+		}
+	})
+}
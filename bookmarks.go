@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxImportBytes bounds the size of uploaded bookmark and catalog files.
+const maxImportBytes = 10 << 20
+
+// csvBookmarkHeader is the header row of CSV bookmark exports.
+var csvBookmarkHeader = []string{"file_id", "file_name", "notes", "created_at", "share_url"}
+
+// BookmarkExport is a bookmark in a portable export.
+type BookmarkExport struct {
+	FileID    string    `json:"file_id"`
+	FileName  string    `json:"file_name"`
+	Notes     string    `json:"notes"`
+	CreatedAt time.Time `json:"created_at"`
+	ShareURL  string    `json:"share_url,omitempty"`
+}
+
+// BookmarkFormatQuery holds the format parameter of the bookmark export and import endpoints.
+type BookmarkFormatQuery struct {
+	Format string `query:"format" validate:"oneof=json csv opml"`
+}
+
+// opmlDocument is the OPML 2.0 representation of exported bookmarks.
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title"`
+		DateCreated string `xml:"dateCreated"`
+	} `xml:"head"`
+	Outlines []opmlOutline `xml:"body>outline"`
+}
+
+// opmlOutline is a single bookmark in an OPML document.
+type opmlOutline struct {
+	Text    string `xml:"text,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	URL     string `xml:"url,attr,omitempty"`
+	Note    string `xml:"_note,attr,omitempty"`
+	Created string `xml:"created,attr,omitempty"`
+	FileID  string `xml:"fileId,attr,omitempty"`
+}
+
+// handleExportBookmarks handles GET /api/bookmarks/export?format=json|csv|opml - downloads
+// all bookmarks with their notes, and signed share links for callers allowed to download.
+func (s *Server) handleExportBookmarks(w http.ResponseWriter, r *http.Request) {
+	q := BookmarkFormatQuery{Format: "json"}
+	if !decodeQuery(w, r, &q) {
+		return
+	}
+
+	rows, err := s.db.Query(`
+		SELECT file_id, file_name, COALESCE(notes, ''), created_at
+		FROM bookmarks
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	// Share links download without further checks, so browse-only callers get none
+	withLinks := s.canDownload(r)
+	bookmarks := make([]BookmarkExport, 0)
+	for rows.Next() {
+		var b BookmarkExport
+		if err := rows.Scan(&b.FileID, &b.FileName, &b.Notes, &b.CreatedAt); err != nil {
+			continue
+		}
+		if withLinks {
+			b.ShareURL, _ = s.shareURL(b.FileID)
+		}
+		bookmarks = append(bookmarks, b)
+	}
+
+	if rows.Err() != nil {
+		writeError(w, http.StatusInternalServerError, rows.Err().Error())
+		return
+	}
+
+	now := time.Now()
+	filename := "bookmarks-" + now.Format("2006-01-02") + "." + q.Format
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	switch q.Format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"exported_at": now.Format(time.RFC3339),
+			"bookmarks":   bookmarks,
+		})
+
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		cw := csv.NewWriter(w)
+		cw.Write(csvBookmarkHeader)
+		for _, b := range bookmarks {
+			cw.Write([]string{b.FileID, b.FileName, b.Notes, b.CreatedAt.Format(time.RFC3339), b.ShareURL})
+		}
+		cw.Flush()
+
+	case "opml":
+		doc := opmlDocument{Version: "2.0"}
+		doc.Head.Title = "E-Library bookmarks"
+		doc.Head.DateCreated = now.Format(time.RFC1123Z)
+		for _, b := range bookmarks {
+			doc.Outlines = append(doc.Outlines, opmlOutline{
+				Text:    b.FileName,
+				Type:    "link",
+				URL:     b.ShareURL,
+				Note:    b.Notes,
+				Created: b.CreatedAt.Format(time.RFC1123Z),
+				FileID:  b.FileID,
+			})
+		}
+
+		w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+		io.WriteString(w, xml.Header)
+		enc := xml.NewEncoder(w)
+		enc.Indent("", "  ")
+		enc.Encode(doc)
+	}
+}
+
+// parseBookmarkImport reads bookmarks from an export in the given format.
+// Only the file ID, file name and notes are used.
+func parseBookmarkImport(body io.Reader, format string) ([]BookmarkExport, error) {
+	var bookmarks []BookmarkExport
+	switch format {
+	case "json":
+		var doc struct {
+			Bookmarks []BookmarkExport `json:"bookmarks"`
+		}
+		if err := json.NewDecoder(body).Decode(&doc); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		bookmarks = doc.Bookmarks
+
+	case "csv":
+		cr := csv.NewReader(body)
+		header, err := cr.Read()
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		col := make(map[string]int, len(header))
+		for i, name := range header {
+			col[name] = i
+		}
+		if _, ok := col["file_name"]; !ok {
+			return nil, errors.New("invalid CSV: missing file_name column")
+		}
+
+		field := func(record []string, name string) string {
+			if i, ok := col[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+
+		for {
+			record, err := cr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid CSV: %w", err)
+			}
+			bookmarks = append(bookmarks, BookmarkExport{
+				FileID:   field(record, "file_id"),
+				FileName: field(record, "file_name"),
+				Notes:    field(record, "notes"),
+			})
+		}
+
+	case "opml":
+		var doc opmlDocument
+		if err := xml.NewDecoder(body).Decode(&doc); err != nil {
+			return nil, fmt.Errorf("invalid OPML: %w", err)
+		}
+		for _, o := range doc.Outlines {
+			bookmarks = append(bookmarks, BookmarkExport{FileID: o.FileID, FileName: o.Text, Notes: o.Note})
+		}
+	}
+	return bookmarks, nil
+}
+
+// handleImportBookmarks handles POST /api/bookmarks/import?format=json|csv|opml - imports
+// bookmarks exported by this or another instance. Entries are matched against the
+// library by file ID, falling back to the file name; unmatched entries are reported.
+// Existing bookmarks are left unchanged.
+func (s *Server) handleImportBookmarks(w http.ResponseWriter, r *http.Request) {
+	q := BookmarkFormatQuery{Format: "json"}
+	if !decodeQuery(w, r, &q) {
+		return
+	}
+
+	entries, err := parseBookmarkImport(http.MaxBytesReader(w, r.Body, maxImportBytes), q.Format)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	files, err := s.getFiles(r.Context(), false)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	byID := make(map[string]string, len(files))
+	byName := make(map[string]string, len(files))
+	for _, f := range files {
+		byID[f.ID] = f.Name
+		if _, dup := byName[f.Name]; !dup {
+			byName[f.Name] = f.ID
+		}
+	}
+
+	imported, existing := 0, 0
+	unmatched := make([]string, 0)
+	for _, e := range entries {
+		fileID, fileName := e.FileID, byID[e.FileID]
+		if fileName == "" {
+			fileID, fileName = byName[e.FileName], e.FileName
+		}
+
+		if fileID == "" {
+			unmatched = append(unmatched, e.FileName)
+			continue
+		}
+
+		result, err := s.execWrite(r.Context(),
+			"INSERT INTO bookmarks (file_id, file_name, notes) VALUES (?, ?, ?) ON CONFLICT(file_id) DO NOTHING",
+			fileID, fileName, e.Notes,
+		)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if n, _ := result.RowsAffected(); n > 0 {
+			imported++
+		} else {
+			existing++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"imported":  imported,
+		"existing":  existing,
+		"unmatched": unmatched,
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// RestrictedIndexKey is the Redis key for the set of files whose owners disabled downloads.
+const RestrictedIndexKey = "gdrive:restricted"
+
+// restrictedFiles returns the IDs of files the service account may view but not
+// download, such as files shared with it view-only with downloads disabled. The set
+// is cached in Redis for as long as the file listing.
+func (s *Server) restrictedFiles(ctx context.Context) (map[string]bool, error) {
+	if n, _ := s.redis.Exists(ctx, RestrictedIndexKey).Result(); n > 0 {
+		members, err := s.redis.SMembers(ctx, RestrictedIndexKey).Result()
+		if err != nil {
+			return nil, err
+		}
+		restricted := make(map[string]bool, len(members))
+		for _, id := range members {
+			if id != "" {
+				restricted[id] = true
+			}
+		}
+		return restricted, nil
+	}
+
+	restricted := make(map[string]bool)
+	err := s.driveService.Files.List().
+		Context(ctx).
+		Q("mimeType!='application/vnd.google-apps.folder' and trashed=false").
+		Fields("nextPageToken, files(id, capabilities(canDownload))").
+		PageSize(1000).
+		Pages(ctx, func(r *drive.FileList) error {
+			for _, f := range r.Files {
+				if f.Capabilities != nil && !f.Capabilities.CanDownload {
+					restricted[f.Id] = true
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list file capabilities: %w", err)
+	}
+
+	// An empty set cannot be stored, so a placeholder marks the index as built
+	members := []any{""}
+	for id := range restricted {
+		members = append(members, id)
+	}
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, RestrictedIndexKey)
+	pipe.SAdd(ctx, RestrictedIndexKey, members...)
+	pipe.Expire(ctx, RestrictedIndexKey, CacheExpiration)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logf(ctx, "Warning: Failed to cache restricted files: %v", err)
+	}
+	return restricted, nil
+}
+
+// downloadAllowed reports whether the service account may download a single file,
+// for files outside the library and its restricted index.
+func (s *Server) downloadAllowed(ctx context.Context, fileID string) (bool, error) {
+	f, err := s.driveService.Files.Get(fileID).
+		Context(ctx).
+		SupportsAllDrives(true).
+		Fields("capabilities(canDownload)").
+		Do()
+	if err != nil {
+		return false, fmt.Errorf("unable to get file capabilities: %w", err)
+	}
+	return f.Capabilities == nil || f.Capabilities.CanDownload, nil
+}
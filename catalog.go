@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/abiiranathan/gdrive"
+)
+
+// catalogMatchThreshold is the minimum name similarity (0-1) for a fuzzy catalog match.
+const catalogMatchThreshold = 0.85
+
+// authorTagPrefix prefixes the tags recording a file's authors, e.g. "author:Jane Austen".
+const authorTagPrefix = "author:"
+
+// CatalogRow is a row of a legacy catalog CSV. Path is a file name, optionally
+// preceded by its folder path; Authors are separated by semicolons in the CSV.
+type CatalogRow struct {
+	Line     int      `json:"line"`
+	Path     string   `json:"path"`
+	Category string   `json:"category,omitempty"`
+	Authors  []string `json:"authors,omitempty"`
+}
+
+// CatalogMatch records which file a catalog row was matched to.
+type CatalogMatch struct {
+	CatalogRow
+	FileID   string  `json:"file_id"`
+	FileName string  `json:"file_name"`
+	Score    float64 `json:"score"`
+}
+
+// ImportCatalogQuery holds the query parameters of POST /api/admin/import/catalog.
+type ImportCatalogQuery struct {
+	DryRun bool `query:"dry_run"`
+}
+
+// Collection is a named group of files.
+type Collection struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	FileCount int    `json:"file_count"`
+}
+
+// parseCatalog reads a catalog CSV with a header row. The path (or name, or file)
+// column is required; category and author(s) columns are optional.
+func parseCatalog(body io.Reader) ([]CatalogRow, error) {
+	cr := csv.NewReader(body)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	col := map[string]int{}
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "path", "name", "file", "file_name":
+			col["path"] = i
+		case "category", "collection":
+			col["category"] = i
+		case "author", "authors":
+			col["author"] = i
+		}
+	}
+	if _, ok := col["path"]; !ok {
+		return nil, errors.New("invalid CSV: missing path column")
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := col[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var rows []CatalogRow
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		line, _ := cr.FieldPos(0)
+		row := CatalogRow{Line: line, Path: field(record, "path"), Category: field(record, "category")}
+		if row.Path == "" {
+			continue
+		}
+		for _, author := range strings.Split(field(record, "author"), ";") {
+			if author = strings.TrimSpace(author); author != "" {
+				row.Authors = append(row.Authors, author)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// normalizeCatalogName reduces a file name or path to lower-case words, dropping
+// the extension and punctuation, so "My_Book (2nd ed).PDF" matches "my book 2nd ed".
+func normalizeCatalogName(name string) string {
+	if ext := path.Ext(name); len(ext) <= 5 && !strings.ContainsRune(ext, ' ') {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return strings.Join(strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '/'
+	}), " ")
+}
+
+// similarity returns 1 minus the Levenshtein distance between a and b divided by
+// the length of the longer string.
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(max(len(ra), len(rb)))
+}
+
+// catalogIndex looks up files by normalized name and folder path.
+type catalogIndex struct {
+	files  []gdrive.FileInfo
+	names  []string // normalized file names, parallel to files
+	byName map[string]int
+	byPath map[string]int
+}
+
+// newCatalogIndex indexes the listing for catalog matching.
+func newCatalogIndex(files []gdrive.FileInfo) *catalogIndex {
+	idx := &catalogIndex{
+		files:  files,
+		names:  make([]string, len(files)),
+		byName: make(map[string]int, len(files)),
+		byPath: make(map[string]int, len(files)),
+	}
+	for i, f := range files {
+		idx.names[i] = normalizeCatalogName(f.Name)
+		if _, dup := idx.byName[idx.names[i]]; !dup {
+			idx.byName[idx.names[i]] = i
+		}
+		idx.byPath[normalizeCatalogName(f.FolderPath+"/"+f.Name)] = i
+	}
+	return idx
+}
+
+// match finds the file a catalog path refers to: an exact folder path and name,
+// then an exact normalized name, then the most similar name above the threshold.
+func (idx *catalogIndex) match(catalogPath string) (gdrive.FileInfo, float64, bool) {
+	normalized := normalizeCatalogName(catalogPath)
+	if i, ok := idx.byPath[normalized]; ok {
+		return idx.files[i], 1, true
+	}
+
+	name := normalizeCatalogName(path.Base(catalogPath))
+	if i, ok := idx.byName[name]; ok {
+		return idx.files[i], 1, true
+	}
+
+	best, bestScore := -1, 0.0
+	for i, candidate := range idx.names {
+		// Names whose lengths differ this much cannot reach the threshold
+		if diff := len(candidate) - len(name); float64(max(diff, -diff)) > (1-catalogMatchThreshold)*float64(max(len(candidate), len(name))) {
+			continue
+		}
+		if score := similarity(name, candidate); score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	if best < 0 || bestScore < catalogMatchThreshold {
+		return gdrive.FileInfo{}, bestScore, false
+	}
+	return idx.files[best], bestScore, true
+}
+
+// addToCollection adds a file to the named collection, creating it if needed.
+func (s *Server) addToCollection(ctx context.Context, name, fileID string) error {
+	_, err := s.execWrite(ctx, "INSERT OR IGNORE INTO collections (name) VALUES (?)", name)
+	if err != nil {
+		return fmt.Errorf("unable to create collection %q: %w", name, err)
+	}
+
+	_, err = s.execWrite(ctx, `
+		INSERT OR IGNORE INTO collection_files (collection_id, file_id)
+		SELECT id, ? FROM collections WHERE name = ?
+	`, fileID, name)
+	if err != nil {
+		return fmt.Errorf("unable to add file to collection %q: %w", name, err)
+	}
+	return nil
+}
+
+// handleImportCatalog handles POST /api/admin/import/catalog[?dry_run=true] - imports a
+// legacy catalog CSV. Each row is matched against the Drive index; matched files are
+// added to the collection named by the category column and tagged with their authors.
+// Unmatched rows are returned so they can be fixed and re-imported.
+func (s *Server) handleImportCatalog(w http.ResponseWriter, r *http.Request) {
+	var q ImportCatalogQuery
+	if !decodeQuery(w, r, &q) {
+		return
+	}
+
+	rows, err := parseCatalog(http.MaxBytesReader(w, r.Body, maxImportBytes))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	files, err := s.getFiles(ctx, false)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	idx := newCatalogIndex(files)
+	matched := make([]CatalogMatch, 0)
+	unmatched := make([]CatalogRow, 0)
+	collections := make(map[string]bool)
+
+	for _, row := range rows {
+		f, score, ok := idx.match(row.Path)
+		if !ok {
+			unmatched = append(unmatched, row)
+			continue
+		}
+		matched = append(matched, CatalogMatch{CatalogRow: row, FileID: f.ID, FileName: f.Name, Score: score})
+
+		if row.Category != "" {
+			collections[row.Category] = true
+		}
+
+		if q.DryRun {
+			continue
+		}
+
+		if row.Category != "" {
+			if err := s.addToCollection(ctx, row.Category, f.ID); err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+
+		tags := make([]string, len(row.Authors))
+		for i, author := range row.Authors {
+			tags[i] = authorTagPrefix + author
+		}
+		if err := s.addTags(ctx, f.ID, tags); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if !q.DryRun {
+		s.audit(r, "catalog.import", "", fmt.Sprintf("%d matched, %d unmatched", len(matched), len(unmatched)))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"dry_run":     q.DryRun,
+		"rows":        len(rows),
+		"collections": len(collections),
+		"matched":     matched,
+		"unmatched":   unmatched,
+	})
+}
+
+// handleListCollections handles GET /api/collections - lists collections with their file counts.
+func (s *Server) handleListCollections(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.Query(`
+		SELECT c.id, c.name, COUNT(cf.file_id)
+		FROM collections c
+		LEFT JOIN collection_files cf ON cf.collection_id = c.id
+		GROUP BY c.id
+		ORDER BY c.name
+	`)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	collections := make([]Collection, 0)
+	for rows.Next() {
+		var c Collection
+		if err := rows.Scan(&c.ID, &c.Name, &c.FileCount); err != nil {
+			continue
+		}
+		collections = append(collections, c)
+	}
+
+	if rows.Err() != nil {
+		writeError(w, http.StatusInternalServerError, rows.Err().Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"collections": collections,
+	})
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+const (
+	// siteBundleName is the file name of the static catalog ZIP.
+	siteBundleName = "library-catalog.zip"
+
+	// coverConcurrency bounds the number of concurrent cover downloads.
+	coverConcurrency = 4
+
+	// maxCoverBytes caps the size of a single cover image in the bundle.
+	maxCoverBytes = 1 << 20
+)
+
+// coverClient downloads cover thumbnails.
+var coverClient = &http.Client{Timeout: 30 * time.Second}
+
+// SiteEntry is a file in the static catalog.
+type SiteEntry struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	MimeType    string   `json:"mime_type"`
+	Size        int64    `json:"size"`
+	Folder      string   `json:"folder"`
+	WebViewLink string   `json:"web_view_link,omitempty"`
+	Tags        []string `json:"tags"`
+	Collections []string `json:"collections"`
+	Cover       string   `json:"cover,omitempty"` // Path of the cover image within the bundle
+}
+
+// SiteFolder groups the entries of one folder on the HTML catalog page.
+type SiteFolder struct {
+	Path    string
+	Entries []SiteEntry
+}
+
+// SiteCatalog is the content of catalog.json and the data of index.html.
+type SiteCatalog struct {
+	GeneratedAt time.Time    `json:"generated_at"`
+	Count       int          `json:"count"`
+	TotalBytes  int64        `json:"total_bytes"`
+	Files       []SiteEntry  `json:"files"`
+	Folders     []SiteFolder `json:"-"`
+}
+
+// SiteQuery holds the query parameters of GET /api/admin/catalog/export.
+type SiteQuery struct {
+	Covers bool `query:"covers"`
+}
+
+// PublishSiteRequest represents a request to publish the static catalog to a Drive folder.
+type PublishSiteRequest struct {
+	FolderID string `json:"folder_id" validate:"required"`
+	Covers   bool   `json:"covers"`
+}
+
+// siteTemplate renders index.html of the static catalog. Covers are linked by relative
+// path so the extracted bundle can be browsed straight from disk.
+var siteTemplate = template.Must(template.New("site").Funcs(template.FuncMap{
+	"bytes": formatBytes,
+	"date":  func(t time.Time) string { return t.Format("2 Jan 2006") },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>E-Library catalog</title>
+<style>
+body { font-family: sans-serif; max-width: 60rem; margin: 0 auto; padding: 1rem; }
+li { margin: 0.5rem 0; list-style: none; }
+img { max-height: 6rem; vertical-align: middle; margin-right: 0.5rem; }
+.meta { color: #555; font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>E-Library catalog</h1>
+<p class="meta">{{.Count}} files, {{bytes .TotalBytes}}. Generated {{date .GeneratedAt}}.</p>
+{{range .Folders}}
+<h2>{{.Path}}</h2>
+<ul>
+{{- range .Entries}}
+<li>
+{{- if .Cover}}<img src="{{.Cover}}" alt="">{{end -}}
+{{- if .WebViewLink}}<a href="{{.WebViewLink}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}
+<span class="meta">{{bytes .Size}}
+{{- if .Tags}} · {{range $i, $t := .Tags}}{{if $i}}, {{end}}{{$t}}{{end}}{{end}}
+{{- if .Collections}} · in {{range $i, $c := .Collections}}{{if $i}}, {{end}}{{$c}}{{end}}{{end}}</span>
+</li>
+{{- end}}
+</ul>
+{{end}}
+</body>
+</html>
+`))
+
+// fileLabels returns the tags and the collection names of every file, keyed by file ID.
+func (s *Server) fileLabels(ctx context.Context) (map[string][]string, map[string][]string, error) {
+	tags := make(map[string][]string)
+	rows, err := s.db.QueryContext(ctx, "SELECT file_id, tag FROM file_tags ORDER BY tag")
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var fileID, tag string
+		if err := rows.Scan(&fileID, &tag); err == nil {
+			tags[fileID] = append(tags[fileID], tag)
+		}
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return nil, nil, rows.Err()
+	}
+
+	collections := make(map[string][]string)
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT cf.file_id, c.name
+		FROM collection_files cf
+		JOIN collections c ON c.id = cf.collection_id
+		ORDER BY c.name
+	`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var fileID, name string
+		if err := rows.Scan(&fileID, &name); err == nil {
+			collections[fileID] = append(collections[fileID], name)
+		}
+	}
+	return tags, collections, rows.Err()
+}
+
+// coverExtensions maps the image types Drive serves thumbnails as to file extensions.
+var coverExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// coverLinks returns the Drive thumbnail link of every file in ids that has one, keyed by file ID.
+func (s *Server) coverLinks(ctx context.Context, ids map[string]bool) (map[string]string, error) {
+	links := make(map[string]string)
+	err := s.driveService.Files.List().
+		Context(ctx).
+		Q("mimeType!='application/vnd.google-apps.folder' and trashed=false").
+		Fields("nextPageToken, files(id, thumbnailLink)").
+		PageSize(1000).
+		Pages(ctx, func(r *drive.FileList) error {
+			for _, f := range r.Files {
+				if f.ThumbnailLink != "" && ids[f.Id] {
+					links[f.Id] = f.ThumbnailLink
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list thumbnails: %w", err)
+	}
+	return links, nil
+}
+
+// downloadCover fetches a thumbnail image of at most maxCoverBytes and returns it with
+// the file extension of its type.
+func downloadCover(ctx context.Context, link string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := coverClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	ext, ok := coverExtensions[mediaType]
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported image type %q", mediaType)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCoverBytes))
+	return data, ext, err
+}
+
+// buildSite gathers the current index with folders, tags and collections into a static
+// catalog. If covers are requested, the thumbnail links of the catalog's files are
+// returned too, keyed by file ID.
+func (s *Server) buildSite(ctx context.Context, withCovers bool) (*SiteCatalog, map[string]string, error) {
+	files, err := s.visibleFiles(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tags, collections, err := s.fileLabels(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to load tags: %w", err)
+	}
+
+	site := &SiteCatalog{GeneratedAt: time.Now(), Count: len(files), Files: make([]SiteEntry, 0, len(files))}
+	ids := make(map[string]bool, len(files))
+	for _, f := range files {
+		site.Files = append(site.Files, SiteEntry{
+			ID:          f.ID,
+			Name:        f.Name,
+			MimeType:    f.MimeType,
+			Size:        f.Size,
+			Folder:      f.FolderPath,
+			WebViewLink: f.WebViewLink,
+			Tags:        append([]string{}, tags[f.ID]...),
+			Collections: append([]string{}, collections[f.ID]...),
+		})
+		site.TotalBytes += f.Size
+		ids[f.ID] = true
+	}
+
+	var links map[string]string
+	if withCovers {
+		if links, err = s.coverLinks(ctx, ids); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	c := s.collator()
+	slices.SortFunc(site.Files, func(a, b SiteEntry) int {
+		return compareNames(c, a.Folder, a.Name, b.Folder, b.Name)
+	})
+	return site, links, nil
+}
+
+// writeSiteBundle writes the static catalog as a ZIP containing the cover images under
+// covers/, index.html and catalog.json. Covers are downloaded from links and written as
+// they arrive, so at most coverConcurrency of them are held in memory; covers that
+// cannot be downloaded are left out. Returns the number of covers written.
+func writeSiteBundle(ctx context.Context, w io.Writer, site *SiteCatalog, links map[string]string) (int, error) {
+	zw := zip.NewWriter(w)
+
+	// A file listed under several folders appears once per folder
+	entries := make(map[string][]int)
+	for i, entry := range site.Files {
+		entries[entry.ID] = append(entries[entry.ID], i)
+	}
+
+	var (
+		mu       sync.Mutex
+		covers   int
+		writeErr error
+		wg       sync.WaitGroup
+	)
+	sem := make(chan struct{}, coverConcurrency)
+	for fileID, link := range links {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			data, ext, err := downloadCover(ctx, link)
+			if err != nil {
+				logf(ctx, "Warning: unable to download cover of %s: %v", fileID, err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if writeErr != nil {
+				return
+			}
+			name := "covers/" + fileID + ext
+			// Images are already compressed
+			cover, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+			if err == nil {
+				_, err = cover.Write(data)
+			}
+			if err != nil {
+				writeErr = err
+				return
+			}
+			for _, i := range entries[fileID] {
+				site.Files[i].Cover = name
+			}
+			covers++
+		}()
+	}
+	wg.Wait()
+	if writeErr != nil {
+		return 0, writeErr
+	}
+
+	site.Folders = nil
+	for _, entry := range site.Files {
+		if n := len(site.Folders); n == 0 || site.Folders[n-1].Path != entry.Folder {
+			site.Folders = append(site.Folders, SiteFolder{Path: entry.Folder})
+		}
+		folder := &site.Folders[len(site.Folders)-1]
+		folder.Entries = append(folder.Entries, entry)
+	}
+
+	page, err := zw.Create("index.html")
+	if err != nil {
+		return 0, err
+	}
+	if err := siteTemplate.Execute(page, site); err != nil {
+		return 0, fmt.Errorf("unable to render catalog: %w", err)
+	}
+
+	data, err := zw.Create("catalog.json")
+	if err != nil {
+		return 0, err
+	}
+	enc := json.NewEncoder(data)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(site); err != nil {
+		return 0, err
+	}
+	return covers, zw.Close()
+}
+
+// buildSiteBundle writes the static catalog bundle to a temporary file, positioned at
+// its start. The caller closes and removes the file.
+func (s *Server) buildSiteBundle(ctx context.Context, withCovers bool) (*os.File, *SiteCatalog, int, error) {
+	site, links, err := s.buildSite(ctx, withCovers)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	f, err := s.createTemp(bundlePattern)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	covers, err := writeSiteBundle(ctx, f, site, links)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, nil, 0, err
+	}
+	return f, site, covers, nil
+}
+
+// handleExportSite handles GET /api/admin/catalog/export - downloads the library index
+// as a static site bundle (ZIP of index.html and catalog.json) for offline distribution.
+// Drive thumbnails are included as covers with ?covers=true.
+func (s *Server) handleExportSite(w http.ResponseWriter, r *http.Request) {
+	var q SiteQuery
+	if !decodeQuery(w, r, &q) {
+		return
+	}
+
+	// Build the bundle before writing headers so failures can still be reported
+	bundle, _, _, err := s.buildSiteBundle(r.Context(), q.Covers)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer os.Remove(bundle.Name())
+	defer bundle.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, siteBundleName))
+	if info, err := bundle.Stat(); err == nil {
+		w.Header().Set("Content-Length", fmt.Sprint(info.Size()))
+	}
+	io.Copy(w, bundle)
+}
+
+// handlePublishSite handles POST /api/admin/catalog/publish - uploads the static site
+// bundle to a Drive folder, replacing the bundle published there previously.
+func (s *Server) handlePublishSite(w http.ResponseWriter, r *http.Request) {
+	var req PublishSiteRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if !driveIDPattern.MatchString(req.FolderID) {
+		writeValidationError(w, FieldError{Field: "folder_id", Message: "must be a Drive folder ID"})
+		return
+	}
+
+	ctx := r.Context()
+	bundle, site, covers, err := s.buildSiteBundle(ctx, req.Covers)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer os.Remove(bundle.Name())
+	defer bundle.Close()
+
+	existing, err := s.driveService.Files.List().
+		Context(ctx).
+		SupportsAllDrives(true).
+		IncludeItemsFromAllDrives(true).
+		Q(fmt.Sprintf("name='%s' and '%s' in parents and trashed=false", siteBundleName, req.FolderID)).
+		Fields("files(id)").
+		Do()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("unable to search folder: %v", err))
+		return
+	}
+
+	var published *drive.File
+	if len(existing.Files) > 0 {
+		published, err = s.driveService.Files.Update(existing.Files[0].Id, &drive.File{}).
+			Context(ctx).SupportsAllDrives(true).Media(bundle).Fields("id, webViewLink").Do()
+	} else {
+		published, err = s.driveService.Files.Create(&drive.File{
+			Name:     siteBundleName,
+			MimeType: "application/zip",
+			Parents:  []string{req.FolderID},
+		}).Context(ctx).SupportsAllDrives(true).Media(bundle).Fields("id, webViewLink").Do()
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("unable to upload catalog: %v", err))
+		return
+	}
+
+	s.audit(r, "catalog.publish", published.Id, fmt.Sprintf("%d files to folder %s", site.Count, req.FolderID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"file_id":       published.Id,
+		"web_view_link": published.WebViewLink,
+		"count":         site.Count,
+		"covers":        covers,
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// DefaultChangesInterval is how often the Drive Changes API is polled when
+	// CHANGES_INTERVAL is not set.
+	DefaultChangesInterval = 5 * time.Minute
+
+	// changesTokenKey is the Redis key holding the page token of the next changes poll.
+	changesTokenKey = "gdrive:changes:token"
+)
+
+// pollChanges asks Drive for the changes since the last poll and refreshes the library
+// when there are any, so edits show up within minutes instead of at the next scheduled
+// refresh. The first poll only records the current position.
+func (s *Server) pollChanges(ctx context.Context) error {
+	token, err := s.redis.Get(ctx, changesTokenKey).Result()
+	if errors.Is(err, redis.Nil) {
+		start, err := s.driveService.Changes.GetStartPageToken().Context(ctx).SupportsAllDrives(true).Do()
+		if err != nil {
+			return fmt.Errorf("unable to get start page token: %w", err)
+		}
+		return s.redis.Set(ctx, changesTokenKey, start.StartPageToken, 0).Err()
+	}
+	if err != nil {
+		return err
+	}
+
+	var changed, removed int
+	for token != "" {
+		list, err := s.driveService.Changes.List(token).
+			Context(ctx).
+			SupportsAllDrives(true).
+			IncludeItemsFromAllDrives(true).
+			Fields("nextPageToken, newStartPageToken, changes(fileId, removed, file(trashed))").
+			IncludeRemoved(true).
+			PageSize(1000).
+			Do()
+		if err != nil {
+			return fmt.Errorf("unable to list changes: %w", err)
+		}
+
+		for _, c := range list.Changes {
+			if c.Removed || (c.File != nil && c.File.Trashed) {
+				removed++
+			} else {
+				changed++
+			}
+		}
+
+		if list.NewStartPageToken != "" {
+			token = list.NewStartPageToken
+			break
+		}
+		token = list.NextPageToken
+	}
+
+	if changed+removed == 0 {
+		return s.redis.Set(ctx, changesTokenKey, token, 0).Err()
+	}
+	log.Printf("Detected %d changed and %d removed files in Drive", changed, removed)
+
+	// The token only advances once the refresh has seen the changes
+	if err := s.refreshLibrary(ctx); err != nil {
+		return err
+	}
+	return s.redis.Set(ctx, changesTokenKey, token, 0).Err()
+}
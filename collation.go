@@ -0,0 +1,42 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// parseCollationLocale parses the locale whose rules order file names, e.g. "fr" or
+// "sv". An empty value selects the root collation, which orders accented and
+// non-Latin names sensibly for most languages.
+func parseCollationLocale(v string) (language.Tag, error) {
+	if v == "" {
+		return language.Und, nil
+	}
+	tag, err := language.Parse(v)
+	if err != nil {
+		return language.Und, fmt.Errorf("invalid collation locale %q: %w", v, err)
+	}
+	return tag, nil
+}
+
+// collator returns a collator for the configured locale. Collators are not safe for
+// concurrent use, so every sort creates its own.
+func (s *Server) collator() *collate.Collator {
+	return collate.New(s.cfg.CollationLocale)
+}
+
+// sortByName sorts files in place by name using c, keeping the order of equal names.
+func sortByName[T any](files []T, c *collate.Collator, name func(T) string) {
+	slices.SortStableFunc(files, func(a, b T) int {
+		return c.CompareString(name(a), name(b))
+	})
+}
+
+// compareNames orders files by folder path and then by name using c.
+func compareNames(c *collate.Collator, folderA, nameA, folderB, nameB string) int {
+	return cmp.Or(c.CompareString(folderA, folderB), c.CompareString(nameA, nameB))
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ChecksumIndexKey is the Redis key for the hash mapping MD5 checksums to file IDs.
+const ChecksumIndexKey = "gdrive:checksums"
+
+// md5Pattern matches a hex-encoded MD5 checksum.
+var md5Pattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// fileByChecksum returns the ID of a library file with the given MD5 checksum, or ""
+// if there is none. When several files share the content, the same one is always
+// returned, preferring a copy whose owner did not disable downloads. Hidden files are
+// left out. The index is cached in Redis for as long as the file listing, or until a
+// file's visibility changes.
+func (s *Server) fileByChecksum(ctx context.Context, checksum string) (string, error) {
+	fileID, err := s.redis.HGet(ctx, ChecksumIndexKey, checksum).Result()
+	if err == nil {
+		return fileID, nil
+	}
+
+	// A missing key means the index was never built or has expired
+	if n, _ := s.redis.Exists(ctx, ChecksumIndexKey).Result(); n > 0 {
+		return "", nil
+	}
+
+	files, err := s.visibleFiles(ctx)
+	if err != nil {
+		return "", err
+	}
+	checksums, err := s.listChecksums(ctx)
+	if err != nil {
+		return "", err
+	}
+	restricted, err := s.restrictedFiles(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	index := make(map[string]string)
+	for _, f := range files {
+		sum := checksums[f.ID]
+		if sum == "" {
+			continue
+		}
+		current, ok := index[sum]
+		switch {
+		case !ok:
+		case restricted[f.ID] != restricted[current]:
+			if restricted[f.ID] {
+				continue
+			}
+		case current < f.ID:
+			continue
+		}
+		index[sum] = f.ID
+	}
+
+	// An empty hash cannot be stored, so a placeholder marks the index as built
+	values := []any{"", ""}
+	for sum, id := range index {
+		values = append(values, sum, id)
+	}
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, ChecksumIndexKey)
+	pipe.HSet(ctx, ChecksumIndexKey, values...)
+	pipe.Expire(ctx, ChecksumIndexKey, CacheExpiration)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logf(ctx, "Warning: Failed to cache checksum index: %v", err)
+	}
+	return index[checksum], nil
+}
+
+// handleGetContent handles GET /api/content/:md5 - streams the library file with the
+// given MD5 checksum. Identical files listed in several folders resolve to the same
+// content, and since the URL names the content, responses may be cached indefinitely.
+func (s *Server) handleGetContent(w http.ResponseWriter, r *http.Request) {
+	checksum := strings.ToLower(chi.URLParam(r, "md5"))
+	if !md5Pattern.MatchString(checksum) {
+		writeValidationError(w, FieldError{Field: "md5", Message: "must be a hex-encoded MD5 checksum"})
+		return
+	}
+
+	ctx := r.Context()
+	fileID, err := s.fileByChecksum(ctx, checksum)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	file, err := s.findFile(ctx, fileID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if file == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no file with checksum %s", checksum))
+		return
+	}
+
+	etag := `"` + checksum + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	s.serveDownload(w, r, file.ID, "", file.Name, file.FolderPath, file.MimeType, file.Size)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// DefaultConvertCacheDir is the directory where converted ebooks are stored.
+const DefaultConvertCacheDir = "convert-cache"
+
+const (
+	// maxConversions bounds the number of ebook-convert processes running at once.
+	maxConversions = 2
+
+	// conversionTimeout bounds the download and conversion of a single ebook.
+	conversionTimeout = 10 * time.Minute
+)
+
+// errConverterBusy is returned by ebookConverter.start when every conversion slot is taken.
+var errConverterBusy = errors.New("too many conversions in progress")
+
+// ebookFormats maps the formats ebooks can be converted between to their MIME types.
+var ebookFormats = map[string]string{
+	"pdf":  "application/pdf",
+	"epub": "application/epub+zip",
+}
+
+// ConvertQuery holds the query parameters of GET /api/files/:id/convert.
+type ConvertQuery struct {
+	To string `query:"to" validate:"required,oneof=pdf epub"`
+}
+
+// ebookConverter converts Drive-hosted ebooks between EPUB and PDF using calibre's
+// ebook-convert and caches the results on local disk, keyed by the source file's
+// checksum so a replaced file is converted again. At most one conversion runs per
+// file and target format, and at most maxConversions run in total.
+type ebookConverter struct {
+	convertPath string
+	cacheDir    string
+
+	ctx    context.Context // Cancelled by close, stopping running conversions
+	cancel context.CancelFunc
+	slots  chan struct{}
+
+	mu     sync.Mutex
+	active map[string]bool  // Conversions in progress, by cache name
+	failed map[string]error // Last conversion error, by cache name
+}
+
+// newEbookConverter creates a converter. Returns nil if convertPath is empty,
+// which disables conversions.
+func newEbookConverter(convertPath, cacheDir string) *ebookConverter {
+	if convertPath == "" {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ebookConverter{
+		convertPath: convertPath,
+		cacheDir:    cacheDir,
+		ctx:         ctx,
+		cancel:      cancel,
+		slots:       make(chan struct{}, maxConversions),
+		active:      make(map[string]bool),
+		failed:      make(map[string]error),
+	}
+}
+
+// close stops running conversions. Their partial output is discarded.
+func (c *ebookConverter) close() {
+	c.cancel()
+}
+
+// name returns the cache name of the file with the given checksum converted to format.
+func (c *ebookConverter) name(fileID, checksum, format string) string {
+	return fileID + "-" + checksum + "." + format
+}
+
+// path returns the cache path of the file with the given checksum converted to format.
+func (c *ebookConverter) path(fileID, checksum, format string) string {
+	return filepath.Join(c.cacheDir, c.name(fileID, checksum, format))
+}
+
+// ready reports whether the file with the given checksum is cached in format.
+func (c *ebookConverter) ready(fileID, checksum, format string) bool {
+	_, err := os.Stat(c.path(fileID, checksum, format))
+	return err == nil
+}
+
+// start begins converting fileID from one format to another in the background unless
+// that conversion is already running. Returns the error of the previous attempt, if it
+// failed, or errConverterBusy if no conversion slot is free.
+func (c *ebookConverter) start(s *Server, fileID, checksum, from, to string) error {
+	name := c.name(fileID, checksum, to)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err, failed := c.failed[name]; failed {
+		delete(c.failed, name)
+		return err
+	}
+
+	if c.active[name] {
+		return nil
+	}
+	select {
+	case c.slots <- struct{}{}:
+	default:
+		return errConverterBusy
+	}
+	c.active[name] = true
+
+	go func() {
+		ctx, cancel := context.WithTimeout(c.ctx, conversionTimeout)
+		err := c.convert(ctx, s, fileID, checksum, from, to)
+		cancel()
+		<-c.slots
+
+		c.mu.Lock()
+		delete(c.active, name)
+		if err != nil {
+			c.failed[name] = err
+		}
+		c.mu.Unlock()
+
+		if err != nil {
+			log.Printf("Conversion of %s to %s failed: %v", fileID, to, err)
+			return
+		}
+		log.Printf("Conversion of %s to %s completed", fileID, to)
+	}()
+	return nil
+}
+
+// convert downloads fileID to a temporary directory and converts it there. The
+// result is renamed into place on success, so a partial conversion is never served.
+func (c *ebookConverter) convert(ctx context.Context, s *Server, fileID, checksum, from, to string) error {
+	if err := os.MkdirAll(c.cacheDir, 0755); err != nil {
+		return fmt.Errorf("unable to create cache directory: %w", err)
+	}
+
+	work, err := os.MkdirTemp(c.cacheDir, fileID+".tmp-")
+	if err != nil {
+		return fmt.Errorf("unable to create work directory: %w", err)
+	}
+	defer os.RemoveAll(work)
+
+	// ebook-convert infers both formats from the file extensions
+	src, err := os.Create(filepath.Join(work, "source."+from))
+	if err != nil {
+		return fmt.Errorf("unable to create source file: %w", err)
+	}
+
+	_, err = s.driveClient.StreamFile(ctx, fileID, src)
+	src.Close()
+	if err != nil {
+		return err
+	}
+
+	out := filepath.Join(work, "out."+to)
+	cmd := exec.CommandContext(ctx, c.convertPath, src.Name(), out)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ebook-convert failed: %w: %s", err, output)
+	}
+
+	return os.Rename(out, c.path(fileID, checksum, to))
+}
+
+// ebookFormat returns the conversion format of a MIME type, if it is convertible.
+func ebookFormat(mimeType string) (string, bool) {
+	for format, t := range ebookFormats {
+		if t == mimeType {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+// handleConvertFile handles GET /api/files/:id/convert?to=pdf|epub - serves an ebook
+// converted to another format, starting a conversion and responding 202 while it
+// is not yet available. Converted files are subject to the same checks as downloads;
+// see authorizePlayback.
+func (s *Server) handleConvertFile(w http.ResponseWriter, r *http.Request) {
+	if s.converter == nil {
+		writeError(w, http.StatusNotImplemented, "ebook conversion is not enabled")
+		return
+	}
+
+	var q ConvertQuery
+	if !decodeQuery(w, r, &q) {
+		return
+	}
+
+	fileID := chi.URLParam(r, "id")
+	if !driveIDPattern.MatchString(fileID) {
+		writeError(w, http.StatusBadRequest, "invalid file ID")
+		return
+	}
+
+	ctx := r.Context()
+	file, err := s.findFile(ctx, fileID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if file == nil {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	from, ok := ebookFormat(file.MimeType)
+	if !ok {
+		writeError(w, http.StatusUnprocessableEntity, "only EPUB and PDF files can be converted")
+		return
+	}
+	if from == q.To {
+		writeError(w, http.StatusUnprocessableEntity, "file is already a "+strings.ToUpper(q.To))
+		return
+	}
+
+	checksum, err := s.fileChecksum(ctx, fileID)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	if s.converter.ready(fileID, checksum, q.To) {
+		if !s.authorizePlayback(w, r, file) {
+			return
+		}
+		name := strings.TrimSuffix(file.Name, filepath.Ext(file.Name)) + "." + q.To
+		w.Header().Set("Content-Type", ebookFormats[q.To])
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		http.ServeFile(w, r, s.converter.path(fileID, checksum, q.To))
+		return
+	}
+
+	if !s.checkServable(w, r, fileID) {
+		return
+	}
+
+	if err := s.converter.start(s, fileID, checksum, from, q.To); errors.Is(err, errConverterBusy) {
+		w.Header().Set("Retry-After", "30")
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("conversion failed: %v", err))
+		return
+	}
+
+	w.Header().Set("Retry-After", "10")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "conversion in progress"})
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// CacheStatus describes a cached listing in Redis.
+type CacheStatus struct {
+	Cached   bool      `json:"cached"`
+	Bytes    int64     `json:"bytes"` // Compressed payload size
+	CachedAt time.Time `json:"cached_at,omitzero"`
+	Age      string    `json:"age,omitempty"`
+}
+
+// QuotaSummary aggregates today's download usage against the configured limits.
+type QuotaSummary struct {
+	LimitCount     int     `json:"limit_count"` // 0 means unlimited
+	LimitBytes     int64   `json:"limit_bytes"` // 0 means unlimited
+	Downloads      int     `json:"downloads"`
+	Bytes          int64   `json:"bytes"`
+	ActiveUsers    int     `json:"active_users"`
+	UsersAtLimit   int     `json:"users_at_limit"`
+	ExemptUsers    int     `json:"exempt_users"`
+	IncompleteRate float64 `json:"incomplete_rate"` // Share of today's streamed downloads that were cut short
+}
+
+// cacheStatus reports whether a listing is cached, its size and age.
+func (s *Server) cacheStatus(ctx context.Context, key, timestampKey string) (CacheStatus, error) {
+	var status CacheStatus
+	size, err := s.redis.StrLen(ctx, key).Result()
+	if err != nil {
+		return status, err
+	}
+	if size == 0 {
+		return status, nil
+	}
+
+	status.Cached, status.Bytes = true, size
+	if timestamp, err := s.redis.Get(ctx, timestampKey).Int64(); err == nil {
+		status.CachedAt = time.Unix(timestamp, 0)
+		status.Age = time.Since(status.CachedAt).Round(time.Minute).String()
+	}
+	return status, nil
+}
+
+// quotaSummary aggregates today's downloads per user against the configured limits.
+func (s *Server) quotaSummary(ctx context.Context) (QuotaSummary, error) {
+	start, _ := quotaDay()
+	summary := QuotaSummary{LimitCount: s.cfg.Quota.DailyCount, LimitBytes: s.cfg.Quota.DailyBytes}
+
+	var streamed, incomplete int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(bytes), 0), COUNT(DISTINCT user_id),
+			COUNT(*) FILTER (WHERE status != ?), COUNT(*) FILTER (WHERE status = ?)
+		FROM downloads
+		WHERE downloaded_at >= ?
+	`, downloadDirect, downloadIncomplete, start).Scan(
+		&summary.Downloads, &summary.Bytes, &summary.ActiveUsers, &streamed, &incomplete,
+	)
+	if err != nil {
+		return summary, err
+	}
+	if streamed > 0 {
+		summary.IncompleteRate = float64(incomplete) / float64(streamed)
+	}
+
+	if summary.LimitCount > 0 || summary.LimitBytes > 0 {
+		err = s.db.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM (
+				SELECT user_id FROM downloads
+				WHERE user_id IS NOT NULL AND downloaded_at >= ?
+				GROUP BY user_id
+				HAVING (? > 0 AND COUNT(*) >= ?) OR (? > 0 AND SUM(bytes) >= ?)
+			)
+		`, start, summary.LimitCount, summary.LimitCount, summary.LimitBytes, summary.LimitBytes).Scan(&summary.UsersAtLimit)
+		if err != nil {
+			return summary, err
+		}
+	}
+
+	err = s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM quota_overrides").Scan(&summary.ExemptUsers)
+	return summary, err
+}
+
+// handleGetDashboard handles GET /api/admin/dashboard - returns quota usage, cache
+// status, job statuses, API usage, top files and error rates in a single payload.
+func (s *Server) handleGetDashboard(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	quota, err := s.quotaSummary(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fullCache, err := s.cacheStatus(ctx, FilesListCacheKey, CacheTimestampKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	liteCache, err := s.cacheStatus(ctx, LiteFilesCacheKey, LiteCacheTimestampKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT file_id, file_name, COUNT(*) AS count
+		FROM downloads
+		GROUP BY file_id
+		ORDER BY count DESC
+		LIMIT 10
+	`)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	type FileStats struct {
+		FileID   string `json:"file_id"`
+		FileName string `json:"file_name"`
+		Count    int    `json:"count"`
+	}
+
+	topFiles := make([]FileStats, 0)
+	for rows.Next() {
+		var fs FileStats
+		if err := rows.Scan(&fs.FileID, &fs.FileName, &fs.Count); err != nil {
+			continue
+		}
+		topFiles = append(topFiles, fs)
+	}
+
+	if rows.Err() != nil {
+		writeError(w, http.StatusInternalServerError, rows.Err().Error())
+		return
+	}
+
+	jobs := s.scheduler.Status()
+	failingJobs := 0
+	for _, job := range jobs {
+		if job.LastError != "" {
+			failingJobs++
+		}
+	}
+
+	usage := s.metrics.snapshot()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"generated_at": time.Now().Format(time.RFC3339),
+		"quota":        quota,
+		"cache": map[string]CacheStatus{
+			"full": fullCache,
+			"lite": liteCache,
+		},
+		"jobs":      jobs,
+		"api_usage": usage,
+		"top_files": topFiles,
+		"error_rates": map[string]float64{
+			"api":       usage.ErrorRate,
+			"downloads": quota.IncompleteRate,
+			"jobs":      float64(failingJobs) / float64(max(len(jobs), 1)),
+		},
+	})
+}
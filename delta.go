@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// listingVersionKeyPrefix prefixes the Redis keys of past listings, by ETag, kept for delta responses.
+const listingVersionKeyPrefix = "gdrive:files:version:"
+
+// listingETag returns a weak ETag identifying the content of a listing.
+func listingETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag.
+func etagMatches(header, etag string) bool {
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// storeListingVersion keeps a listing under its ETag until the cache expires,
+// so clients holding that ETag can later request a delta against it.
+func (s *Server) storeListingVersion(ctx context.Context, etag string, files any) {
+	key := listingVersionKeyPrefix + etag
+	if s.redis.Exists(ctx, key).Val() > 0 {
+		return
+	}
+
+	data, err := marshalCache(files)
+	if err != nil {
+		logf(ctx, "Warning: Failed to marshal listing version: %v", err)
+		return
+	}
+
+	if err := s.redis.Set(ctx, key, data, CacheExpiration).Err(); err != nil {
+		logf(ctx, "Warning: Failed to store listing version: %v", err)
+	}
+}
+
+// loadListingVersion returns the listing stored under etag, if it is still known.
+func loadListingVersion[T any](ctx context.Context, s *Server, etag string) ([]T, bool) {
+	if etag == "" {
+		return nil, false
+	}
+
+	data, err := s.redis.Get(ctx, listingVersionKeyPrefix+etag).Bytes()
+	if err != nil {
+		return nil, false
+	}
+
+	var files []T
+	if err := unmarshalCache(data, &files); err != nil {
+		return nil, false
+	}
+	return files, true
+}
+
+// diffListing compares two listings by ID and returns the entries added or
+// changed in cur, and the IDs of the entries removed from old.
+func diffListing[T any](old, cur []T, id func(T) string) (added, changed []T, removed []string) {
+	previous := make(map[string][]byte, len(old))
+	for _, f := range old {
+		data, _ := json.Marshal(f)
+		previous[id(f)] = data
+	}
+
+	added, changed, removed = make([]T, 0), make([]T, 0), make([]string, 0)
+	for _, f := range cur {
+		data, ok := previous[id(f)]
+		if !ok {
+			added = append(added, f)
+			continue
+		}
+		delete(previous, id(f))
+
+		if now, _ := json.Marshal(f); !bytes.Equal(now, data) {
+			changed = append(changed, f)
+		}
+	}
+
+	for fileID := range previous {
+		removed = append(removed, fileID)
+	}
+	return added, changed, removed
+}
+
+// serveListing writes a file listing with an ETag derived from its content.
+// A request whose If-None-Match matches gets 304 Not Modified. A request with
+// ?since=<etag> gets only the entries added, changed and removed since that
+// listing; when it is no longer known the full listing is sent with "delta": false.
+// The IDs of featured, pinned and restricted files and the statuses of listed files
+// are sent alongside in either case.
+func serveListing[T any](s *Server, w http.ResponseWriter, r *http.Request, q ListFilesQuery, files []T, id func(T) string, overlay fileOverlay, timestampKey string) {
+	ctx := r.Context()
+	data, err := json.Marshal(files)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Featuring a file changes the response but not the files, so it is part of the ETag
+	featured := overlayIDs(files, overlay.featured, id)
+	pinned := overlayIDs(files, overlay.pinned, id)
+	restricted, err := s.restrictedFiles(ctx)
+	if err != nil {
+		logf(ctx, "Warning: Failed to load restricted files: %v", err)
+	}
+	blocked := overlayIDs(files, restricted, id)
+	statuses, err := s.fileStatuses(ctx)
+	if err != nil {
+		logf(ctx, "Warning: Failed to load file statuses: %v", err)
+	}
+	listed := listedStatuses(files, statuses, id)
+	curation, _ := json.Marshal([]any{featured, pinned, blocked, listed})
+	etag := listingETag(append(data, curation...))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	s.storeListingVersion(ctx, etag, files)
+
+	// Get cache info for response metadata
+	timestamp, _ := s.redis.Get(ctx, timestampKey).Int64()
+	cacheAge := time.Since(time.Unix(timestamp, 0))
+	expiresIn := CacheExpiration - cacheAge
+
+	resp := map[string]any{
+		"count":      len(files),
+		"profile":    q.Profile,
+		"cache_age":  cacheAge.Round(time.Minute).String(),
+		"expires_in": expiresIn.Round(time.Minute).String(),
+		"cached_at":  time.Unix(timestamp, 0).Format(time.RFC3339),
+		"featured":   featured,
+		"pinned":     pinned,
+		"restricted": blocked, // Files that can be viewed in Drive but not downloaded
+		"statuses":   listed,
+	}
+
+	if old, ok := loadListingVersion[T](ctx, s, q.Since); ok {
+		added, changed, removed := diffListing(old, files, id)
+		resp["delta"] = true
+		resp["since"] = q.Since
+		resp["added"] = added
+		resp["changed"] = changed
+		resp["removed"] = removed
+	} else {
+		if q.Since != "" {
+			resp["delta"] = false
+		}
+		resp["files"] = json.RawMessage(data)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/abiiranathan/gdrive"
+	"github.com/go-chi/chi/v5"
+)
+
+// DigestInterval is how often the activity digest is emailed.
+const DigestInterval = 7 * 24 * time.Hour
+
+// SMTPConfig holds the outgoing mail server settings. Email is disabled when Host is empty.
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// DigestRecipientRequest represents a digest subscription request.
+type DigestRecipientRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// DigestData is the data rendered into the weekly digest email.
+type DigestData struct {
+	Since         time.Time
+	Until         time.Time
+	NewFiles      []gdrive.FileInfo
+	TopDownloads  []DigestDownload
+	TotalFiles    int
+	TotalBytes    int64
+	QuotaUsed     int64
+	QuotaLimit    int64
+	DeadBookmarks []DigestBookmark
+}
+
+// DigestDownload is a download count entry in the digest.
+type DigestDownload struct {
+	FileName string
+	Count    int
+}
+
+// DigestBookmark is a bookmark whose file is no longer in the library.
+type DigestBookmark struct {
+	FileID   string
+	FileName string
+}
+
+// digestTemplate renders the plain-text weekly digest.
+var digestTemplate = template.Must(template.New("digest").Funcs(template.FuncMap{
+	"bytes": formatBytes,
+	"date":  func(t time.Time) string { return t.Format("2 Jan 2006") },
+}).Parse(`E-Library activity from {{date .Since}} to {{date .Until}}
+
+NEW FILES ({{len .NewFiles}})
+{{range .NewFiles}}  - {{.Name}} ({{.FolderPath}}, {{bytes .Size}})
+{{else}}  No new files this week.
+{{end}}
+TOP DOWNLOADS
+{{range .TopDownloads}}  - {{.FileName}}: {{.Count}}
+{{else}}  No downloads this week.
+{{end}}
+STORAGE
+  Library: {{.TotalFiles}} files, {{bytes .TotalBytes}}
+{{- if .QuotaLimit}}
+  Drive quota: {{bytes .QuotaUsed}} of {{bytes .QuotaLimit}}
+{{- end}}
+
+DEAD BOOKMARKS ({{len .DeadBookmarks}})
+{{range .DeadBookmarks}}  - {{.FileName}} ({{.FileID}})
+{{else}}  All bookmarks point to existing files.
+{{end}}`))
+
+// formatBytes formats a byte count using binary units.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// sendMail sends a plain-text email through the configured SMTP server.
+func (s *Server) sendMail(to []string, subject, body string) error {
+	smtpCfg := s.cfg.SMTP
+	if smtpCfg.Host == "" {
+		return errors.New("SMTP is not configured")
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", smtpCfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if smtpCfg.Username != "" {
+		auth = smtp.PlainAuth("", smtpCfg.Username, smtpCfg.Password, smtpCfg.Host)
+	}
+
+	addr := net.JoinHostPort(smtpCfg.Host, smtpCfg.Port)
+	return smtp.SendMail(addr, auth, smtpCfg.From, to, msg.Bytes())
+}
+
+// buildDigest gathers the library activity since the given time. Hidden files are left
+// out, and bookmarks to them are not reported as dead.
+func (s *Server) buildDigest(ctx context.Context, since time.Time) (*DigestData, error) {
+	files, err := s.getFiles(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	overlay, err := s.loadOverlay(ctx)
+	if err != nil {
+		return nil, err
+	}
+	files = applyOverlay(files, overlay, func(f gdrive.FileInfo) string { return f.ID })
+
+	data := &DigestData{Since: since, Until: time.Now(), TotalFiles: len(files)}
+	listed := make(map[string]gdrive.FileInfo, len(files))
+	for _, f := range files {
+		listed[f.ID] = f
+		data.TotalBytes += f.Size
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT file_id FROM known_files WHERE first_seen >= ?", since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			if f, ok := listed[id]; ok {
+				data.NewFiles = append(data.NewFiles, f)
+			}
+		}
+	}
+	rows.Close()
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT file_name, COUNT(*) as count
+		FROM downloads
+		WHERE downloaded_at >= ?
+		GROUP BY file_name
+		ORDER BY count DESC
+		LIMIT 10
+	`, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var d DigestDownload
+		if err := rows.Scan(&d.FileName, &d.Count); err == nil {
+			data.TopDownloads = append(data.TopDownloads, d)
+		}
+	}
+	rows.Close()
+
+	rows, err = s.db.QueryContext(ctx, "SELECT file_id, file_name FROM bookmarks")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var b DigestBookmark
+		if err := rows.Scan(&b.FileID, &b.FileName); err == nil {
+			if _, ok := listed[b.FileID]; !ok && !overlay.hidden[b.FileID] {
+				data.DeadBookmarks = append(data.DeadBookmarks, b)
+			}
+		}
+	}
+	rows.Close()
+
+	about, err := s.driveService.About.Get().Context(ctx).Fields("storageQuota").Do()
+	if err != nil {
+		log.Printf("Warning: Failed to fetch storage quota for digest: %v", err)
+	} else if about.StorageQuota != nil {
+		data.QuotaUsed = about.StorageQuota.Usage
+		data.QuotaLimit = about.StorageQuota.Limit
+	}
+
+	return data, nil
+}
+
+// sendDigest is the scheduled job emailing the weekly digest to opted-in recipients.
+func (s *Server) sendDigest(ctx context.Context) error {
+	if s.cfg.SMTP.Host == "" {
+		return nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT email FROM digest_recipients WHERE opted_in = 1")
+	if err != nil {
+		return err
+	}
+	var recipients []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err == nil {
+			recipients = append(recipients, email)
+		}
+	}
+	rows.Close()
+
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	data, err := s.buildDigest(ctx, time.Now().Add(-DigestInterval))
+	if err != nil {
+		return fmt.Errorf("unable to build digest: %w", err)
+	}
+
+	var body bytes.Buffer
+	if err := digestTemplate.Execute(&body, data); err != nil {
+		return fmt.Errorf("unable to render digest: %w", err)
+	}
+
+	// Send individually so recipients do not see each other's addresses
+	var errs []error
+	for _, to := range recipients {
+		if err := s.sendMail([]string{to}, "Weekly E-Library digest", body.String()); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", to, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// handleListDigestRecipients handles GET /api/admin/digest/recipients - returns digest subscribers.
+func (s *Server) handleListDigestRecipients(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.Query("SELECT email, created_at FROM digest_recipients WHERE opted_in = 1 ORDER BY email")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	type Recipient struct {
+		Email     string    `json:"email"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	recipients := make([]Recipient, 0)
+	for rows.Next() {
+		var rc Recipient
+		if err := rows.Scan(&rc.Email, &rc.CreatedAt); err != nil {
+			continue
+		}
+		recipients = append(recipients, rc)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"recipients": recipients,
+		"count":      len(recipients),
+	})
+}
+
+// handleAddDigestRecipient handles POST /api/admin/digest/recipients - opts an address in to the digest.
+func (s *Server) handleAddDigestRecipient(w http.ResponseWriter, r *http.Request) {
+	var req DigestRecipientRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	// Validation guarantees the address parses
+	addr, _ := mail.ParseAddress(req.Email)
+	_, err := s.execWrite(r.Context(), `
+		INSERT INTO digest_recipients (email, opted_in) VALUES (?, 1)
+		ON CONFLICT(email) DO UPDATE SET opted_in = 1
+	`, addr.Address)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "recipient opted in"})
+}
+
+// handleRemoveDigestRecipient handles DELETE /api/admin/digest/recipients/:email - opts an address out.
+func (s *Server) handleRemoveDigestRecipient(w http.ResponseWriter, r *http.Request) {
+	email := chi.URLParam(r, "email")
+	result, err := s.execWrite(r.Context(), "UPDATE digest_recipients SET opted_in = 0 WHERE email = ?", email)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		writeError(w, http.StatusNotFound, "recipient not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "recipient opted out"})
+}
+
+// handleSendDigest handles POST /api/admin/digest/send - sends the digest now.
+func (s *Server) handleSendDigest(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.SMTP.Host == "" {
+		writeError(w, http.StatusNotImplemented, "SMTP is not configured")
+		return
+	}
+
+	s.scheduler.RunNow(context.Background(), "weekly-digest")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "digest queued"})
+}
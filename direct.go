@@ -0,0 +1,114 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// DirectMode selects how GET /api/files/:id/direct lets clients fetch bytes from Google.
+type DirectMode string
+
+const (
+	// DirectOff disables direct downloads; content is always proxied.
+	DirectOff DirectMode = ""
+
+	// DirectLink returns the file's webContentLink. It only works for files the
+	// browser's Google account can read, e.g. files shared "anyone with the link".
+	DirectLink DirectMode = "link"
+
+	// DirectToken returns a media URL authorized by a short-lived, read-only access
+	// token of the service account. Anyone holding the URL can read any file the
+	// service account can read until the token expires, so it requires ACCESS_MODE
+	// login or private and is only issued to signed-in users.
+	DirectToken DirectMode = "token"
+)
+
+// parseDirectMode validates a DIRECT_DOWNLOADS value.
+func parseDirectMode(v string) (DirectMode, error) {
+	switch mode := DirectMode(v); mode {
+	case DirectOff, DirectLink, DirectToken:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid direct download mode %q: must be link or token", v)
+	}
+}
+
+// handleDirectDownload handles GET /api/files/:id/direct - returns a URL for downloading
+// the file straight from Google instead of proxying it through the server. Clients
+// should fall back to /download when this responds with an error.
+func (s *Server) handleDirectDownload(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.DirectDownloads == DirectOff {
+		writeError(w, http.StatusNotImplemented, "direct downloads are not enabled")
+		return
+	}
+
+	ctx := r.Context()
+	fileID := chi.URLParam(r, "id")
+	file, err := s.findFile(ctx, fileID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if file == nil {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	if !s.checkServable(w, r, file.ID) || !s.checkQuota(w, r, file.Size) {
+		return
+	}
+
+	resp := map[string]any{
+		"file_name": file.Name,
+		"size":      file.Size,
+		"mode":      s.cfg.DirectDownloads,
+	}
+
+	switch s.cfg.DirectDownloads {
+	case DirectLink:
+		f, err := s.driveService.Files.Get(fileID).Context(ctx).SupportsAllDrives(true).Fields("webContentLink").Do()
+		if err != nil {
+			writeError(w, http.StatusBadGateway, fmt.Sprintf("unable to fetch download link: %v", err))
+			return
+		}
+
+		if f.WebContentLink == "" {
+			writeError(w, http.StatusConflict, "file has no direct download link")
+			return
+		}
+		resp["url"] = f.WebContentLink
+
+	case DirectToken:
+		if userFromContext(ctx) == nil {
+			writeError(w, http.StatusForbidden, "direct downloads require a signed-in user")
+			return
+		}
+
+		token, err := s.directTokens.Token()
+		if err != nil {
+			writeError(w, http.StatusBadGateway, fmt.Sprintf("unable to issue access token: %v", err))
+			return
+		}
+
+		resp["url"] = "https://www.googleapis.com/drive/v3/files/" + url.PathEscape(fileID) +
+			"?alt=media&access_token=" + url.QueryEscape(token.AccessToken)
+		resp["expires_at"] = token.Expiry.Format(time.RFC3339)
+	}
+
+	var userID sql.NullInt64
+	if user := userFromContext(ctx); user != nil {
+		userID = sql.NullInt64{Int64: user.ID, Valid: true}
+	}
+	s.downloads.start(ctx, file.ID, file.Name, file.FolderPath, userID, file.Size, downloadDirect)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
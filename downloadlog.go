@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"maps"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// downloadLogBuffer is how many download records may wait to be written.
+	// Records beyond it are dropped rather than delaying a download.
+	downloadLogBuffer = 4096
+
+	// downloadLogBatchSize is the largest number of records written in one transaction.
+	downloadLogBatchSize = 200
+
+	// downloadLogFlushInterval is the longest a record waits before being written.
+	downloadLogFlushInterval = time.Second
+)
+
+// downloadRecord is a queued write to the downloads table: the start of a download,
+// or its outcome when finished is set.
+type downloadRecord struct {
+	id       int64 // Handle returned by start, not the row ID
+	fileID   string
+	fileName string
+	folder   string // FolderPath of the file at download time
+	userID   sql.NullInt64
+	bytes    int64
+	sent     int64
+	status   string
+	finished bool
+}
+
+// downloadLog writes download records in batches from a background goroutine, so
+// recording a download never waits for the database. start returns a handle right
+// away so the outcome can be queued before the start has been written; SQLite assigns
+// the row IDs, so several processes can share the database. Quota checks see records
+// once they are flushed.
+type downloadLog struct {
+	s       *Server
+	insert  *sql.Stmt
+	update  *sql.Stmt
+	nextID  atomic.Int64
+	rows    map[int64]int64 // Row ID of each written download still awaiting its outcome; owned by run
+	records chan downloadRecord
+	done    chan struct{}
+
+	mu     sync.RWMutex // Guards closed against queueing on a closed channel
+	closed bool
+}
+
+// newDownloadLog prepares the download statements and starts the writer.
+func newDownloadLog(s *Server) (*downloadLog, error) {
+	l := &downloadLog{
+		s:       s,
+		rows:    make(map[int64]int64),
+		records: make(chan downloadRecord, downloadLogBuffer),
+		done:    make(chan struct{}),
+	}
+
+	var err error
+	l.insert, err = s.db.Prepare(
+		"INSERT INTO downloads (file_id, file_name, folder_path, user_id, bytes, status) VALUES (?, ?, ?, ?, ?, ?)",
+	)
+	if err != nil {
+		return nil, err
+	}
+	l.update, err = s.db.Prepare("UPDATE downloads SET bytes_sent = ?, status = ? WHERE id = ?")
+	if err != nil {
+		l.insert.Close()
+		return nil, err
+	}
+
+	go l.run()
+	return l, nil
+}
+
+// start queues the record of a new download and returns the handle passed to finish.
+// Only downloads started with downloadStarted are expected to finish.
+func (l *downloadLog) start(ctx context.Context, fileID, fileName, folderPath string, userID sql.NullInt64, size int64, status string) int64 {
+	id := l.nextID.Add(1)
+	l.queue(ctx, downloadRecord{id: id, fileID: fileID, fileName: fileName, folder: folderPath, userID: userID, bytes: size, status: status})
+	return id
+}
+
+// finish queues the outcome of a download returned by start.
+func (l *downloadLog) finish(ctx context.Context, id, sent int64, status string) {
+	l.queue(ctx, downloadRecord{id: id, sent: sent, status: status, finished: true})
+}
+
+// queue hands a record to the writer without blocking.
+func (l *downloadLog) queue(ctx context.Context, rec downloadRecord) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		logf(ctx, "Warning: download log is closed, dropping record of download %d", rec.id)
+		return
+	}
+
+	select {
+	case l.records <- rec:
+	default:
+		logf(ctx, "Warning: download log is full, dropping record of download %d", rec.id)
+	}
+}
+
+// run writes queued records until the log is closed, then writes the remainder.
+func (l *downloadLog) run() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(downloadLogFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]downloadRecord, 0, downloadLogBatchSize)
+	for {
+		select {
+		case rec, ok := <-l.records:
+			if !ok {
+				l.flush(batch)
+				return
+			}
+			batch = append(batch, rec)
+			if len(batch) < downloadLogBatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		l.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+// flush writes a batch of records in one transaction, in the order they were queued.
+func (l *downloadLog) flush(batch []downloadRecord) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	// Row IDs of the batch are only kept once it is committed
+	var written map[int64]int64
+	err := l.s.writeTx(ctx, func(tx *sql.Tx) error {
+		written = make(map[int64]int64)
+		insert, update := tx.StmtContext(ctx, l.insert), tx.StmtContext(ctx, l.update)
+		for _, rec := range batch {
+			if !rec.finished {
+				result, err := insert.ExecContext(ctx, rec.fileID, rec.fileName, rec.folder, rec.userID, rec.bytes, rec.status)
+				if err != nil {
+					return err
+				}
+				if rec.status == downloadStarted {
+					written[rec.id], _ = result.LastInsertId()
+				}
+				continue
+			}
+
+			rowID, ok := written[rec.id]
+			if !ok {
+				rowID, ok = l.rows[rec.id]
+			}
+			if !ok {
+				continue // The start was dropped or failed to be written
+			}
+			if _, err := update.ExecContext(ctx, rec.sent, rec.status, rowID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to record %d downloads: %v", len(batch), err)
+	} else {
+		maps.Copy(l.rows, written)
+	}
+	for _, rec := range batch {
+		if rec.finished {
+			delete(l.rows, rec.id)
+		}
+	}
+}
+
+// Close writes the queued records and releases the prepared statements.
+func (l *downloadLog) Close() {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	l.closed = true
+	close(l.records)
+	l.mu.Unlock()
+
+	<-l.done
+	l.insert.Close()
+	l.update.Close()
+}
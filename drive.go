@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/abiiranathan/gdrive"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// metadataBatchConcurrency bounds the number of concurrent Drive calls made by updateMetadataBatch.
+const metadataBatchConcurrency = 8
+
+// MetadataUpdate describes a single rename and/or move applied by updateMetadataBatch.
+type MetadataUpdate struct {
+	FileID      string
+	Name        string
+	NewParentID string
+}
+
+// newDriveService creates a raw Drive API service from service account credentials.
+// It is used for operations the gdrive package does not expose (checksums,
+// metadata updates, etc.) and therefore requests the full Drive scope.
+func newDriveService(ctx context.Context, jsonCredentials []byte) (*drive.Service, error) {
+	config, err := google.JWTConfigFromJSON(jsonCredentials, drive.DriveScope)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse service account credentials: %w", err)
+	}
+	return drive.NewService(ctx, option.WithHTTPClient(config.Client(ctx)))
+}
+
+// listChecksums returns the MD5 checksum of every non-folder file, keyed by file ID.
+// Google Workspace documents have no checksum and are omitted.
+func (s *Server) listChecksums(ctx context.Context) (map[string]string, error) {
+	checksums := make(map[string]string)
+	err := s.driveService.Files.List().
+		Context(ctx).
+		Q("mimeType!='application/vnd.google-apps.folder' and trashed=false").
+		Fields("nextPageToken, files(id, md5Checksum)").
+		PageSize(1000).
+		Pages(ctx, func(r *drive.FileList) error {
+			for _, f := range r.Files {
+				if f.Md5Checksum != "" {
+					checksums[f.Id] = f.Md5Checksum
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list checksums: %w", err)
+	}
+	return checksums, nil
+}
+
+// fileChecksum returns the MD5 checksum of a file's content, or "" for Google
+// Workspace documents, which have none.
+func (s *Server) fileChecksum(ctx context.Context, fileID string) (string, error) {
+	f, err := s.driveService.Files.Get(fileID).Context(ctx).SupportsAllDrives(true).Fields("md5Checksum").Do()
+	if err != nil {
+		return "", fmt.Errorf("unable to get checksum: %w", err)
+	}
+	return f.Md5Checksum, nil
+}
+
+// updateMetadata renames and/or moves a file or folder.
+// An empty name keeps the current name and an empty newParentID keeps the current location.
+func (s *Server) updateMetadata(ctx context.Context, fileID, name, newParentID string) (*drive.File, error) {
+	call := s.driveService.Files.Update(fileID, &drive.File{Name: name}).
+		Context(ctx).
+		SupportsAllDrives(true).
+		Fields("id, name, parents")
+
+	if newParentID != "" {
+		current, err := s.driveService.Files.Get(fileID).Context(ctx).SupportsAllDrives(true).Fields("parents").Do()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get current parents: %w", err)
+		}
+		call = call.AddParents(newParentID).RemoveParents(strings.Join(current.Parents, ","))
+	}
+
+	f, err := call.Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to update metadata: %w", err)
+	}
+	return f, nil
+}
+
+// setTrashed moves a file or folder to the trash, or restores it from the trash.
+// The gdrive package's client only holds the read-only scope, so this goes through
+// the full-scope service.
+func (s *Server) setTrashed(ctx context.Context, fileID string, trashed bool) error {
+	_, err := s.driveService.Files.Update(fileID, &drive.File{
+		Trashed: trashed,
+		// Restoring sends trashed=false, which is otherwise omitted as the zero value
+		ForceSendFields: []string{"Trashed"},
+	}).Context(ctx).SupportsAllDrives(true).Fields("id").Do()
+	if err != nil {
+		return fmt.Errorf("unable to update trashed state: %w", err)
+	}
+	return nil
+}
+
+// createFolder creates a folder under parentID, or at the root of the service
+// account's Drive when parentID is empty, and returns its ID.
+func (s *Server) createFolder(ctx context.Context, name, parentID string) (string, error) {
+	folder := &drive.File{Name: name, MimeType: folderMimeType}
+	if parentID != "" {
+		folder.Parents = []string{parentID}
+	}
+
+	created, err := s.driveService.Files.Create(folder).Context(ctx).SupportsAllDrives(true).Fields("id").Do()
+	if err != nil {
+		return "", fmt.Errorf("unable to create folder: %w", err)
+	}
+	return created.Id, nil
+}
+
+// deleteFile permanently deletes a file or folder, bypassing the trash.
+func (s *Server) deleteFile(ctx context.Context, fileID string) error {
+	if err := s.driveService.Files.Delete(fileID).Context(ctx).SupportsAllDrives(true).Do(); err != nil {
+		return fmt.Errorf("unable to delete file permanently: %w", err)
+	}
+	return nil
+}
+
+// replaceContent uploads content as a new revision of fileID, so the file keeps its ID,
+// share links and bookmarks. An empty mimeType keeps the current type.
+func (s *Server) replaceContent(ctx context.Context, fileID string, content io.Reader, mimeType string) (*drive.File, error) {
+	var opts []googleapi.MediaOption
+	if mimeType != "" {
+		opts = append(opts, googleapi.ContentType(mimeType))
+	}
+
+	f, err := s.driveService.Files.Update(fileID, &drive.File{MimeType: mimeType}).
+		Context(ctx).
+		SupportsAllDrives(true).
+		Media(content, opts...).
+		Fields("id, name, mimeType, size, md5Checksum, version").
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to replace content: %w", err)
+	}
+	return f, nil
+}
+
+// updateFolderStyle sets the color and/or description of a folder.
+// Empty values keep the current setting. Drive maps colors outside its palette
+// to the closest supported color.
+func (s *Server) updateFolderStyle(ctx context.Context, folderID, colorRgb, description string) (*drive.File, error) {
+	f, err := s.driveService.Files.Update(folderID, &drive.File{
+		FolderColorRgb: colorRgb,
+		Description:    description,
+	}).Context(ctx).SupportsAllDrives(true).Fields("id, name, parents, folderColorRgb, description").Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to update folder style: %w", err)
+	}
+	return f, nil
+}
+
+// updateMetadataBatch applies many metadata updates concurrently.
+// The returned slice holds the error (or nil) for each update, in input order.
+func (s *Server) updateMetadataBatch(ctx context.Context, updates []MetadataUpdate) []error {
+	errs := make([]error, len(updates))
+	sem := make(chan struct{}, metadataBatchConcurrency)
+	var wg sync.WaitGroup
+
+	for i, u := range updates {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			_, errs[i] = s.updateMetadata(ctx, u.FileID, u.Name, u.NewParentID)
+		}()
+	}
+
+	wg.Wait()
+	return errs
+}
+
+// openRange starts a download of fileID from byte offset to the end of the file.
+// The gdrive package's PartialStreamFile goes through the revisions endpoint,
+// so ranged reads of the current content are issued here directly.
+func (s *Server) openRange(ctx context.Context, fileID string, offset int64) (io.ReadCloser, error) {
+	call := s.driveService.Files.Get(fileID).Context(ctx).SupportsAllDrives(true)
+	if offset > 0 {
+		call.Header().Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := call.Download()
+	if err != nil {
+		return nil, fmt.Errorf("unable to download file: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// notFoundError reports whether a Drive call failed because the file does not exist
+// or is not visible to the service account.
+func notFoundError(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+// abusiveFileError reports whether a download failed because Google flagged the file
+// as malware or spam.
+func abusiveFileError(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusForbidden {
+		return false
+	}
+	for _, e := range apiErr.Errors {
+		if e.Reason == "cannotDownloadAbusiveFile" {
+			return true
+		}
+	}
+	return false
+}
+
+// streamAcknowledgingAbuse streams fileID to w, acknowledging the risk of downloading
+// a file Google flagged as abusive.
+func (s *Server) streamAcknowledgingAbuse(ctx context.Context, fileID string, w io.Writer) (int64, error) {
+	resp, err := s.driveService.Files.Get(fileID).Context(ctx).SupportsAllDrives(true).AcknowledgeAbuse(true).Download()
+	if err != nil {
+		return 0, fmt.Errorf("unable to download file: %w", err)
+	}
+	defer resp.Body.Close()
+	return io.Copy(w, resp.Body)
+}
+
+// lookupFile fetches the metadata of a single file from Drive, without listing the
+// library. FolderPath is left empty. Returns nil if the file does not exist or is trashed.
+func (s *Server) lookupFile(ctx context.Context, fileID string) (*gdrive.FileInfo, error) {
+	f, err := s.driveService.Files.Get(fileID).
+		Context(ctx).
+		SupportsAllDrives(true).
+		Fields("id, name, mimeType, size, webViewLink, parents, trashed").
+		Do()
+	if err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to get file: %w", err)
+	}
+	if f.Trashed {
+		return nil, nil
+	}
+
+	return &gdrive.FileInfo{
+		ID:          f.Id,
+		Name:        f.Name,
+		MimeType:    f.MimeType,
+		Size:        f.Size,
+		WebViewLink: f.WebViewLink,
+		Parents:     f.Parents,
+	}, nil
+}
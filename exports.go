@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+const (
+	// ExportInterval is how often Google Docs and Sheets are exported to PDF.
+	ExportInterval = 24 * time.Hour
+
+	// exportPace is the minimum delay between two exports, keeping the nightly run
+	// under Drive's per-user rate limits.
+	exportPace = time.Second
+
+	// exportMaxAttempts is the number of attempts per document before it is skipped until the next run.
+	exportMaxAttempts = 3
+
+	// folderMimeType is the MIME type of Drive folders.
+	folderMimeType = "application/vnd.google-apps.folder"
+)
+
+// exportSourceTypes are the Google-native types exported to PDF every night.
+var exportSourceTypes = []string{
+	"application/vnd.google-apps.document",
+	"application/vnd.google-apps.spreadsheet",
+}
+
+// exportSource is a Google Doc or Sheet to export.
+type exportSource struct {
+	ID           string
+	Name         string
+	ModifiedTime string
+	FolderPath   string // Path below "My Drive", "" for files at the root
+}
+
+// childFolder returns the ID of the folder named name in parentID, creating it if needed.
+func (s *Server) childFolder(ctx context.Context, parentID, name string) (string, error) {
+	escaped := strings.ReplaceAll(strings.ReplaceAll(name, `\`, `\\`), "'", `\'`)
+	list, err := s.driveService.Files.List().
+		Context(ctx).
+		SupportsAllDrives(true).
+		IncludeItemsFromAllDrives(true).
+		Q(fmt.Sprintf("name='%s' and '%s' in parents and mimeType='%s' and trashed=false", escaped, parentID, folderMimeType)).
+		Fields("files(id)").
+		Do()
+	if err != nil {
+		return "", fmt.Errorf("unable to find folder %q: %w", name, err)
+	}
+	if len(list.Files) > 0 {
+		return list.Files[0].Id, nil
+	}
+
+	f, err := s.driveService.Files.Create(&drive.File{
+		Name:     name,
+		MimeType: folderMimeType,
+		Parents:  []string{parentID},
+	}).Context(ctx).SupportsAllDrives(true).Fields("id").Do()
+	if err != nil {
+		return "", fmt.Errorf("unable to create folder %q: %w", name, err)
+	}
+	return f.Id, nil
+}
+
+// exportSources lists the Google Docs and Sheets of the library with their folder paths.
+func (s *Server) exportSources(ctx context.Context) ([]exportSource, error) {
+	paths, err := s.folderPaths(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	clauses := make([]string, len(exportSourceTypes))
+	for i, mimeType := range exportSourceTypes {
+		clauses[i] = "mimeType='" + mimeType + "'"
+	}
+
+	var sources []exportSource
+	err = s.driveService.Files.List().
+		Context(ctx).
+		SupportsAllDrives(true).
+		IncludeItemsFromAllDrives(true).
+		Q("("+strings.Join(clauses, " or ")+") and trashed=false").
+		Fields("nextPageToken, files(id, name, modifiedTime, parents)").
+		PageSize(1000).
+		Pages(ctx, func(r *drive.FileList) error {
+			for _, f := range r.Files {
+				var folderPath string
+				if len(f.Parents) > 0 {
+					folderPath = strings.TrimPrefix(strings.TrimPrefix(paths[f.Parents[0]], "My Drive"), "/")
+				}
+				sources = append(sources, exportSource{ID: f.Id, Name: f.Name, ModifiedTime: f.ModifiedTime, FolderPath: folderPath})
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list documents: %w", err)
+	}
+	return sources, nil
+}
+
+// exportToPDF exports a document to PDF, replacing the content of its previous export
+// (keeping the exported file's ID and links) or creating it in folderID.
+func (s *Server) exportToPDF(ctx context.Context, src exportSource, exportID, folderID string) (string, error) {
+	resp, err := s.driveService.Files.Export(src.ID, string(exportFormats["pdf"])).Context(ctx).Download()
+	if err != nil {
+		return "", fmt.Errorf("unable to export %s: %w", src.ID, err)
+	}
+	defer resp.Body.Close()
+
+	var f *drive.File
+	if exportID != "" {
+		f, err = s.driveService.Files.Update(exportID, &drive.File{}).Context(ctx).SupportsAllDrives(true).Media(resp.Body).Fields("id").Do()
+	} else {
+		f, err = s.driveService.Files.Create(&drive.File{
+			Name:     src.Name + exportExtension(exportFormats["pdf"]),
+			MimeType: string(exportFormats["pdf"]),
+			Parents:  []string{folderID},
+		}).Context(ctx).SupportsAllDrives(true).Media(resp.Body).Fields("id").Do()
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to upload export of %s: %w", src.ID, err)
+	}
+	return f.Id, nil
+}
+
+// exportWorkspaceDocs is the nightly export job. It exports every Google Doc and Sheet
+// to PDF into the exports folder, mirroring the library's folder structure. Documents
+// not modified since their last export are skipped, and exports are paced and retried
+// with backoff when Drive rate-limits them.
+func (s *Server) exportWorkspaceDocs(ctx context.Context) error {
+	if s.cfg.ExportsFolder == "" {
+		return nil
+	}
+
+	sources, err := s.exportSources(ctx)
+	if err != nil {
+		return err
+	}
+
+	rootID, err := s.childFolder(ctx, "root", s.cfg.ExportsFolder)
+	if err != nil {
+		return err
+	}
+	folders := map[string]string{"": rootID}
+
+	// folderFor returns the export folder mirroring a library folder path
+	var folderFor func(folderPath string) (string, error)
+	folderFor = func(folderPath string) (string, error) {
+		if id, ok := folders[folderPath]; ok {
+			return id, nil
+		}
+		parentPath, name := "", folderPath
+		if i := strings.LastIndex(folderPath, "/"); i >= 0 {
+			parentPath, name = folderPath[:i], folderPath[i+1:]
+		}
+		parentID, err := folderFor(parentPath)
+		if err != nil {
+			return "", err
+		}
+		id, err := s.childFolder(ctx, parentID, name)
+		if err != nil {
+			return "", err
+		}
+		folders[folderPath] = id
+		return id, nil
+	}
+
+	pace := time.NewTicker(exportPace)
+	defer pace.Stop()
+
+	var exported, failed int
+	for _, src := range sources {
+		var exportID, modifiedTime string
+		err := s.db.QueryRowContext(ctx,
+			"SELECT export_id, modified_time FROM workspace_exports WHERE file_id = ?", src.ID,
+		).Scan(&exportID, &modifiedTime)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if modifiedTime == src.ModifiedTime {
+			continue
+		}
+
+		folderID, err := folderFor(src.FolderPath)
+		if err != nil {
+			return err
+		}
+
+		backoff := 2 * time.Second
+		for attempt := 1; ; attempt++ {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-pace.C:
+			}
+
+			var id string
+			if id, err = s.exportToPDF(ctx, src, exportID, folderID); err == nil {
+				exportID = id
+				break
+			}
+			if !retryableDriveError(err) || attempt == exportMaxAttempts {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		if err != nil {
+			// Files over Drive's export size limit fail every night; they are reported, not fatal
+			logf(ctx, "Warning: %v", err)
+			failed++
+			continue
+		}
+
+		_, err = s.execWrite(ctx, `
+			INSERT INTO workspace_exports (file_id, export_id, modified_time, exported_at)
+			VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(file_id) DO UPDATE SET
+				export_id = excluded.export_id,
+				modified_time = excluded.modified_time,
+				exported_at = excluded.exported_at
+		`, src.ID, exportID, src.ModifiedTime)
+		if err != nil {
+			return fmt.Errorf("unable to record export: %w", err)
+		}
+		exported++
+	}
+
+	if exported > 0 {
+		logf(ctx, "Exported %d documents to PDF", exported)
+		if err := s.invalidateCache(ctx); err != nil {
+			logf(ctx, "Warning: Failed to invalidate cache: %v", err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d documents could not be exported", failed, exported+failed)
+	}
+	return nil
+}
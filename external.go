@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/abiiranathan/gdrive"
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// externalAccessKeyPrefix prefixes the Redis keys caching whether external files may be served.
+	externalAccessKeyPrefix = "gdrive:external:access:"
+
+	// externalAccessTTL is how long the access check of an external file is cached.
+	externalAccessTTL = 5 * time.Minute
+)
+
+// drivePathID matches the file ID in the path of Drive and Docs sharing URLs, such as
+// /file/d/<id>/view or /document/d/<id>/edit.
+var drivePathID = regexp.MustCompile(`/d/([A-Za-z0-9_-]+)`)
+
+// ExternalLinkRequest represents a request to add a public Drive link to the library.
+type ExternalLinkRequest struct {
+	URL string `json:"url" validate:"required,max=2000"`
+}
+
+// ExternalFile is a file outside the managed folder, added by its public sharing link
+// and served through the server.
+type ExternalFile struct {
+	FileID    string    `json:"file_id"`
+	Name      string    `json:"name"`
+	MimeType  string    `json:"mime_type"`
+	Size      int64     `json:"size"`
+	SourceURL string    `json:"source_url"`
+	AddedBy   int64     `json:"added_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// parseDriveLink extracts the file ID from a Drive or Docs sharing URL. Links of the
+// form /open?id=<id> and /uc?id=<id> are recognized as well.
+func parseDriveLink(raw string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Scheme != "https" {
+		return "", false
+	}
+	if u.Host != "drive.google.com" && u.Host != "docs.google.com" {
+		return "", false
+	}
+
+	id := u.Query().Get("id")
+	if m := drivePathID.FindStringSubmatch(u.Path); m != nil {
+		id = m[1]
+	}
+	return id, driveIDPattern.MatchString(id)
+}
+
+// isPublicFile reports whether anyone with the link may read a file. The permissions
+// of files the service account can share are listed; files it can only read do not
+// expose their permissions, so their sharing link is opened anonymously instead.
+func (s *Server) isPublicFile(ctx context.Context, file *gdrive.FileInfo) (bool, error) {
+	perms, err := s.driveService.Permissions.List(file.ID).
+		Context(ctx).
+		SupportsAllDrives(true).
+		Fields("permissions(type)").
+		Do()
+	if err == nil {
+		for _, p := range perms.Permissions {
+			if p.Type == "anyone" {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusForbidden {
+		return false, fmt.Errorf("unable to list permissions: %w", err)
+	}
+	return checkLink(ctx, file.WebViewLink) == "", nil
+}
+
+// findExternalFile returns the external file with the given ID, or nil if it was never added.
+func (s *Server) findExternalFile(ctx context.Context, fileID string) (*ExternalFile, error) {
+	var f ExternalFile
+	err := s.db.QueryRowContext(ctx, `
+		SELECT file_id, name, mime_type, size, source_url, added_by, created_at
+		FROM external_files WHERE file_id = ?
+	`, fileID).Scan(&f.FileID, &f.Name, &f.MimeType, &f.Size, &f.SourceURL, &f.AddedBy, &f.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// handleListExternalFiles handles GET /api/external - returns the files added by their
+// public links, newest first.
+func (s *Server) handleListExternalFiles(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.QueryContext(r.Context(), `
+		SELECT file_id, name, mime_type, size, source_url, added_by, created_at
+		FROM external_files
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	files := make([]ExternalFile, 0)
+	for rows.Next() {
+		var f ExternalFile
+		if err := rows.Scan(&f.FileID, &f.Name, &f.MimeType, &f.Size, &f.SourceURL, &f.AddedBy, &f.CreatedAt); err != nil {
+			continue
+		}
+		files = append(files, f)
+	}
+
+	if rows.Err() != nil {
+		writeError(w, http.StatusInternalServerError, rows.Err().Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"files": files,
+		"count": len(files),
+	})
+}
+
+// handleAddExternalFile handles POST /api/external - adds a file outside the managed
+// folder by its Drive sharing URL. The file's metadata is fetched once and stored, so
+// the link is listed and served like a library file. Only files shared with anyone
+// holding the link can be added; library files, hidden files and files whose owner
+// disabled downloads are refused.
+func (s *Server) handleAddExternalFile(w http.ResponseWriter, r *http.Request) {
+	var req ExternalLinkRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+	user := userFromContext(ctx)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "sign in to add links")
+		return
+	}
+
+	fileID, ok := parseDriveLink(req.URL)
+	if !ok {
+		writeValidationError(w, FieldError{Field: "url", Message: "must be a Google Drive or Docs sharing link"})
+		return
+	}
+
+	existing, err := s.findExternalFile(ctx, fileID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if existing != nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(existing)
+		return
+	}
+
+	file, err := s.lookupFile(ctx, fileID)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	if file == nil {
+		writeError(w, http.StatusNotFound, "file not found or not shared publicly")
+		return
+	}
+	if file.MimeType == folderMimeType {
+		writeError(w, http.StatusUnprocessableEntity, "folders cannot be added")
+		return
+	}
+
+	// Only links anyone could open are proxied, never files the service account reads privately
+	if listed, err := s.findFile(ctx, fileID); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if listed != nil {
+		writeError(w, http.StatusConflict, "file is already in the library")
+		return
+	}
+	if hidden, err := s.isHidden(ctx, fileID); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if hidden {
+		writeError(w, http.StatusNotFound, "file not found or not shared publicly")
+		return
+	}
+	if public, err := s.isPublicFile(ctx, file); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	} else if !public {
+		writeError(w, http.StatusNotFound, "file not found or not shared publicly")
+		return
+	}
+	if allowed, err := s.downloadAllowed(ctx, fileID); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	} else if !allowed {
+		writeError(w, http.StatusForbidden, "the owner of this file has disabled downloads")
+		return
+	}
+
+	added := ExternalFile{
+		FileID:    file.ID,
+		Name:      file.Name,
+		MimeType:  file.MimeType,
+		Size:      file.Size,
+		SourceURL: req.URL,
+		AddedBy:   user.ID,
+		CreatedAt: time.Now(),
+	}
+	_, err = s.execWrite(ctx, `
+		INSERT INTO external_files (file_id, name, mime_type, size, source_url, added_by)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, added.FileID, added.Name, added.MimeType, added.Size, added.SourceURL, added.AddedBy)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	logf(ctx, "User %d added external file %s (%s)", user.ID, added.FileID, added.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(added)
+}
+
+// externalAccess checks that an external file still exists, is shared publicly and may
+// be downloaded. It returns 0 if so, or the status to refuse the download with. Results
+// are cached in Redis for externalAccessTTL, so unsharing a file takes effect within
+// minutes without three Drive calls on every download.
+func (s *Server) externalAccess(ctx context.Context, fileID string) (int, error) {
+	key := externalAccessKeyPrefix + fileID
+	if status, err := s.redis.Get(ctx, key).Int(); err == nil {
+		return status, nil
+	}
+
+	status := 0
+	current, err := s.lookupFile(ctx, fileID)
+	if err != nil {
+		return 0, err
+	}
+	if current == nil {
+		status = http.StatusGone
+	} else if public, err := s.isPublicFile(ctx, current); err != nil {
+		return 0, err
+	} else if !public {
+		status = http.StatusGone
+	} else if allowed, err := s.downloadAllowed(ctx, fileID); err != nil {
+		return 0, err
+	} else if !allowed {
+		status = http.StatusForbidden
+	}
+
+	if err := s.redis.Set(ctx, key, status, externalAccessTTL).Err(); err != nil {
+		logf(ctx, "Warning: Failed to cache access to external file %s: %v", fileID, err)
+	}
+	return status, nil
+}
+
+// handleDownloadExternalFile handles GET /api/external/:id/download - streams an added
+// external file through the server, logged and counted against quotas like library
+// downloads. Files that were not added, are hidden, or are no longer shared publicly
+// are not served; see externalAccess.
+func (s *Server) handleDownloadExternalFile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	file, err := s.findExternalFile(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if file == nil {
+		writeError(w, http.StatusNotFound, "external file not found")
+		return
+	}
+
+	if hidden, err := s.isHidden(ctx, file.FileID); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if hidden {
+		writeError(w, http.StatusNotFound, "external file not found")
+		return
+	}
+
+	switch status, err := s.externalAccess(ctx, file.FileID); {
+	case err != nil:
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	case status == http.StatusGone:
+		writeError(w, status, "file is no longer shared publicly")
+		return
+	case status == http.StatusForbidden:
+		writeError(w, status, "the owner of this file has disabled downloads")
+		return
+	}
+
+	s.serveDownload(w, r, file.FileID, "", file.Name, "", file.MimeType, file.Size)
+}
+
+// handleRemoveExternalFile handles DELETE /api/admin/external/:id - removes an external
+// file from the library. The file itself is not changed.
+func (s *Server) handleRemoveExternalFile(w http.ResponseWriter, r *http.Request) {
+	fileID := chi.URLParam(r, "id")
+	res, err := s.execWrite(r.Context(), "DELETE FROM external_files WHERE file_id = ?", fileID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, http.StatusNotFound, "external file not found")
+		return
+	}
+
+	s.audit(r, "external.remove", fileID, "")
+	if err := s.redis.Del(r.Context(), externalAccessKeyPrefix+fileID).Err(); err != nil {
+		logf(r.Context(), "Warning: Failed to drop cached access to external file %s: %v", fileID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "external file removed"})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// FolderStatsQuery holds the query parameters of GET /api/stats/folders.
+type FolderStatsQuery struct {
+	Days   int    `query:"days" validate:"min=1,max=366"`
+	Bucket string `query:"bucket" validate:"oneof=day week"`
+}
+
+// FolderActivity is a heatmap row: the downloads of a folder per time bucket.
+type FolderActivity struct {
+	Folder string `json:"folder"` // Empty for the library root and downloads recorded before folders were
+	Total  int    `json:"total"`
+	Counts []int  `json:"counts"` // One count per bucket, oldest first
+}
+
+// bucketStart truncates t to the start of its day, or its week starting on Monday.
+func bucketStart(t time.Time, bucket string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if bucket == "week" {
+		day = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+	return day
+}
+
+// handleFolderStats handles GET /api/stats/folders?days=&bucket=day|week - returns the
+// downloads of every folder over time, for a heatmap. Folders are recorded at download
+// time, so moved files stay counted where they were read.
+func (s *Server) handleFolderStats(w http.ResponseWriter, r *http.Request) {
+	q := FolderStatsQuery{Days: 30, Bucket: "day"}
+	if !decodeQuery(w, r, &q) {
+		return
+	}
+
+	now := time.Now().UTC()
+	first := bucketStart(now.AddDate(0, 0, -(q.Days-1)), q.Bucket)
+	step := func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	if q.Bucket == "week" {
+		step = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	}
+
+	buckets := make([]string, 0)
+	index := make(map[time.Time]int)
+	for t := first; !t.After(now); t = step(t) {
+		index[t] = len(buckets)
+		buckets = append(buckets, t.Format(time.DateOnly))
+	}
+
+	rows, err := s.db.QueryContext(r.Context(), `
+		SELECT folder_path, DATE(downloaded_at), COUNT(*)
+		FROM downloads
+		WHERE downloaded_at >= ?
+		GROUP BY folder_path, DATE(downloaded_at)
+	`, first.Format(time.DateTime))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	byFolder := make(map[string]*FolderActivity)
+	for rows.Next() {
+		var folder, date string
+		var count int
+		if err := rows.Scan(&folder, &date, &count); err != nil {
+			continue
+		}
+		day, err := time.Parse(time.DateOnly, date)
+		if err != nil {
+			continue
+		}
+		i, ok := index[bucketStart(day, q.Bucket)]
+		if !ok {
+			continue
+		}
+
+		activity := byFolder[folder]
+		if activity == nil {
+			activity = &FolderActivity{Folder: folder, Counts: make([]int, len(buckets))}
+			byFolder[folder] = activity
+		}
+		activity.Counts[i] += count
+		activity.Total += count
+	}
+
+	if rows.Err() != nil {
+		writeError(w, http.StatusInternalServerError, rows.Err().Error())
+		return
+	}
+
+	folders := make([]FolderActivity, 0, len(byFolder))
+	for _, activity := range byFolder {
+		folders = append(folders, *activity)
+	}
+	slices.SortFunc(folders, func(a, b FolderActivity) int {
+		return cmp.Or(cmp.Compare(b.Total, a.Total), cmp.Compare(a.Folder, b.Folder))
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"bucket":  q.Bucket,
+		"buckets": buckets,
+		"folders": folders,
+		"count":   len(folders),
+	})
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// DefaultHLSCacheDir is the directory where transcoded HLS renditions are stored.
+const DefaultHLSCacheDir = "hls-cache"
+
+// hlsPlaylistName is the name of the playlist written for every transcoded video.
+const hlsPlaylistName = "playlist.m3u8"
+
+const (
+	// maxTranscodes bounds the number of ffmpeg processes running at once.
+	maxTranscodes = 2
+
+	// transcodeTimeout bounds the download and transcode of a single video.
+	transcodeTimeout = 30 * time.Minute
+)
+
+// errTranscoderBusy is returned by hlsTranscoder.start when every transcode slot is taken.
+var errTranscoderBusy = errors.New("too many transcodes in progress")
+
+var (
+	// driveIDPattern matches valid Drive file IDs, which are safe to use in local paths.
+	driveIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+	// hlsSegmentPattern matches the segment names written by the transcoder.
+	hlsSegmentPattern = regexp.MustCompile(`^seg[0-9]{5}\.ts$`)
+)
+
+// hlsTranscoder converts Drive-hosted videos into HLS renditions using ffmpeg
+// and caches them on local disk. At most one transcode runs per file, and at most
+// maxTranscodes run in total.
+type hlsTranscoder struct {
+	ffmpegPath string
+	cacheDir   string
+
+	ctx    context.Context // Cancelled by close, stopping running transcodes
+	cancel context.CancelFunc
+	slots  chan struct{}
+
+	mu     sync.Mutex
+	active map[string]bool  // Files currently being transcoded
+	failed map[string]error // Last transcode error per file
+}
+
+// newHLSTranscoder creates a transcoder. Returns nil if ffmpegPath is empty,
+// which disables HLS support.
+func newHLSTranscoder(ffmpegPath, cacheDir string) *hlsTranscoder {
+	if ffmpegPath == "" {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &hlsTranscoder{
+		ffmpegPath: ffmpegPath,
+		cacheDir:   cacheDir,
+		ctx:        ctx,
+		cancel:     cancel,
+		slots:      make(chan struct{}, maxTranscodes),
+		active:     make(map[string]bool),
+		failed:     make(map[string]error),
+	}
+}
+
+// close stops running transcodes. Their partial output is discarded.
+func (t *hlsTranscoder) close() {
+	t.cancel()
+}
+
+// dir returns the cache directory holding the rendition of fileID.
+func (t *hlsTranscoder) dir(fileID string) string {
+	return filepath.Join(t.cacheDir, fileID)
+}
+
+// evict removes the cached rendition of fileID, after its content was replaced.
+func (t *hlsTranscoder) evict(fileID string) error {
+	return os.RemoveAll(t.dir(fileID))
+}
+
+// ready reports whether a complete rendition of fileID is cached.
+func (t *hlsTranscoder) ready(fileID string) bool {
+	_, err := os.Stat(filepath.Join(t.dir(fileID), hlsPlaylistName))
+	return err == nil
+}
+
+// start begins transcoding fileID in the background unless it is already running.
+// Returns the error of the previous attempt, if it failed, or errTranscoderBusy if no
+// transcode slot is free.
+func (t *hlsTranscoder) start(s *Server, fileID string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err, failed := t.failed[fileID]; failed {
+		delete(t.failed, fileID)
+		return err
+	}
+
+	if t.active[fileID] {
+		return nil
+	}
+	select {
+	case t.slots <- struct{}{}:
+	default:
+		return errTranscoderBusy
+	}
+	t.active[fileID] = true
+
+	go func() {
+		ctx, cancel := context.WithTimeout(t.ctx, transcodeTimeout)
+		err := t.transcode(ctx, s, fileID)
+		cancel()
+		<-t.slots
+
+		t.mu.Lock()
+		delete(t.active, fileID)
+		if err != nil {
+			t.failed[fileID] = err
+		}
+		t.mu.Unlock()
+
+		if err != nil {
+			log.Printf("HLS transcode of %s failed: %v", fileID, err)
+			return
+		}
+		log.Printf("HLS transcode of %s completed", fileID)
+	}()
+	return nil
+}
+
+// transcode downloads fileID to a temporary file and converts it to HLS.
+// Output is written to a temporary directory that is renamed into place on
+// success, so a partially transcoded rendition is never served.
+func (t *hlsTranscoder) transcode(ctx context.Context, s *Server, fileID string) error {
+	if err := os.MkdirAll(t.cacheDir, 0755); err != nil {
+		return fmt.Errorf("unable to create cache directory: %w", err)
+	}
+
+	work, err := os.MkdirTemp(t.cacheDir, fileID+".tmp-")
+	if err != nil {
+		return fmt.Errorf("unable to create work directory: %w", err)
+	}
+	defer os.RemoveAll(work)
+
+	src, err := os.Create(filepath.Join(work, "source"))
+	if err != nil {
+		return fmt.Errorf("unable to create source file: %w", err)
+	}
+
+	_, err = s.driveClient.StreamFile(ctx, fileID, src)
+	src.Close()
+	if err != nil {
+		return err
+	}
+
+	out := filepath.Join(work, "out")
+	if err := os.Mkdir(out, 0755); err != nil {
+		return fmt.Errorf("unable to create output directory: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, t.ffmpegPath,
+		"-hide_banner", "-loglevel", "error",
+		"-i", src.Name(),
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23",
+		"-c:a", "aac", "-b:a", "128k",
+		"-f", "hls",
+		"-hls_time", "6",
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(out, "seg%05d.ts"),
+		filepath.Join(out, hlsPlaylistName),
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, output)
+	}
+
+	return os.Rename(out, t.dir(fileID))
+}
+
+// handleHLSPlaylist handles GET /api/files/:id/hls/playlist.m3u8 - serves the HLS playlist
+// of a video, starting a transcode and responding 202 while it is not yet available.
+func (s *Server) handleHLSPlaylist(w http.ResponseWriter, r *http.Request) {
+	if s.hls == nil {
+		writeError(w, http.StatusNotImplemented, "HLS transcoding is not enabled")
+		return
+	}
+
+	fileID := chi.URLParam(r, "id")
+	if !driveIDPattern.MatchString(fileID) {
+		writeError(w, http.StatusBadRequest, "invalid file ID")
+		return
+	}
+
+	// Cached renditions outlive the file in the library, so it is looked up every time
+	file, err := s.findFile(r.Context(), fileID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if file == nil {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	if classifyMimeType(file.MimeType) != ViewVideo {
+		writeError(w, http.StatusUnprocessableEntity, "file is not a video")
+		return
+	}
+
+	if s.hls.ready(fileID) {
+		// Players fetch the playlist once per playback, so it is counted as the download
+		if !s.authorizePlayback(w, r, file) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		http.ServeFile(w, r, filepath.Join(s.hls.dir(fileID), hlsPlaylistName))
+		return
+	}
+
+	if !s.checkServable(w, r, fileID) {
+		return
+	}
+
+	if err := s.hls.start(s, fileID); errors.Is(err, errTranscoderBusy) {
+		w.Header().Set("Retry-After", "30")
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("transcoding failed: %v", err))
+		return
+	}
+
+	w.Header().Set("Retry-After", "10")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "transcoding in progress"})
+}
+
+// handleHLSSegment handles GET /api/files/:id/hls/:segment - serves a transcoded media
+// segment of a file that is still in the library and may be served.
+func (s *Server) handleHLSSegment(w http.ResponseWriter, r *http.Request) {
+	if s.hls == nil {
+		writeError(w, http.StatusNotImplemented, "HLS transcoding is not enabled")
+		return
+	}
+
+	fileID := chi.URLParam(r, "id")
+	segment := chi.URLParam(r, "segment")
+	if !driveIDPattern.MatchString(fileID) || !hlsSegmentPattern.MatchString(segment) {
+		writeError(w, http.StatusBadRequest, "invalid segment")
+		return
+	}
+
+	file, err := s.findFile(r.Context(), fileID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if file == nil {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	if !s.checkServable(w, r, fileID) {
+		return
+	}
+
+	path := filepath.Join(s.hls.dir(fileID), segment)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		writeError(w, http.StatusNotFound, "segment not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "video/mp2t")
+	http.ServeFile(w, r, path)
+}
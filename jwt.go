@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultJWTTTL is the lifetime of issued API tokens when JWT_TTL is not set.
+const DefaultJWTTTL = time.Hour
+
+// API token scopes. Session and admin requests implicitly hold every scope.
+const (
+	ScopeRead     = "library:read"     // Browse the listing, views, bookmarks and stats
+	ScopeDownload = "library:download" // Download and stream file content
+)
+
+// allScopes lists the scopes an API token may be issued with.
+var allScopes = []string{ScopeRead, ScopeDownload}
+
+// errInvalidJWT is returned for malformed, tampered or expired API tokens.
+var errInvalidJWT = errors.New("invalid or expired token")
+
+// jwtHeader is the fixed, pre-encoded JOSE header of issued tokens.
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// TokenClaims are the claims of an API token.
+type TokenClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"` // User ID
+	Email     string `json:"email"`
+	Scope     string `json:"scope"` // Space-separated scopes
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// TokenRequest represents an API token request. Either Email and Password
+// (for a password provider) or Assertion (an OIDC ID token) must be given.
+type TokenRequest struct {
+	Provider  string   `json:"provider"` // Defaults to the local provider
+	Email     string   `json:"email"`
+	Password  string   `json:"password"`
+	Assertion string   `json:"assertion"`
+	Scopes    []string `json:"scopes"` // Defaults to all scopes
+}
+
+// scopesContextKey is the context key under which the scopes of an API token are stored.
+type scopesContextKey struct{}
+
+// signJWT returns an HS256-signed JWT carrying claims.
+func (s *Server) signJWT(claims TokenClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + s.jwtSignature(signed), nil
+}
+
+// parseJWT verifies a JWT's signature, issuer and expiry and returns its claims.
+func (s *Server) parseJWT(token string) (*TokenClaims, error) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 || strings.Count(token, ".") != 2 {
+		return nil, errInvalidJWT
+	}
+
+	signed, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(s.jwtSignature(signed))) {
+		return nil, errInvalidJWT
+	}
+
+	// Only our own header is accepted, which rules out algorithm confusion
+	header, payload, _ := strings.Cut(signed, ".")
+	if header != jwtHeader {
+		return nil, errInvalidJWT
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errInvalidJWT
+	}
+
+	var claims TokenClaims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, errInvalidJWT
+	}
+
+	if claims.Issuer != s.cfg.PublicURL || time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errInvalidJWT
+	}
+	return &claims, nil
+}
+
+// jwtSignature returns the base64url HMAC-SHA256 of the signing input.
+func (s *Server) jwtSignature(signed string) string {
+	mac := hmac.New(sha256.New, []byte(s.cfg.JWTSecret))
+	mac.Write([]byte(signed))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// bearerJWT returns the bearer token of the request if it is shaped like a JWT,
+// which tells it apart from the opaque admin token.
+func bearerJWT(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || strings.Count(token, ".") != 2 {
+		return "", false
+	}
+	return token, true
+}
+
+// loadToken is middleware that authenticates requests carrying an API token
+// and stores the user and granted scopes in the request context. Requests
+// presenting an invalid or expired token are rejected.
+func (s *Server) loadToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerJWT(r)
+		if !ok || s.isAdmin(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		claims, err := s.parseJWT(token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, errInvalidJWT.Error())
+			return
+		}
+
+		ctx := r.Context()
+		user, err := s.getUser(ctx, userID)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, "user no longer exists")
+			return
+		}
+
+		ctx = context.WithValue(ctx, userContextKey{}, user)
+		ctx = context.WithValue(ctx, scopesContextKey{}, strings.Fields(claims.Scope))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// hasScope reports whether the request is authenticated with the given scope.
+// Session and admin credentials carry every scope.
+func (s *Server) hasScope(r *http.Request, scope string) bool {
+	if !s.isAuthenticated(r) {
+		return false
+	}
+	scopes, isToken := r.Context().Value(scopesContextKey{}).([]string)
+	return !isToken || slices.Contains(scopes, scope)
+}
+
+// handleIssueToken handles POST /api/auth/token - exchanges credentials or an
+// OIDC ID token for a signed API token.
+func (s *Server) handleIssueToken(w http.ResponseWriter, r *http.Request) {
+	var req TokenRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.Provider == "" {
+		req.Provider = localProviderName
+	}
+
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = allScopes
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(allScopes, scope) {
+			writeValidationError(w, FieldError{Field: "scopes", Message: "unknown scope: " + scope})
+			return
+		}
+	}
+
+	ctx := r.Context()
+	var identity *Identity
+	var err error
+	switch p := s.authProviders[req.Provider].(type) {
+	case PasswordProvider:
+		identity, err = p.Authenticate(ctx, req.Email, req.Password)
+	case AssertionProvider:
+		if req.Assertion == "" {
+			writeValidationError(w, FieldError{Field: "assertion", Message: "is required"})
+			return
+		}
+		identity, err = p.VerifyAssertion(ctx, req.Assertion)
+	default:
+		writeValidationError(w, FieldError{Field: "provider", Message: "unknown auth provider"})
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	user, err := s.resolveUser(ctx, req.Provider, identity)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	now := time.Now()
+	expires := now.Add(s.cfg.JWTTTL)
+	token, err := s.signJWT(TokenClaims{
+		Issuer:    s.cfg.PublicURL,
+		Subject:   strconv.FormatInt(user.ID, 10),
+		Email:     user.Email,
+		Scope:     strings.Join(scopes, " "),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expires.Unix(),
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(s.cfg.JWTTTL.Seconds()),
+		"expires_at":   expires.Format(time.RFC3339),
+		"scope":        strings.Join(scopes, " "),
+	})
+}
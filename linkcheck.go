@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+const (
+	// LinkCheckInterval is how often the links of publicly shared files are verified.
+	LinkCheckInterval = 24 * time.Hour
+
+	// linkCheckConcurrency bounds the number of concurrent link checks.
+	linkCheckConcurrency = 4
+)
+
+// linkClient requests links without credentials and without following redirects,
+// so that a redirect to the Google sign-in page can be told apart from a public file.
+var linkClient = &http.Client{
+	Timeout: 30 * time.Second,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// PublicLink is the most recent check of a publicly shared file's link.
+type PublicLink struct {
+	FileID      string    `json:"file_id"`
+	FileName    string    `json:"file_name"`
+	WebViewLink string    `json:"web_view_link"`
+	Status      string    `json:"status"` // ok or broken
+	Reason      string    `json:"reason,omitempty"`
+	CheckedAt   time.Time `json:"checked_at"`
+	BrokenSince time.Time `json:"broken_since,omitzero"`
+}
+
+// PublicLinksQuery holds the query parameters of GET /api/admin/links.
+type PublicLinksQuery struct {
+	Status string `query:"status" validate:"oneof=broken ok all"`
+}
+
+// checkLink requests a link anonymously and returns why it is broken, or "" when
+// it can be opened without signing in.
+func checkLink(ctx context.Context, link string) string {
+	if link == "" {
+		return "file has no link"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, link, nil)
+	if err != nil {
+		return err.Error()
+	}
+
+	resp, err := linkClient.Do(req)
+	if err != nil {
+		return err.Error()
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		location, err := url.Parse(resp.Header.Get("Location"))
+		if err == nil && strings.HasPrefix(location.Host, "accounts.google.") {
+			return "link requires sign-in"
+		}
+	case resp.StatusCode >= 400:
+		return fmt.Sprintf("link returned %s", resp.Status)
+	}
+	return ""
+}
+
+// publicFiles lists the files shared with anyone who has the link.
+func (s *Server) publicFiles(ctx context.Context) ([]*drive.File, error) {
+	var files []*drive.File
+	err := s.driveService.Files.List().
+		Context(ctx).
+		Q("(visibility='anyoneWithLink' or visibility='anyoneCanFind') and trashed=false").
+		Fields("nextPageToken, files(id, name, webViewLink)").
+		PageSize(1000).
+		Pages(ctx, func(r *drive.FileList) error {
+			files = append(files, r.Files...)
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list public files: %w", err)
+	}
+	return files, nil
+}
+
+// checkPublicLinks verifies that every publicly shared file opens without signing in,
+// including files that were public at the previous check. Files whose public permission
+// was removed, or whose link now requires sign-in, are recorded as broken.
+func (s *Server) checkPublicLinks(ctx context.Context) error {
+	files, err := s.publicFiles(ctx)
+	if err != nil {
+		return err
+	}
+
+	public := make(map[string]bool, len(files))
+	for _, f := range files {
+		public[f.Id] = true
+	}
+
+	// Files that were public at the previous check but are no longer listed as public
+	rows, err := s.db.QueryContext(ctx, "SELECT file_id, file_name, web_view_link FROM public_links WHERE status = 'ok'")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var f drive.File
+		if err := rows.Scan(&f.Id, &f.Name, &f.WebViewLink); err != nil {
+			continue
+		}
+		if !public[f.Id] {
+			files = append(files, &f)
+		}
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+
+	reasons := make([]string, len(files))
+	sem := make(chan struct{}, linkCheckConcurrency)
+	var wg sync.WaitGroup
+	for i, f := range files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			reasons[i] = checkLink(ctx, f.WebViewLink)
+		}()
+	}
+	wg.Wait()
+
+	broken := 0
+	for i, f := range files {
+		status, reason := "ok", reasons[i]
+		if !public[f.Id] {
+			reason = "no longer shared publicly"
+		}
+		if reason != "" {
+			status = "broken"
+			broken++
+		}
+
+		_, err := s.execWrite(ctx, `
+			INSERT INTO public_links (file_id, file_name, web_view_link, status, reason, checked_at, broken_since)
+			VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CASE WHEN ? = 'broken' THEN CURRENT_TIMESTAMP END)
+			ON CONFLICT(file_id) DO UPDATE SET
+				file_name = excluded.file_name,
+				web_view_link = excluded.web_view_link,
+				status = excluded.status,
+				reason = excluded.reason,
+				checked_at = excluded.checked_at,
+				broken_since = CASE
+					WHEN excluded.status = 'ok' THEN NULL
+					ELSE COALESCE(public_links.broken_since, excluded.broken_since)
+				END
+		`, f.Id, f.Name, f.WebViewLink, status, reason, status)
+		if err != nil {
+			return fmt.Errorf("unable to record link check: %w", err)
+		}
+	}
+
+	if broken > 0 {
+		logf(ctx, "Warning: %d publicly shared files have broken links", broken)
+	}
+	return nil
+}
+
+// handleListPublicLinks handles GET /api/admin/links - returns the publicly shared files
+// whose links stopped working (status=broken, the default), work (ok) or all of them.
+func (s *Server) handleListPublicLinks(w http.ResponseWriter, r *http.Request) {
+	q := PublicLinksQuery{Status: "broken"}
+	if !decodeQuery(w, r, &q) {
+		return
+	}
+
+	rows, err := s.db.QueryContext(r.Context(), `
+		SELECT file_id, file_name, web_view_link, status, reason, checked_at, broken_since
+		FROM public_links
+		WHERE ? = 'all' OR status = ?
+		ORDER BY status, file_name
+	`, q.Status, q.Status)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	links := make([]PublicLink, 0)
+	for rows.Next() {
+		var l PublicLink
+		var brokenSince sql.NullTime
+		if err := rows.Scan(&l.FileID, &l.FileName, &l.WebViewLink, &l.Status, &l.Reason, &l.CheckedAt, &brokenSince); err != nil {
+			continue
+		}
+		l.BrokenSince = brokenSince.Time
+		links = append(links, l)
+	}
+
+	if rows.Err() != nil {
+		writeError(w, http.StatusInternalServerError, rows.Err().Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"links": links,
+		"count": len(links),
+	})
+}
+
+// handleCheckPublicLinks handles POST /api/admin/links/check - runs the link check now.
+func (s *Server) handleCheckPublicLinks(w http.ResponseWriter, r *http.Request) {
+	s.scheduler.RunNow(context.Background(), "link-check")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "link check queued"})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// DefaultSlowRequest is the duration after which a request is logged as slow.
+const DefaultSlowRequest = 5 * time.Second
+
+// redactedParams are the query parameters whose values are never logged.
+var redactedParams = map[string]bool{
+	"access_token": true,
+	"api_key":      true,
+	"code":         true,
+	"key":          true,
+	"password":     true,
+	"secret":       true,
+	"sig":          true,
+	"signature":    true,
+	"state":        true,
+	"token":        true,
+}
+
+// LoggingConfig controls the server log output.
+type LoggingConfig struct {
+	Level       slog.Level    // Minimum level logged
+	JSON        bool          // Log JSON lines instead of key=value text
+	SlowRequest time.Duration // Requests taking longer are logged as warnings; disabled when zero
+}
+
+// loadLoggingConfig reads the logging settings from the environment.
+func loadLoggingConfig() (LoggingConfig, error) {
+	cfg := LoggingConfig{SlowRequest: getEnvDuration("SLOW_REQUEST_THRESHOLD", DefaultSlowRequest)}
+	if err := cfg.Level.UnmarshalText([]byte(getEnv("LOG_LEVEL", "info"))); err != nil {
+		return cfg, fmt.Errorf("invalid log level %q: must be debug, info, warn or error", os.Getenv("LOG_LEVEL"))
+	}
+
+	switch format := getEnv("LOG_FORMAT", "text"); format {
+	case "text":
+	case "json":
+		cfg.JSON = true
+	default:
+		return cfg, fmt.Errorf("invalid log format %q: must be text or json", format)
+	}
+	return cfg, nil
+}
+
+// setupLogging installs the default structured logger. Messages of the log package
+// are routed through it as well.
+func setupLogging(cfg LoggingConfig) {
+	opts := &slog.HandlerOptions{Level: cfg.Level}
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+	if cfg.JSON {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// messageLevel infers the level of a logf message from its conventional prefix.
+func messageLevel(msg string) slog.Level {
+	switch {
+	case strings.HasPrefix(msg, "Warning:"):
+		return slog.LevelWarn
+	case strings.HasPrefix(msg, "Error"), strings.HasPrefix(msg, "Failed"), strings.HasPrefix(msg, "Panic"):
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// redactedPathParams are the route parameters whose values are never logged, such as
+// the token of share links under /s/{token}.
+var redactedPathParams = map[string]bool{
+	"token": true,
+}
+
+// redactPath returns the path of r with the values of sensitive route parameters
+// replaced. It must be called after routing, once the parameters are known.
+func redactPath(r *http.Request) string {
+	path := r.URL.Path
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return path
+	}
+	for i, key := range rctx.URLParams.Keys {
+		if redactedPathParams[key] && rctx.URLParams.Values[i] != "" {
+			path = strings.Replace(path, "/"+rctx.URLParams.Values[i], "/REDACTED", 1)
+		}
+	}
+	return path
+}
+
+// redactQuery returns the encoded query of u with sensitive values replaced.
+func redactQuery(u *url.URL) string {
+	if u.RawQuery == "" {
+		return ""
+	}
+	query := u.Query()
+	for key := range query {
+		if redactedParams[strings.ToLower(key)] {
+			query.Set(key, "REDACTED")
+		}
+	}
+	return query.Encode()
+}
+
+// requestLogger is middleware logging every request as a structured record. Server
+// errors are logged at error level and slow requests at warning level.
+func (s *Server) requestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			elapsed := time.Since(start)
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			level, msg := slog.LevelInfo, "request"
+			switch {
+			case status >= 500:
+				level = slog.LevelError
+			case s.cfg.Logging.SlowRequest > 0 && elapsed > s.cfg.Logging.SlowRequest:
+				level, msg = slog.LevelWarn, "slow request"
+			}
+
+			attrs := []slog.Attr{
+				slog.String("request_id", middleware.GetReqID(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("path", redactPath(r)),
+				slog.Int("status", status),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.Float64("duration_ms", milliseconds(elapsed)),
+				slog.String("remote_addr", r.RemoteAddr),
+				slog.String("user_agent", r.UserAgent()),
+			}
+			if query := redactQuery(r.URL); query != "" {
+				attrs = append(attrs, slog.String("query", query))
+			}
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				attrs = append(attrs, slog.String("route", rctx.RoutePattern()))
+			}
+			slog.LogAttrs(r.Context(), level, msg, attrs...)
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
@@ -4,11 +4,17 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/abiiranathan/gdrive"
@@ -17,8 +23,12 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/joho/godotenv"
-	_ "github.com/mattn/go-sqlite3"
 	"github.com/redis/go-redis/v9"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"golang.org/x/text/language"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/driveactivity/v2"
 )
 
 const (
@@ -38,35 +48,280 @@ const (
 	CacheTimestampKey = "gdrive:files:timestamp"
 )
 
+// Config holds the server configuration loaded from the environment.
+type Config struct {
+	CredentialsPath string           // Path to the service account credentials file
+	DBPath          string           // Path to the SQLite database
+	Storage         StorageConfig    // SQLite connection tuning and write retries
+	Logging         LoggingConfig    // Log level, format and slow request threshold
+	RedisAddr       string           // Redis server address (required)
+	Port            string           // HTTP listen port
+	AdminToken      string           // Bearer token for /api/admin routes; admin routes are disabled when empty
+	RulesPath       string           // Path to the file organization rules (JSON)
+	RefreshInterval time.Duration    // Interval between scheduled library refreshes
+	ChangesInterval time.Duration    // Interval between polls of the Drive Changes API
+	WebhookSecret   string           // Token Drive echoes on push notifications; push notifications are disabled when empty
+	FFmpegPath      string           // Path to ffmpeg; HLS transcoding is disabled when empty
+	HLSCacheDir     string           // Directory for transcoded HLS renditions
+	ConvertPath     string           // Path to calibre's ebook-convert; ebook conversion is disabled when empty
+	ConvertCacheDir string           // Directory for converted ebooks
+	PublicURL       string           // Externally reachable base URL used in share links
+	ShareSecret     string           // HMAC key for signing share links
+	ShareLinkTTL    time.Duration    // Validity of newly issued share links
+	SMTP            SMTPConfig       // Outgoing mail server for digests
+	AccessMode      AccessMode       // Who may browse and download (public, login or private)
+	SessionTTL      time.Duration    // Idle lifetime of login sessions (sliding expiry)
+	OIDCProviders   []OIDCConfig     // External identity providers (Google, generic OIDC)
+	JWTSecret       string           // HMAC key for signing API tokens
+	JWTTTL          time.Duration    // Lifetime of issued API tokens
+	Quota           QuotaConfig      // Per-user daily download limits
+	SpoolDir        string           // Directory for spooling downloads to disk; spooling is disabled when empty
+	SpoolMaxBytes   int64            // Largest file spooled; larger files are streamed directly
+	DirectDownloads DirectMode       // How clients may fetch bytes directly from Google; disabled when empty
+	ListProfile     ListProfile      // Default listing profile of GET /api/files
+	WorkspaceTypes  WorkspaceSet     // Google-native types included in listings, by MIME type
+	ExportsFolder   string           // Drive folder receiving nightly PDF exports of Docs and Sheets; disabled when empty
+	ReportsFolder   string           // Drive folder receiving monthly download reports; disabled when empty
+	Picker          PickerConfig     // Google Picker for choosing files from users' own Drive
+	CollationLocale language.Tag     // Locale whose rules order names in sorted listings
+	QuotaAlert      QuotaAlertConfig // Alerts and housekeeping when Drive storage runs low
+}
+
 // Server represents the web application server.
 type Server struct {
-	driveClient *gdrive.DriveClient
-	db          *sql.DB
-	redis       *redis.Client
+	cfg             Config
+	driveClient     *gdrive.DriveClient
+	driveService    *drive.Service
+	activityService *driveactivity.Service
+	db              *sql.DB
+	redis           *redis.Client
+	rules           []Rule
+	scheduler       *Scheduler
+	metrics         *apiMetrics
+	downloads       *downloadLog
+	hls             *hlsTranscoder  // nil when HLS transcoding is disabled
+	converter       *ebookConverter // nil when ebook conversion is disabled
+	suggest         *suggestIndex
+
+	authProviders map[string]AuthProvider
+	directTokens  oauth2.TokenSource // Read-only service account tokens; nil unless DIRECT_DOWNLOADS=token
 }
 
 // BookmarkRequest represents a bookmark creation request.
 type BookmarkRequest struct {
-	FileID string `json:"file_id"`
-	Notes  string `json:"notes"`
+	FileID string `json:"file_id" validate:"required"`
+	Notes  string `json:"notes" validate:"max=2000"`
+}
+
+// loadConfig reads the server configuration from environment variables,
+// falling back to defaults where a value is not set.
+func loadConfig() (Config, error) {
+	accessMode, err := parseAccessMode(os.Getenv("ACCESS_MODE"))
+	if err != nil {
+		return Config{}, err
+	}
+
+	directMode, err := parseDirectMode(os.Getenv("DIRECT_DOWNLOADS"))
+	if err != nil {
+		return Config{}, err
+	}
+	// Tokens can read everything the service account can, so they are never handed to anonymous users
+	if directMode == DirectToken && accessMode == AccessPublic {
+		return Config{}, fmt.Errorf("DIRECT_DOWNLOADS=%s requires ACCESS_MODE=%s or %s", DirectToken, AccessLogin, AccessPrivate)
+	}
+
+	listProfile, err := parseListProfile(getEnv("LIST_PROFILE", string(ProfileFull)))
+	if err != nil {
+		return Config{}, err
+	}
+
+	workspaceTypes, err := parseWorkspaceTypes(os.Getenv("WORKSPACE_TYPES"))
+	if err != nil {
+		return Config{}, err
+	}
+
+	logging, err := loadLoggingConfig()
+	if err != nil {
+		return Config{}, err
+	}
+
+	quotaAlert, err := loadQuotaAlertConfig()
+	if err != nil {
+		return Config{}, err
+	}
+
+	collationLocale, err := parseCollationLocale(os.Getenv("COLLATION_LOCALE"))
+	if err != nil {
+		return Config{}, err
+	}
+
+	return Config{
+		CredentialsPath: getEnv("CREDENTIALS_PATH", DefaultCredentialsPath),
+		DBPath:          getEnv("DB_PATH", DefaultDBPath),
+		Storage:         loadStorageConfig(),
+		Logging:         logging,
+		RedisAddr:       os.Getenv("REDIS_ADDR"),
+		Port:            getEnv("PORT", "8080"),
+		AdminToken:      os.Getenv("ADMIN_TOKEN"),
+		RulesPath:       getEnv("RULES_PATH", DefaultRulesPath),
+		RefreshInterval: getEnvDuration("REFRESH_INTERVAL", CacheExpiration),
+		ChangesInterval: getEnvDuration("CHANGES_INTERVAL", DefaultChangesInterval),
+		WebhookSecret:   os.Getenv("DRIVE_WEBHOOK_SECRET"),
+		FFmpegPath:      os.Getenv("FFMPEG_PATH"),
+		HLSCacheDir:     getEnv("HLS_CACHE_DIR", DefaultHLSCacheDir),
+		ConvertPath:     os.Getenv("EBOOK_CONVERT_PATH"),
+		ConvertCacheDir: getEnv("CONVERT_CACHE_DIR", DefaultConvertCacheDir),
+		PublicURL:       os.Getenv("PUBLIC_URL"),
+		ShareSecret:     os.Getenv("SHARE_SECRET"),
+		ShareLinkTTL:    getEnvDuration("SHARE_LINK_TTL", DefaultShareLinkTTL),
+		SMTP: SMTPConfig{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     getEnv("SMTP_PORT", "587"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     getEnv("SMTP_FROM", "e-library@localhost"),
+		},
+		AccessMode:    accessMode,
+		SessionTTL:    getEnvDuration("SESSION_TTL", DefaultSessionTTL),
+		OIDCProviders: loadOIDCProviders(),
+		JWTSecret:     os.Getenv("JWT_SECRET"),
+		JWTTTL:        getEnvDuration("JWT_TTL", DefaultJWTTTL),
+		Quota: QuotaConfig{
+			DailyCount: int(getEnvInt("DOWNLOAD_LIMIT_COUNT", 0)),
+			DailyBytes: getEnvInt("DOWNLOAD_LIMIT_BYTES", 0),
+		},
+		SpoolDir:        os.Getenv("SPOOL_DIR"),
+		SpoolMaxBytes:   getEnvInt("SPOOL_MAX_BYTES", DefaultSpoolMaxBytes),
+		DirectDownloads: directMode,
+		ListProfile:     listProfile,
+		WorkspaceTypes:  workspaceTypes,
+		ExportsFolder:   os.Getenv("EXPORTS_FOLDER"),
+		ReportsFolder:   os.Getenv("REPORTS_FOLDER"),
+		Picker:          loadPickerConfig(),
+		QuotaAlert:      quotaAlert,
+		CollationLocale: collationLocale,
+	}, nil
+}
+
+// loadOIDCProviders reads the external identity providers from the environment.
+// Google Sign-In is enabled by GOOGLE_CLIENT_ID, and a generic OIDC provider
+// (for example a campus identity server) by OIDC_ISSUER.
+func loadOIDCProviders() []OIDCConfig {
+	var providers []OIDCConfig
+	if id := os.Getenv("GOOGLE_CLIENT_ID"); id != "" {
+		providers = append(providers, OIDCConfig{
+			Name:         "google",
+			Issuer:       GoogleIssuer,
+			ClientID:     id,
+			ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+		})
+	}
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		providers = append(providers, OIDCConfig{
+			Name:         getEnv("OIDC_NAME", "oidc"),
+			Issuer:       issuer,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		})
+	}
+	return providers
+}
+
+// getEnv returns the value of the environment variable key, or fallback if it is empty.
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// getEnvDuration parses the environment variable key as a time.Duration,
+// returning fallback if it is empty or invalid.
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("Warning: invalid %s %q, using %v", key, v, fallback)
+		return fallback
+	}
+	return d
+}
+
+// getEnvInt parses the environment variable key as a non-negative integer,
+// returning fallback if it is empty or invalid.
+func getEnvInt(key string, fallback int64) int64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		log.Printf("Warning: invalid %s %q, using %v", key, v, fallback)
+		return fallback
+	}
+	return n
 }
 
 // NewServer creates and initializes a new Server instance.
 // Returns an error if database initialization or Drive client creation fails.
-func NewServer(ctx context.Context, credentialsPath, dbPath string, redisAddr string) (*Server, error) {
+func NewServer(ctx context.Context, cfg Config) (*Server, error) {
 	// Initialize Drive client
-	b, err := os.ReadFile(credentialsPath)
+	b, err := os.ReadFile(cfg.CredentialsPath)
 	if err != nil {
 		return nil, fmt.Errorf("unable to read credentials: %w", err)
 	}
 
-	driveClient, err := gdrive.NewDriveClientForServiceAccount(ctx, b)
+	// Drive clients send the request ID of each call's context to Google
+	clientCtx := withRequestIDTransport(ctx)
+
+	driveClient, err := gdrive.NewDriveClientForServiceAccount(clientCtx, b)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create Drive client: %w", err)
 	}
 
+	driveService, err := newDriveService(clientCtx, b)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Drive service: %w", err)
+	}
+
+	activityService, err := newActivityService(clientCtx, b)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Drive Activity service: %w", err)
+	}
+
+	var directTokens oauth2.TokenSource
+	if cfg.DirectDownloads == DirectToken {
+		jwtConfig, err := google.JWTConfigFromJSON(b, drive.DriveReadonlyScope)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse service account credentials: %w", err)
+		}
+		directTokens = jwtConfig.TokenSource(clientCtx)
+	}
+
+	rules, err := loadRules(cfg.RulesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.PublicURL == "" {
+		cfg.PublicURL = "http://localhost:" + cfg.Port
+	}
+
+	if cfg.ShareSecret == "" {
+		cfg.ShareSecret = randomToken()
+		log.Println("Warning: SHARE_SECRET not set, share links will not survive a restart")
+	}
+
+	if cfg.JWTSecret == "" {
+		cfg.JWTSecret = randomToken()
+		log.Println("Warning: JWT_SECRET not set, API tokens will not survive a restart")
+	}
+
 	// Initialize SQLite database
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := openDB(cfg.DBPath, cfg.Storage)
 	if err != nil {
 		return nil, fmt.Errorf("unable to open database: %w", err)
 	}
@@ -77,12 +332,12 @@ func NewServer(ctx context.Context, credentialsPath, dbPath string, redisAddr st
 	}
 
 	// Initialize Redis client (required for e-library caching)
-	if redisAddr == "" {
+	if cfg.RedisAddr == "" {
 		return nil, fmt.Errorf("Redis address is required for e-library operation")
 	}
 
 	redisClient := redis.NewClient(&redis.Options{
-		Addr: redisAddr,
+		Addr: cfg.RedisAddr,
 		DB:   0,
 	})
 
@@ -93,11 +348,40 @@ func NewServer(ctx context.Context, credentialsPath, dbPath string, redisAddr st
 
 	log.Println("Redis connected successfully - using 24-hour cache for e-library")
 
-	return &Server{
-		driveClient: driveClient,
-		db:          db,
-		redis:       redisClient,
-	}, nil
+	s := &Server{
+		cfg:             cfg,
+		driveClient:     driveClient,
+		driveService:    driveService,
+		activityService: activityService,
+		db:              db,
+		redis:           redisClient,
+		rules:           rules,
+		scheduler:       NewScheduler(),
+		metrics:         newAPIMetrics(),
+		hls:             newHLSTranscoder(cfg.FFmpegPath, cfg.HLSCacheDir),
+		converter:       newEbookConverter(cfg.ConvertPath, cfg.ConvertCacheDir),
+		suggest:         &suggestIndex{},
+		directTokens:    directTokens,
+	}
+	s.authProviders = newAuthProviders(s)
+	s.cleanTempFiles()
+
+	s.downloads, err = newDownloadLog(s)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("unable to prepare download log: %w", err)
+	}
+
+	s.scheduler.Add(Job{Name: "refresh", Interval: cfg.RefreshInterval, Run: s.refreshLibrary})
+	s.scheduler.Add(Job{Name: "changes", Interval: cfg.ChangesInterval, Run: s.pollChanges})
+	s.scheduler.Add(Job{Name: "changes-watch", Interval: WatchRenewInterval, Run: s.renewWatch})
+	s.scheduler.Add(Job{Name: "weekly-digest", Interval: DigestInterval, Run: s.sendDigest})
+	s.scheduler.Add(Job{Name: "link-check", Interval: LinkCheckInterval, Run: s.checkPublicLinks})
+	s.scheduler.Add(Job{Name: "pdf-export", Interval: ExportInterval, Run: s.exportWorkspaceDocs})
+	s.scheduler.Add(Job{Name: "usage-report", Interval: UsageReportInterval, Run: s.storeUsageReport})
+	s.scheduler.Add(Job{Name: "quota-alert", Interval: QuotaAlertInterval, Run: s.checkStorageQuota})
+
+	return s, nil
 }
 
 // initDB creates the necessary database tables.
@@ -118,16 +402,247 @@ func initDB(db *sql.DB) error {
 		downloaded_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 
+	CREATE TABLE IF NOT EXISTS snapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		file_count INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS snapshot_files (
+		snapshot_id INTEGER NOT NULL REFERENCES snapshots(id),
+		file_id TEXT NOT NULL,
+		file_name TEXT NOT NULL,
+		mime_type TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		md5_checksum TEXT,
+		folder_path TEXT NOT NULL,
+		PRIMARY KEY (snapshot_id, file_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		action TEXT NOT NULL,
+		file_id TEXT,
+		detail TEXT,
+		remote_addr TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS known_files (
+		file_id TEXT PRIMARY KEY,
+		first_seen DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS file_tags (
+		file_id TEXT NOT NULL,
+		tag TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (file_id, tag)
+	);
+
+	CREATE TABLE IF NOT EXISTS digest_recipients (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		email TEXT NOT NULL UNIQUE,
+		opted_in INTEGER NOT NULL DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		email TEXT NOT NULL,
+		name TEXT NOT NULL,
+		provider TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		password_hash TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (provider, subject)
+	);
+
+	CREATE TABLE IF NOT EXISTS quota_overrides (
+		user_id INTEGER PRIMARY KEY REFERENCES users(id),
+		reason TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS collections (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS collection_files (
+		collection_id INTEGER NOT NULL REFERENCES collections(id),
+		file_id TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (collection_id, file_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS file_reports (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		file_id TEXT NOT NULL,
+		file_name TEXT NOT NULL,
+		user_id INTEGER REFERENCES users(id),
+		reason TEXT NOT NULL,
+		comment TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'open',
+		resolution TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		resolved_at DATETIME
+	);
+
+	CREATE TABLE IF NOT EXISTS file_visibility (
+		file_id TEXT PRIMARY KEY,
+		hidden BOOLEAN NOT NULL DEFAULT 0,
+		reason TEXT NOT NULL DEFAULT '',
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS picker_tokens (
+		user_id INTEGER PRIMARY KEY,
+		refresh_token TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS external_files (
+		file_id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		mime_type TEXT NOT NULL,
+		size INTEGER NOT NULL DEFAULT 0,
+		source_url TEXT NOT NULL,
+		added_by INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS usage_reports (
+		month TEXT PRIMARY KEY,
+		xlsx_file_id TEXT NOT NULL,
+		csv_file_id TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS shelves (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		title TEXT NOT NULL UNIQUE,
+		description TEXT NOT NULL DEFAULT '',
+		position INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS shelf_files (
+		shelf_id INTEGER NOT NULL REFERENCES shelves(id),
+		file_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		PRIMARY KEY (shelf_id, file_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS folder_subscriptions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		folder_id TEXT NOT NULL,
+		channel TEXT NOT NULL,
+		webhook_url TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (user_id, folder_id, channel)
+	);
+
+	CREATE TABLE IF NOT EXISTS workspace_exports (
+		file_id TEXT PRIMARY KEY,
+		export_id TEXT NOT NULL,
+		modified_time TEXT NOT NULL,
+		exported_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS revision_labels (
+		file_id TEXT NOT NULL,
+		revision_id TEXT NOT NULL,
+		label TEXT NOT NULL COLLATE NOCASE,
+		pinned BOOLEAN NOT NULL DEFAULT 0,
+		modified_time DATETIME,
+		size INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (file_id, revision_id),
+		UNIQUE (file_id, label)
+	);
+
+	CREATE TABLE IF NOT EXISTS public_links (
+		file_id TEXT PRIMARY KEY,
+		file_name TEXT NOT NULL,
+		web_view_link TEXT NOT NULL,
+		status TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		checked_at DATETIME NOT NULL,
+		broken_since DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_file_tags_tag ON file_tags(tag);
 	CREATE INDEX IF NOT EXISTS idx_bookmarks_file_id ON bookmarks(file_id);
 	CREATE INDEX IF NOT EXISTS idx_downloads_file_id ON downloads(file_id);
 	`
 
-	_, err := db.Exec(schema)
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+
+	// Columns added after the initial schema, for existing databases
+	columns := []struct{ table, column, definition string }{
+		{"downloads", "user_id", "INTEGER"},
+		{"downloads", "bytes", "INTEGER NOT NULL DEFAULT 0"},
+		{"downloads", "bytes_sent", "INTEGER"},
+		{"downloads", "status", "TEXT NOT NULL DEFAULT 'complete'"},
+		{"downloads", "folder_path", "TEXT NOT NULL DEFAULT ''"},
+		{"file_visibility", "featured", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"file_visibility", "pinned", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"file_reports", "reporter", "TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, c := range columns {
+		if err := addColumn(db, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	_, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_downloads_user_id ON downloads(user_id, downloaded_at)")
+	return err
+}
+
+// addColumn adds a column to table unless it already exists.
+func addColumn(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
 	return err
 }
 
 // Close releases all server resources.
 func (s *Server) Close() error {
+	if s.hls != nil {
+		s.hls.close()
+	}
+	if s.converter != nil {
+		s.converter.close()
+	}
+	if s.downloads != nil {
+		s.downloads.Close()
+	}
 	if s.redis != nil {
 		s.redis.Close()
 	}
@@ -143,151 +658,434 @@ func (s *Server) getFiles(ctx context.Context, forceRefresh bool) ([]gdrive.File
 		data, err := s.redis.Get(ctx, FilesListCacheKey).Bytes()
 		if err == nil {
 			var files []gdrive.FileInfo
-			if err := json.Unmarshal(data, &files); err == nil {
+			if err := unmarshalCache(data, &files); err == nil {
 				// Verify cache age
 				timestamp, err := s.redis.Get(ctx, CacheTimestampKey).Int64()
 				if err == nil {
 					cacheAge := time.Since(time.Unix(timestamp, 0))
 					if cacheAge < CacheExpiration {
-						log.Printf("Serving from cache (age: %v, expires in: %v)",
+						logf(ctx, "Serving from cache (age: %v, expires in: %v)",
 							cacheAge.Round(time.Minute),
 							(CacheExpiration - cacheAge).Round(time.Minute))
 						return files, nil
 					}
-					log.Println("Cache expired, fetching fresh data from Google Drive")
+					logf(ctx, "Cache expired, fetching fresh data from Google Drive")
 				}
 			}
 		}
 	} else {
-		log.Println("Force refresh requested, fetching fresh data from Google Drive")
+		logf(ctx, "Force refresh requested, fetching fresh data from Google Drive")
 	}
 
 	// Fetch from Drive API
-	log.Println("Fetching files from Google Drive API...")
+	logf(ctx, "Fetching files from Google Drive API...")
 	files, err := s.driveClient.ListFiles(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("unable to list files: %w", err)
 	}
 
-	log.Printf("Fetched %d files from Google Drive", len(files))
+	nativeFiles, err := s.listWorkspaceFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, nativeFiles...)
+
+	logf(ctx, "Fetched %d files from Google Drive", len(files))
 
 	// Update Redis cache with 24-hour expiration
-	data, err := json.Marshal(files)
+	data, err := marshalCache(files)
 	if err != nil {
-		log.Printf("Warning: Failed to marshal files for caching: %v", err)
+		logf(ctx, "Warning: Failed to marshal files for caching: %v", err)
 	} else {
 		// Store files list
 		if err := s.redis.Set(ctx, FilesListCacheKey, data, CacheExpiration).Err(); err != nil {
-			log.Printf("Warning: Failed to cache files list: %v", err)
+			logf(ctx, "Warning: Failed to cache files list: %v", err)
 		}
 		// Store timestamp for cache age tracking
 		if err := s.redis.Set(ctx, CacheTimestampKey, time.Now().Unix(), CacheExpiration).Err(); err != nil {
-			log.Printf("Warning: Failed to cache timestamp: %v", err)
+			logf(ctx, "Warning: Failed to cache timestamp: %v", err)
 		}
-		log.Println("Files cached in Redis for 24 hours")
+		logf(ctx, "Files cached in Redis for 24 hours")
+	}
+
+	// Derive the lite listing and the checksum, restricted and status indexes from this one on next use
+	if err := s.redis.Del(ctx, LiteFilesCacheKey, LiteCacheTimestampKey, ChecksumIndexKey, RestrictedIndexKey, FileStatusIndexKey).Err(); err != nil {
+		logf(ctx, "Warning: Failed to invalidate lite files list: %v", err)
 	}
 
 	return files, nil
 }
 
+// refreshLibrary is the scheduled refresh job. It fetches a fresh listing from Drive
+// and applies the organization rules to files that were not seen before.
+func (s *Server) refreshLibrary(ctx context.Context) error {
+	files, err := s.getFiles(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	newFiles, err := s.detectNewFiles(ctx, files)
+	if err != nil {
+		return fmt.Errorf("unable to detect new files: %w", err)
+	}
+
+	if len(newFiles) == 0 {
+		return nil
+	}
+	log.Printf("Detected %d new files", len(newFiles))
+
+	if err := s.notifySubscribers(ctx, newFiles); err != nil {
+		log.Printf("Warning: Failed to notify subscribers: %v", err)
+	}
+
+	if len(s.rules) == 0 {
+		return nil
+	}
+
+	// Rules may move files, so the listing is stale afterwards either way
+	err = s.applyRules(ctx, newFiles)
+	if cacheErr := s.invalidateCache(ctx); cacheErr != nil {
+		log.Printf("Warning: Failed to invalidate cache: %v", cacheErr)
+	}
+	return err
+}
+
+// findFile looks up a file by ID in the cached listing.
+// Returns nil (and no error) if the file is not listed.
+func (s *Server) findFile(ctx context.Context, fileID string) (*gdrive.FileInfo, error) {
+	files, err := s.getFiles(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range files {
+		if files[i].ID == fileID {
+			return &files[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// invalidateCache removes the cached file listing so the next read fetches fresh data from Drive.
+func (s *Server) invalidateCache(ctx context.Context) error {
+	return s.redis.Del(ctx, FilesListCacheKey, CacheTimestampKey, LiteFilesCacheKey, LiteCacheTimestampKey, ChecksumIndexKey, RestrictedIndexKey, FileStatusIndexKey).Err()
+}
+
+// ListFilesQuery holds the query parameters of GET /api/files.
+type ListFilesQuery struct {
+	Refresh bool   `query:"refresh"`
+	Profile string `query:"profile" validate:"oneof=full lite"`
+	Since   string `query:"since"`
+	Sort    string `query:"sort" validate:"omitempty,oneof=name"` // Listing order; Drive's when empty
+}
+
 // handleListFiles handles GET /api/files - returns list of all files.
+// See serveListing for conditional and delta responses.
 func (s *Server) handleListFiles(w http.ResponseWriter, r *http.Request) {
-	refresh := r.URL.Query().Get("refresh") == "true"
+	q := ListFilesQuery{Profile: string(s.cfg.ListProfile)}
+	if !decodeQuery(w, r, &q) {
+		return
+	}
 
-	files, err := s.getFiles(r.Context(), refresh)
+	overlay, err := s.loadOverlay(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	// Get cache info for response metadata
-	timestamp, _ := s.redis.Get(r.Context(), CacheTimestampKey).Int64()
-	cacheAge := time.Since(time.Unix(timestamp, 0))
-	expiresIn := CacheExpiration - cacheAge
+	if ListProfile(q.Profile) == ProfileLite {
+		files, err := s.getLiteFiles(r.Context(), q.Refresh)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if q.Sort == "name" {
+			files = slices.Clone(files)
+			sortByName(files, s.collator(), func(f LiteFileInfo) string { return f.Name })
+		}
+		id := func(f LiteFileInfo) string { return f.ID }
+		serveListing(s, w, r, q, applyOverlay(files, overlay, id), id, overlay, LiteCacheTimestampKey)
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{
-		"files":      files,
-		"count":      len(files),
-		"cache_age":  cacheAge.Round(time.Minute).String(),
-		"expires_in": expiresIn.Round(time.Minute).String(),
-		"cached_at":  time.Unix(timestamp, 0).Format(time.RFC3339),
-	})
+	files, err := s.getFiles(r.Context(), q.Refresh)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if q.Sort == "name" {
+		files = slices.Clone(files)
+		sortByName(files, s.collator(), func(f gdrive.FileInfo) string { return f.Name })
+	}
+	id := func(f gdrive.FileInfo) string { return f.ID }
+	serveListing(s, w, r, q, applyOverlay(files, overlay, id), id, overlay, CacheTimestampKey)
 }
 
 // handleDownloadFile handles GET /api/files/:id/download - streams file content.
 func (s *Server) handleDownloadFile(w http.ResponseWriter, r *http.Request) {
 	fileID := chi.URLParam(r, "id")
 	if fileID == "" {
-		http.Error(w, "file ID required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "file ID required")
 		return
 	}
 
-	// Record download in database
 	fileName := r.URL.Query().Get("name")
 	if fileName == "" {
 		fileName = "unknown"
 	}
 
-	_, err := s.db.Exec(
-		"INSERT INTO downloads (file_id, file_name) VALUES (?, ?)",
-		fileID, fileName,
-	)
+	// The listed size is needed to account the download against byte quotas
+	var size int64
+	var mimeType, folderPath string
+	file, err := s.findFile(r.Context(), fileID)
 	if err != nil {
-		log.Printf("Failed to record download: %v", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if file != nil {
+		size, mimeType, folderPath = file.Size, file.MimeType, file.FolderPath
 	}
 
-	// Set headers for file download
-	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
-	w.Header().Set("Content-Type", "application/octet-stream")
+	// Readers may pick a named revision, e.g. an earlier edition of a book
+	var revisionID string
+	if revision := r.URL.Query().Get("revision"); revision != "" {
+		named, err := s.findNamedRevision(r.Context(), fileID, revision)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if named == nil {
+			writeError(w, http.StatusNotFound, "named revision not found")
+			return
+		}
+		revisionID, size = named.RevisionID, named.Size
+	}
 
-	// Stream file directly to response
-	_, err = s.driveClient.StreamFile(r.Context(), fileID, w)
+	s.serveDownload(w, r, fileID, revisionID, fileName, folderPath, mimeType, size)
+}
+
+// Download statuses recorded in the downloads table.
+const (
+	downloadStarted    = "started"    // Streaming (or the server stopped mid-transfer)
+	downloadComplete   = "complete"   // All bytes were sent
+	downloadIncomplete = "incomplete" // The transfer failed or was cut short
+	downloadDirect     = "direct"     // A direct Drive URL was issued; bytes did not pass through the server
+	downloadStreamed   = "streamed"   // Playback started inline; seeking range requests are not recorded
+)
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write writes p to the underlying writer and counts the bytes written.
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// checkServable reports whether the content of a file may be served, writing an
+// error response if not. Files hidden from listings are only served to admins, and
+// files whose owner disabled downloads are refused up front, since Drive would
+// refuse with an opaque 403 once streaming starts.
+func (s *Server) checkServable(w http.ResponseWriter, r *http.Request, fileID string) bool {
+	ctx := r.Context()
+	hidden, err := s.isHidden(ctx, fileID)
 	if err != nil {
-		log.Printf("Error streaming file %s: %v", fileID, err)
-		// Cannot send error response after streaming starts
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if hidden && !s.isAdmin(r) {
+		writeError(w, http.StatusNotFound, "file not found")
+		return false
+	}
+
+	if restricted, err := s.restrictedFiles(ctx); err != nil {
+		logf(ctx, "Warning: Failed to load restricted files: %v", err)
+	} else if restricted[fileID] {
+		writeError(w, http.StatusForbidden, "the owner of this file has disabled downloads")
+		return false
 	}
+	return true
 }
 
-// handleAddBookmark handles POST /api/bookmarks - adds a file bookmark.
-func (s *Server) handleAddBookmark(w http.ResponseWriter, r *http.Request) {
-	var req BookmarkRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+// serveDownload enforces the download quota, records the download and streams
+// the file to the response as an attachment.
+//
+// A transfer that fails mid-stream is recorded as incomplete and the connection
+// is aborted, so clients see an error instead of a silently truncated file:
+// a short body when Content-Length is known, a missing final chunk otherwise.
+// Chunked responses also end with an X-Download-Status trailer.
+// A non-empty revisionID streams that revision instead of the current content.
+// Files Google flagged as malware or spam are refused unless an administrator
+// passes ?acknowledge_abuse=true.
+func (s *Server) serveDownload(w http.ResponseWriter, r *http.Request, fileID, revisionID, fileName, folderPath, mimeType string, size int64) {
+	ctx := r.Context()
+	if !s.checkServable(w, r, fileID) {
 		return
 	}
 
-	if req.FileID == "" {
-		http.Error(w, "file_id required", http.StatusBadRequest)
+	acknowledgeAbuse := r.URL.Query().Get("acknowledge_abuse") == "true"
+	if acknowledgeAbuse && !s.isAdmin(r) {
+		writeError(w, http.StatusForbidden, "only administrators can download files flagged as abusive")
 		return
 	}
 
-	// Get file info to store name
-	files, err := s.getFiles(r.Context(), false)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// Shortcuts are downloaded as their target, and Google-native files are exported
+	streamID := fileID
+	var export gdrive.ExportFormat
+	if mimeType == shortcutMimeType {
+		targetID, targetType, err := s.resolveShortcut(ctx, fileID)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		streamID, mimeType = targetID, targetType
+	}
+	if strings.HasPrefix(mimeType, workspaceMimePrefix) {
+		if revisionID != "" {
+			writeError(w, http.StatusConflict, "revisions of Google Workspace files cannot be downloaded")
+			return
+		}
+
+		native := s.cfg.WorkspaceTypes[mimeType]
+		if native.Export == "" {
+			writeError(w, http.StatusConflict, "Google Workspace files of this type cannot be downloaded")
+			return
+		}
+
+		var ok bool
+		w.Header().Add("Vary", "Accept")
+		if export, ok = negotiateExport(r.Header.Get("Accept"), native); !ok {
+			supported := make([]string, len(native.Formats))
+			for i, f := range native.Formats {
+				supported[i] = string(f)
+			}
+			writeError(w, http.StatusNotAcceptable, "supported formats: "+strings.Join(supported, ", "))
+			return
+		}
+		fileName += exportExtension(export)
+		size = 0 // Exports have no size until they are generated
+	}
+
+	if !s.checkQuota(w, r, size) {
 		return
 	}
 
-	var fileName string
-	for _, f := range files {
-		if f.ID == req.FileID {
-			fileName = f.Name
-			break
+	var userID sql.NullInt64
+	if user := userFromContext(ctx); user != nil {
+		userID = sql.NullInt64{Int64: user.ID, Valid: true}
+	}
+
+	// Record download in database
+	downloadID := s.downloads.start(ctx, fileID, fileName, folderPath, userID, size, downloadStarted)
+
+	defer s.trackDownload(ctx, r, downloadID, fileID, fileName)()
+
+	// Set headers for file download
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	if export != "" {
+		w.Header().Set("Content-Type", string(export))
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	if size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	} else {
+		w.Header().Set("Trailer", "X-Download-Status")
+	}
+
+	cw := &countingWriter{w: w}
+	status := downloadIncomplete
+	defer func() {
+		p := recover()
+		s.finishDownload(ctx, downloadID, cw.n, status)
+		if status != downloadComplete && cw.n > 0 {
+			if p != nil && p != http.ErrAbortHandler {
+				logf(ctx, "Panic streaming file %s after %d bytes: %v", fileID, cw.n, p)
+			}
+			// Abort the connection so the client cannot mistake the body for a complete file
+			panic(http.ErrAbortHandler)
 		}
+		if p != nil {
+			panic(p)
+		}
+	}()
+
+	// Stream file to response, through a disk spool when enabled
+	var err error
+	switch {
+	case export != "":
+		_, err = s.driveClient.ExportWorkspaceDocument(ctx, streamID, cw, export)
+	case revisionID != "":
+		_, err = s.driveClient.DownloadRevision(ctx, streamID, revisionID, cw)
+	case acknowledgeAbuse:
+		s.audit(r, "file.acknowledge_abuse", fileID, fileName)
+		_, err = s.streamAcknowledgingAbuse(ctx, streamID, cw)
+	case s.shouldSpool(size):
+		err = s.spoolDownload(ctx, streamID, cw)
+	default:
+		_, err = s.driveClient.StreamFile(ctx, streamID, cw)
 	}
+	switch {
+	case err != nil && cw.n == 0:
+		// Nothing was sent yet, so a regular error response is still possible
+		for _, h := range []string{"Content-Disposition", "Content-Length", "Trailer"} {
+			w.Header().Del(h)
+		}
+		logf(ctx, "Error streaming file %s: %v", fileID, err)
+		if abusiveFileError(err) {
+			msg := "Google flagged this file as malware or spam; it cannot be downloaded"
+			if s.isAdmin(r) {
+				msg += " unless ?acknowledge_abuse=true is passed"
+			}
+			writeError(w, http.StatusForbidden, msg)
+			return
+		}
+		writeError(w, http.StatusBadGateway, "unable to download file from Drive")
+	case err != nil:
+		logf(ctx, "Error streaming file %s after %d bytes: %v", fileID, cw.n, err)
+	case size > 0 && cw.n != size:
+		logf(ctx, "Streamed %d of %d bytes of file %s", cw.n, size, fileID)
+	default:
+		status = downloadComplete
+		w.Header().Set("X-Download-Status", status)
+	}
+}
 
-	if fileName == "" {
-		http.Error(w, "file not found", http.StatusNotFound)
+// finishDownload records the outcome of a download started by serveDownload.
+func (s *Server) finishDownload(ctx context.Context, downloadID, sent int64, status string) {
+	s.downloads.finish(ctx, downloadID, sent, status)
+}
+
+// handleAddBookmark handles POST /api/bookmarks - adds a file bookmark.
+func (s *Server) handleAddBookmark(w http.ResponseWriter, r *http.Request) {
+	var req BookmarkRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	// Look up the single file instead of loading the whole library listing
+	file, err := s.lookupFile(r.Context(), req.FileID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if file == nil {
+		writeError(w, http.StatusNotFound, "file not found")
 		return
 	}
+	fileName := file.Name
 
-	result, err := s.db.Exec(
+	result, err := s.execWrite(r.Context(),
 		"INSERT OR REPLACE INTO bookmarks (file_id, file_name, notes) VALUES (?, ?, ?)",
 		req.FileID, fileName, req.Notes,
 	)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -299,15 +1097,29 @@ func (s *Server) handleAddBookmark(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// handleListBookmarks handles GET /api/bookmarks - returns all bookmarks.
+// handleListBookmarks handles GET /api/bookmarks?cursor=&limit= - returns a page of bookmarks, newest first.
 func (s *Server) handleListBookmarks(w http.ResponseWriter, r *http.Request) {
+	q, ok := decodePage(w, r)
+	if !ok {
+		return
+	}
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM bookmarks").Scan(&total); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	where, args := q.keyset("created_at")
 	rows, err := s.db.Query(`
 		SELECT id, file_id, file_name, notes, created_at 
 		FROM bookmarks 
-		ORDER BY created_at DESC
-	`)
+		`+where+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, append(args, q.Limit+1)...)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	defer rows.Close()
@@ -330,14 +1142,18 @@ func (s *Server) handleListBookmarks(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if rows.Err() != nil {
-		http.Error(w, rows.Err().Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, rows.Err().Error())
 		return
 	}
 
+	bookmarks, next := paginate(bookmarks, q, func(b Bookmark) (time.Time, int64) { return b.CreatedAt, b.ID })
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
-		"bookmarks": bookmarks,
-		"count":     len(bookmarks),
+		"bookmarks":   bookmarks,
+		"count":       len(bookmarks),
+		"total":       total,
+		"next_cursor": next,
 	})
 }
 
@@ -346,19 +1162,19 @@ func (s *Server) handleDeleteBookmark(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		http.Error(w, "invalid bookmark ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "invalid bookmark ID")
 		return
 	}
 
-	result, err := s.db.Exec("DELETE FROM bookmarks WHERE id = ?", id)
+	result, err := s.execWrite(r.Context(), "DELETE FROM bookmarks WHERE id = ?", id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		http.Error(w, "bookmark not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "bookmark not found")
 		return
 	}
 
@@ -368,10 +1184,12 @@ func (s *Server) handleDeleteBookmark(w http.ResponseWriter, r *http.Request) {
 
 // handleGetStats handles GET /api/stats - returns download statistics.
 func (s *Server) handleGetStats(w http.ResponseWriter, r *http.Request) {
-	var totalDownloads int64
-	err := s.db.QueryRow("SELECT COUNT(*) FROM downloads").Scan(&totalDownloads)
+	var totalDownloads, incompleteDownloads int64
+	err := s.db.QueryRow(
+		"SELECT COUNT(*), COUNT(*) FILTER (WHERE status = ?) FROM downloads", downloadIncomplete,
+	).Scan(&totalDownloads, &incompleteDownloads)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -383,7 +1201,7 @@ func (s *Server) handleGetStats(w http.ResponseWriter, r *http.Request) {
 		LIMIT 10
 	`)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	defer rows.Close()
@@ -404,8 +1222,9 @@ func (s *Server) handleGetStats(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
-		"total_downloads": totalDownloads,
-		"top_files":       topFiles,
+		"total_downloads":      totalDownloads,
+		"incomplete_downloads": incompleteDownloads,
+		"top_files":            topFiles,
 	})
 }
 
@@ -414,85 +1233,252 @@ func (s *Server) handleClearCache(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	// Delete cache keys
-	if err := s.redis.Del(ctx, FilesListCacheKey, CacheTimestampKey).Err(); err != nil {
-		http.Error(w, fmt.Sprintf("failed to clear cache: %v", err), http.StatusInternalServerError)
+	if err := s.invalidateCache(ctx); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to clear cache: %v", err))
 		return
 	}
 
-	log.Println("Cache cleared manually")
+	logf(ctx, "Cache cleared manually")
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "cache cleared successfully",
 	})
 }
 
+// Routes builds the HTTP handler serving the API and the frontend.
+func (s *Server) Routes() http.Handler {
+	r := chi.NewRouter()
+
+	// Middleware
+	r.Use(requestID)
+	r.Use(s.requestLogger)
+	r.Use(middleware.Recoverer)
+	r.Use(s.metrics.middleware)
+	r.Use(middleware.Compress(5))
+	r.Use(cors.Handler(cors.Options{
+		AllowedOrigins:   []string{"*"},
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "Range", "If-Range", "If-None-Match", RequestIDHeader},
+		ExposedHeaders:   []string{"Accept-Ranges", "Content-Length", "Content-Range", "ETag", RequestIDHeader},
+		AllowCredentials: false,
+		MaxAge:           300,
+	}))
+	r.Use(s.loadUser)
+	r.Use(s.loadToken)
+
+	// API routes
+	r.Route("/api", func(r chi.Router) {
+		r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotFound, "no such endpoint")
+		})
+		r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		})
+
+		r.Get("/access", s.handleAccessInfo)
+
+		// Drive push notifications authenticate with the channel token
+		r.Post("/drive/notifications", s.handleDriveNotification)
+
+		// Login routes stay reachable in private mode
+		r.Get("/auth/providers", s.handleListAuthProviders)
+		r.Post("/auth/login", s.handleLogin)
+		r.Post("/auth/logout", s.handleLogout)
+		r.Post("/auth/token", s.handleIssueToken)
+		r.Get("/auth/{provider}/login", s.handleOAuthLogin)
+		r.Get("/auth/{provider}/callback", s.handleOAuthCallback)
+		r.Get("/me", s.handleMe)
+		r.Get("/me/sessions", s.handleListSessions)
+		r.Delete("/me/sessions", s.handleRevokeOtherSessions)
+		r.Delete("/me/sessions/{id}", s.handleRevokeSession)
+		r.Get("/me/quota", s.handleGetQuota)
+		r.Get("/me/subscriptions", s.handleListSubscriptions)
+		r.Post("/me/subscriptions", s.handleSubscribe)
+		r.Get("/me/subscriptions/events", s.handleSubscriptionEvents)
+		r.Delete("/me/subscriptions/{id}", s.handleUnsubscribe)
+		r.Get("/me/picker/connect", s.handlePickerConnect)
+		r.Get("/me/picker/callback", s.handlePickerCallback)
+		r.Get("/me/picker/token", s.handlePickerToken)
+
+		r.Group(func(r chi.Router) {
+			r.Use(s.requireBrowseAccess)
+
+			r.Get("/files", s.handleListFiles)
+			r.Get("/search/suggest", s.handleSuggest)
+			r.With(s.requireAdmin).Delete("/files/{id}", s.handleDeleteFile)
+			r.With(s.requireAdmin).Post("/files/{id}/restore", s.handleRestoreFile)
+			r.With(s.requireAdmin).Put("/files/{id}/content", s.handleReplaceContent)
+			r.With(s.requireAdmin).Get("/files/{id}/activity", s.handleFileActivity)
+			r.Get("/files/{id}/revisions", s.handleListNamedRevisions)
+			r.Get("/files/{id}/related", s.handleRelatedFiles)
+			r.With(s.requireAdmin).Post("/files/{id}/revisions", s.handleNameRevision)
+			r.With(s.requireAdmin).Delete("/files/{id}/revisions/{revisionID}", s.handleRemoveNamedRevision)
+			r.With(s.requireAdmin).Post("/folders", s.handleCreateFolder)
+			r.With(s.requireAdmin).Patch("/folders/{id}", s.handleUpdateFolder)
+			r.With(s.requireAdmin).Delete("/folders/{id}", s.handleDeleteFolder)
+			r.Get("/views", s.handleListViews)
+			r.Get("/views/{view}", s.handleGetView)
+			r.Get("/bookmarks", s.handleListBookmarks)
+			r.Post("/bookmarks", s.handleAddBookmark)
+			r.Get("/bookmarks/export", s.handleExportBookmarks)
+			r.Post("/bookmarks/import", s.handleImportBookmarks)
+			r.Delete("/bookmarks/{id}", s.handleDeleteBookmark)
+			r.Post("/files/{id}/report", s.handleReportFile)
+			r.Get("/collections", s.handleListCollections)
+			r.Get("/shelves", s.handleListShelves)
+			r.Get("/stats", s.handleGetStats)
+			r.Get("/stats/folders", s.handleFolderStats)
+			r.Get("/activity", s.handleGetActivity)
+			r.Get("/external", s.handleListExternalFiles)
+			r.Post("/external", s.handleAddExternalFile)
+			r.Post("/cache/clear", s.handleClearCache)
+
+			// Routes serving (or granting access to) file content
+			r.Group(func(r chi.Router) {
+				r.Use(s.requireDownloadAccess)
+				r.Get("/files/{id}/download", s.handleDownloadFile)
+				r.Get("/content/{md5}", s.handleGetContent)
+				r.Get("/files/{id}/direct", s.handleDirectDownload)
+				r.Post("/files/{id}/progress", s.handleProgressPing)
+				r.Get("/files/{id}/media", s.handleStreamMedia)
+				r.Head("/files/{id}/media", s.handleStreamMedia)
+				r.Get("/files/{id}/hls/playlist.m3u8", s.handleHLSPlaylist)
+				r.Get("/files/{id}/hls/{segment}", s.handleHLSSegment)
+				r.Get("/files/{id}/convert", s.handleConvertFile)
+				r.Get("/external/{id}/download", s.handleDownloadExternalFile)
+				r.Get("/files/{id}/share", s.handleShareLink)
+				r.Get("/files/{id}/share/qr", s.handleShareQR)
+			})
+
+			// Admin routes
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(s.requireAdmin)
+				r.Get("/snapshots", s.handleListSnapshots)
+				r.Post("/snapshots", s.handleCreateSnapshot)
+				r.Get("/snapshots/diff", s.handleDiffSnapshots)
+				r.Get("/audit", s.handleListAudit)
+				r.Get("/downloads", s.handleListDownloads)
+				r.Get("/usage", s.handleGetUsageReport)
+				r.Post("/rename", s.handleBulkRename)
+				r.Get("/jobs", s.handleListJobs)
+				r.Get("/dashboard", s.handleGetDashboard)
+				r.Get("/perf", s.handleGetPerf)
+				r.Get("/digest/recipients", s.handleListDigestRecipients)
+				r.Post("/digest/recipients", s.handleAddDigestRecipient)
+				r.Delete("/digest/recipients/{email}", s.handleRemoveDigestRecipient)
+				r.Post("/digest/send", s.handleSendDigest)
+				r.Get("/users", s.handleListUsers)
+				r.Post("/users", s.handleCreateUser)
+				r.Delete("/users/{id}/sessions", s.handleRevokeUserSessions)
+				r.Get("/quota/overrides", s.handleListQuotaOverrides)
+				r.Post("/quota/overrides", s.handleAddQuotaOverride)
+				r.Delete("/quota/overrides/{userID}", s.handleRemoveQuotaOverride)
+				r.Post("/import/catalog", s.handleImportCatalog)
+				r.Get("/catalog/export", s.handleExportSite)
+				r.Post("/catalog/publish", s.handlePublishSite)
+				r.Get("/reports", s.handleListReports)
+				r.Post("/reports/{id}/resolve", s.handleResolveReport)
+				r.Get("/visibility", s.handleListVisibility)
+				r.Put("/files/{id}/visibility", s.handleSetVisibility)
+				r.Put("/files/{id}/status", s.handleSetFileStatus)
+				r.Post("/shelves", s.handleCreateShelf)
+				r.Put("/shelves/{id}", s.handleUpdateShelf)
+				r.Delete("/shelves/{id}", s.handleDeleteShelf)
+				r.Post("/folders/{id}/share", s.handleShareRoster)
+				r.Get("/links", s.handleListPublicLinks)
+				r.Post("/links/check", s.handleCheckPublicLinks)
+				r.Delete("/external/{id}", s.handleRemoveExternalFile)
+				r.Get("/shared", s.handleListShared)
+				r.Post("/shared/import", s.handleImportShared)
+			})
+		})
+	})
+
+	// Signed share links grant access on their own, regardless of the access mode
+	r.Get("/s/{token}", s.handleSharedDownload)
+
+	// Plain listings for low-bandwidth clients and screen readers
+	r.With(s.requireBrowseAccess).Get("/catalog.txt", s.handlePlainCatalog)
+	r.With(s.requireBrowseAccess).Get("/catalog.html", s.handlePlainCatalog)
+
+	// Serve static files (frontend)
+	r.Get("/*", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "static/index.html")
+	})
+
+	return r
+}
+
+// runCommand dispatches a CLI subcommand by name.
+func runCommand(ctx context.Context, cfg Config, name string, args []string) error {
+	switch name {
+	case "rename":
+		return runRenameCommand(ctx, cfg, args)
+	case "verify":
+		return runVerifyCommand(ctx, cfg, args)
+	default:
+		return fmt.Errorf("unknown command (available: rename, verify)")
+	}
+}
+
 func main() {
 	godotenv.Load()
 
 	ctx := context.Background()
 
 	// Get configuration from environment or use defaults
-	credPath := os.Getenv("CREDENTIALS_PATH")
-	if credPath == "" {
-		credPath = DefaultCredentialsPath
-	}
-
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = DefaultDBPath
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
 	}
+	setupLogging(cfg.Logging)
 
-	redisAddr := os.Getenv("REDIS_ADDR")
-	if redisAddr == "" {
+	if cfg.RedisAddr == "" {
 		log.Fatal("REDIS_ADDR environment variable is required for e-library operation")
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Run a CLI subcommand instead of the server when one is given
+	if len(os.Args) > 1 {
+		if err := runCommand(ctx, cfg, os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("%s: %v", os.Args[1], err)
+		}
+		return
 	}
 
 	// Initialize server
-	server, err := NewServer(ctx, credPath, dbPath, redisAddr)
+	server, err := NewServer(ctx, cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize server: %v", err)
 	}
 	defer server.Close()
 
-	// Setup router
-	r := chi.NewRouter()
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Middleware
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-	r.Use(middleware.Compress(5))
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Content-Type"},
-		AllowCredentials: false,
-		MaxAge:           300,
-	}))
-
-	// API routes
-	r.Route("/api", func(r chi.Router) {
-		r.Get("/files", server.handleListFiles)
-		r.Get("/files/{id}/download", server.handleDownloadFile)
-		r.Get("/bookmarks", server.handleListBookmarks)
-		r.Post("/bookmarks", server.handleAddBookmark)
-		r.Delete("/bookmarks/{id}", server.handleDeleteBookmark)
-		r.Get("/stats", server.handleGetStats)
-		r.Post("/cache/clear", server.handleClearCache)
-	})
+	server.scheduler.Start(ctx)
+	if cfg.WebhookSecret != "" {
+		// Open the notification channel now instead of after the first renewal interval
+		server.scheduler.RunNow(ctx, "changes-watch")
+	}
 
-	// Serve static files (frontend)
-	r.Get("/*", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "static/index.html")
-	})
+	httpServer := &http.Server{Addr: ":" + cfg.Port, Handler: server.Routes()}
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
 
-	log.Printf("E-Library server starting on http://localhost:%s", port)
+	log.Printf("E-Library server starting on http://localhost:%s", cfg.Port)
 	log.Printf("Cache strategy: Redis with 24-hour expiration")
-	if err := http.ListenAndServe(":"+port, r); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	log.Printf("Access mode: %s", cfg.AccessMode)
+
+	<-ctx.Done()
+	log.Println("Shutting down")
+
+	// Let in-flight requests finish so their downloads are recorded before the log is flushed
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Warning: shutdown: %v", err)
 	}
 }
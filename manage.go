@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/api/drive/v3"
+)
+
+// FolderRequest represents a folder creation or update request.
+// For updates, empty fields are left unchanged.
+type FolderRequest struct {
+	Name        string `json:"name" validate:"max=255"`
+	ParentID    string `json:"parent_id"`
+	ColorRgb    string `json:"folder_color_rgb" validate:"omitempty,hexcolor"` // e.g. "#4986e7"
+	Description string `json:"description" validate:"max=4000"`
+}
+
+// writeDriveError writes the response for a failed Drive call on a file or folder:
+// 404 with notFound if Drive does not know the ID, 500 otherwise.
+func writeDriveError(w http.ResponseWriter, err error, notFound string) {
+	if notFoundError(err) {
+		writeError(w, http.StatusNotFound, notFound)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+// checkLibraryFolder writes an error response and returns false unless folderID is a
+// folder listed in the library, so the folder API cannot be used on files or on folders
+// outside the library.
+func (s *Server) checkLibraryFolder(w http.ResponseWriter, r *http.Request, folderID, field string) bool {
+	ctx := r.Context()
+	file, err := s.lookupFile(ctx, folderID)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return false
+	}
+	if file == nil {
+		writeError(w, http.StatusNotFound, "folder not found")
+		return false
+	}
+	if file.MimeType != folderMimeType {
+		writeValidationError(w, FieldError{Field: field, Message: "must be a folder"})
+		return false
+	}
+
+	if path, err := s.libraryFolder(ctx, folderID); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return false
+	} else if path == "" {
+		writeError(w, http.StatusNotFound, "folder not found")
+		return false
+	}
+	return true
+}
+
+// DeleteFileQuery holds the query parameters of DELETE /api/files/:id.
+type DeleteFileQuery struct {
+	Permanent bool `query:"permanent"`
+}
+
+// handleDeleteFile handles DELETE /api/files/:id - moves a file to the trash,
+// or deletes it permanently when called with ?permanent=true.
+func (s *Server) handleDeleteFile(w http.ResponseWriter, r *http.Request) {
+	fileID := chi.URLParam(r, "id")
+	if fileID == "" {
+		writeError(w, http.StatusBadRequest, "file ID required")
+		return
+	}
+
+	var q DeleteFileQuery
+	if !decodeQuery(w, r, &q) {
+		return
+	}
+
+	ctx := r.Context()
+	action, message := "file.trash", "file moved to trash"
+	var err error
+	if q.Permanent {
+		action, message = "file.delete", "file permanently deleted"
+		err = s.deleteFile(ctx, fileID)
+	} else {
+		err = s.setTrashed(ctx, fileID, true)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("unable to delete file: %v", err))
+		return
+	}
+
+	s.audit(r, action, fileID, "")
+	if err := s.invalidateCache(ctx); err != nil {
+		logf(ctx, "Warning: Failed to invalidate cache: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// handleRestoreFile handles POST /api/files/:id/restore - restores a file from the trash.
+func (s *Server) handleRestoreFile(w http.ResponseWriter, r *http.Request) {
+	fileID := chi.URLParam(r, "id")
+	if fileID == "" {
+		writeError(w, http.StatusBadRequest, "file ID required")
+		return
+	}
+
+	ctx := r.Context()
+	if err := s.setTrashed(ctx, fileID, false); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("unable to restore file: %v", err))
+		return
+	}
+
+	s.audit(r, "file.restore", fileID, "")
+	if err := s.invalidateCache(ctx); err != nil {
+		logf(ctx, "Warning: Failed to invalidate cache: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "file restored"})
+}
+
+// maxReplaceBytes bounds the upload accepted by PUT /api/files/:id/content.
+const maxReplaceBytes = 2 << 30
+
+// handleReplaceContent handles PUT /api/files/:id/content - replaces the content of a
+// file with the request body, for example with a new edition of a book. The file keeps
+// its ID, so share links and bookmarks stay valid, and Drive keeps the old content as
+// a revision. The Content-Type header sets the new type; without one the type is kept.
+func (s *Server) handleReplaceContent(w http.ResponseWriter, r *http.Request) {
+	fileID := chi.URLParam(r, "id")
+	if !driveIDPattern.MatchString(fileID) {
+		writeError(w, http.StatusBadRequest, "invalid file ID")
+		return
+	}
+
+	var mimeType string
+	if header := r.Header.Get("Content-Type"); header != "" {
+		mt, _, err := mime.ParseMediaType(header)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid Content-Type")
+			return
+		}
+		mimeType = mt
+	}
+	if strings.HasPrefix(mimeType, workspaceMimePrefix) {
+		writeError(w, http.StatusBadRequest, "content cannot be uploaded as a Google Workspace type")
+		return
+	}
+
+	ctx := r.Context()
+	file, err := s.lookupFile(ctx, fileID)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	if file == nil {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	if strings.HasPrefix(file.MimeType, workspaceMimePrefix) {
+		writeError(w, http.StatusConflict, "folders and Google Workspace files have no content to replace")
+		return
+	}
+
+	f, err := s.replaceContent(ctx, fileID, http.MaxBytesReader(w, r.Body, maxReplaceBytes), mimeType)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "content is too large")
+			return
+		}
+		writeDriveError(w, err, "file not found")
+		return
+	}
+
+	s.audit(r, "file.replace", fileID, fmt.Sprintf("%s, %d bytes", f.MimeType, f.Size))
+	if err := s.invalidateCache(ctx); err != nil {
+		logf(ctx, "Warning: Failed to invalidate cache: %v", err)
+	}
+	if s.hls != nil {
+		if err := s.hls.evict(fileID); err != nil {
+			logf(ctx, "Warning: Failed to remove HLS rendition of %s: %v", fileID, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":           f.Id,
+		"name":         f.Name,
+		"mime_type":    f.MimeType,
+		"size":         f.Size,
+		"md5_checksum": f.Md5Checksum,
+		"version":      f.Version,
+	})
+}
+
+// handleCreateFolder handles POST /api/folders - creates a new folder.
+func (s *Server) handleCreateFolder(w http.ResponseWriter, r *http.Request) {
+	var req FolderRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.Name == "" {
+		writeValidationError(w, FieldError{Field: "name", Message: "is required"})
+		return
+	}
+
+	ctx := r.Context()
+	folderID, err := s.createFolder(ctx, req.Name, req.ParentID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("unable to create folder: %v", err))
+		return
+	}
+
+	if req.ColorRgb != "" || req.Description != "" {
+		if _, err := s.updateFolderStyle(ctx, folderID, req.ColorRgb, req.Description); err != nil {
+			logf(ctx, "Warning: Folder %s created but not styled: %v", folderID, err)
+		}
+	}
+
+	s.audit(r, "folder.create", folderID, req.Name)
+	if err := s.invalidateCache(ctx); err != nil {
+		logf(ctx, "Warning: Failed to invalidate cache: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"id":      folderID,
+		"message": "folder created",
+	})
+}
+
+// handleUpdateFolder handles PATCH /api/folders/:id - renames and/or moves a folder.
+// When the style update fails after the rename or move, the applied change is still audited.
+func (s *Server) handleUpdateFolder(w http.ResponseWriter, r *http.Request) {
+	folderID := chi.URLParam(r, "id")
+	if folderID == "" {
+		writeError(w, http.StatusBadRequest, "folder ID required")
+		return
+	}
+
+	var req FolderRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.Name == "" && req.ParentID == "" && req.ColorRgb == "" && req.Description == "" {
+		const msg = "one of name, parent_id, folder_color_rgb or description is required"
+		writeValidationError(w,
+			FieldError{Field: "name", Message: msg},
+			FieldError{Field: "parent_id", Message: msg},
+			FieldError{Field: "folder_color_rgb", Message: msg},
+			FieldError{Field: "description", Message: msg},
+		)
+		return
+	}
+
+	if !s.checkLibraryFolder(w, r, folderID, "id") {
+		return
+	}
+	if req.ParentID != "" && req.ParentID != "root" && !s.checkLibraryFolder(w, r, req.ParentID, "parent_id") {
+		return
+	}
+
+	ctx := r.Context()
+	var folder *drive.File
+	var err error
+	var applied []string
+	if req.Name != "" || req.ParentID != "" {
+		if folder, err = s.updateMetadata(ctx, folderID, req.Name, req.ParentID); err != nil {
+			writeDriveError(w, err, "folder not found")
+			return
+		}
+		applied = append(applied, fmt.Sprintf("name=%q parent=%q", req.Name, req.ParentID))
+	}
+
+	if req.ColorRgb != "" || req.Description != "" {
+		folder, err = s.updateFolderStyle(ctx, folderID, req.ColorRgb, req.Description)
+		if err == nil {
+			applied = append(applied, fmt.Sprintf("color=%q description=%q", req.ColorRgb, req.Description))
+		}
+	}
+
+	if len(applied) > 0 {
+		s.audit(r, "folder.update", folderID, strings.Join(applied, " "))
+		if err := s.invalidateCache(ctx); err != nil {
+			logf(ctx, "Warning: Failed to invalidate cache: %v", err)
+		}
+	}
+	if err != nil {
+		writeDriveError(w, err, "folder not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":               folder.Id,
+		"name":             folder.Name,
+		"parents":          folder.Parents,
+		"folder_color_rgb": folder.FolderColorRgb,
+		"description":      folder.Description,
+		"message":          "folder updated",
+	})
+}
+
+// handleDeleteFolder handles DELETE /api/folders/:id - moves a folder and its contents to the trash.
+func (s *Server) handleDeleteFolder(w http.ResponseWriter, r *http.Request) {
+	folderID := chi.URLParam(r, "id")
+	if folderID == "" {
+		writeError(w, http.StatusBadRequest, "folder ID required")
+		return
+	}
+
+	if !s.checkLibraryFolder(w, r, folderID, "id") {
+		return
+	}
+
+	ctx := r.Context()
+	if err := s.setTrashed(ctx, folderID, true); err != nil {
+		writeDriveError(w, err, "folder not found")
+		return
+	}
+
+	s.audit(r, "folder.trash", folderID, "")
+	if err := s.invalidateCache(ctx); err != nil {
+		logf(ctx, "Warning: Failed to invalidate cache: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "folder moved to trash"})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/abiiranathan/gdrive"
+	"github.com/go-chi/chi/v5"
+)
+
+// driveFile is an io.ReadSeekCloser over the content of a Drive file.
+// Reads are served from a ranged download starting at the current offset;
+// seeking elsewhere drops the open download so the next read starts a new one.
+type driveFile struct {
+	ctx    context.Context
+	s      *Server
+	fileID string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+// Read reads from the file at the current offset, opening a download if needed.
+func (f *driveFile) Read(p []byte) (int, error) {
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+
+	if f.body == nil {
+		body, err := f.s.openRange(f.ctx, f.fileID, f.offset)
+		if err != nil {
+			return 0, err
+		}
+		f.body = body
+	}
+
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	if err == io.EOF && f.offset < f.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Seek sets the offset for the next Read. Seeking never performs I/O.
+func (f *driveFile) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = f.offset + offset
+	case io.SeekEnd:
+		abs = f.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if abs != f.offset {
+		f.Close()
+		f.offset = abs
+	}
+	return abs, nil
+}
+
+// Close releases the open download, if any.
+func (f *driveFile) Close() error {
+	if f.body == nil {
+		return nil
+	}
+	err := f.body.Close()
+	f.body = nil
+	return err
+}
+
+// mediaContentType returns the content type to serve a file with, falling back to
+// the file extension when Drive reports a generic or missing MIME type.
+func mediaContentType(mimeType, name string) string {
+	if mimeType != "" && mimeType != "application/octet-stream" {
+		return mimeType
+	}
+	if byExt := mime.TypeByExtension(path.Ext(name)); byExt != "" {
+		return byExt
+	}
+	return "application/octet-stream"
+}
+
+// playbackStart reports whether a request starts playback rather than seeking within
+// it: a GET for the whole file or a range from its first byte.
+func playbackStart(r *http.Request) bool {
+	rng := r.Header.Get("Range")
+	return r.Method == http.MethodGet && (rng == "" || strings.HasPrefix(rng, "bytes=0-"))
+}
+
+// authorizePlayback applies the checks serveDownload makes to content served from
+// somewhere other than Drive, such as inline playback and local conversions, writing
+// an error response if it is refused. Requests that start playback are checked
+// against the download quota and recorded in the download log; seeking within an
+// allowed playback is not counted again.
+func (s *Server) authorizePlayback(w http.ResponseWriter, r *http.Request, file *gdrive.FileInfo) bool {
+	if !s.checkServable(w, r, file.ID) {
+		return false
+	}
+	if !playbackStart(r) {
+		return true
+	}
+	if !s.checkQuota(w, r, file.Size) {
+		return false
+	}
+
+	ctx := r.Context()
+	var userID sql.NullInt64
+	if user := userFromContext(ctx); user != nil {
+		userID = sql.NullInt64{Int64: user.ID, Valid: true}
+	}
+	s.downloads.start(ctx, file.ID, file.Name, file.FolderPath, userID, file.Size, downloadStreamed)
+	return true
+}
+
+// handleStreamMedia handles GET and HEAD /api/files/:id/media - serves file content
+// inline with byte range support, so HTML5 audio/video players can seek. Playback is
+// subject to the same checks as downloads; see authorizePlayback.
+func (s *Server) handleStreamMedia(w http.ResponseWriter, r *http.Request) {
+	fileID := chi.URLParam(r, "id")
+	if fileID == "" {
+		writeError(w, http.StatusBadRequest, "file ID required")
+		return
+	}
+
+	ctx := r.Context()
+	file, err := s.findFile(ctx, fileID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if file == nil {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	if !s.authorizePlayback(w, r, file) {
+		return
+	}
+
+	content := &driveFile{ctx: ctx, s: s, fileID: file.ID, size: file.Size}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", mediaContentType(file.MimeType, file.Name))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, file.Name))
+
+	// ServeContent handles Range, If-Range, HEAD and 416 responses
+	http.ServeContent(w, r, file.Name, time.Time{}, content)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// maxMetricRoutes is the number of routes reported in the API usage breakdown.
+const maxMetricRoutes = 10
+
+// RouteUsage counts the requests served by a route pattern.
+type RouteUsage struct {
+	Route    string `json:"route"`
+	Requests int64  `json:"requests"`
+	Errors   int64  `json:"errors"` // Responses with a 5xx status
+}
+
+// APIUsage summarizes API traffic since the server started.
+type APIUsage struct {
+	Since        time.Time    `json:"since"`
+	Requests     int64        `json:"requests"`
+	ClientErrors int64        `json:"client_errors"`
+	ServerErrors int64        `json:"server_errors"`
+	ErrorRate    float64      `json:"error_rate"` // Share of requests answered with 5xx
+	TopRoutes    []RouteUsage `json:"top_routes"`
+}
+
+// apiMetrics counts requests per route and status class in memory.
+type apiMetrics struct {
+	mu           sync.Mutex
+	since        time.Time
+	requests     int64
+	clientErrors int64
+	serverErrors int64
+	routes       map[string]*RouteUsage
+	latency      map[string]*latencyWindow
+}
+
+// newAPIMetrics creates empty request counters.
+func newAPIMetrics() *apiMetrics {
+	return &apiMetrics{
+		since:   time.Now(),
+		routes:  make(map[string]*RouteUsage),
+		latency: make(map[string]*latencyWindow),
+	}
+}
+
+// middleware counts every request by its route pattern and response status, and
+// samples its latency.
+func (m *apiMetrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			route := "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = r.Method + " " + rctx.RoutePattern()
+			}
+			m.record(route, ww.Status(), time.Since(start))
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// record counts one request.
+func (m *apiMetrics) record(route string, status int, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage, ok := m.routes[route]
+	if !ok {
+		usage = &RouteUsage{Route: route}
+		m.routes[route] = usage
+	}
+
+	lw, ok := m.latency[route]
+	if !ok {
+		lw = &latencyWindow{}
+		m.latency[route] = lw
+	}
+	lw.add(latencySample{at: time.Now(), elapsed: elapsed, failed: status >= 500})
+
+	m.requests++
+	usage.Requests++
+	switch {
+	case status >= 500:
+		m.serverErrors++
+		usage.Errors++
+	case status >= 400:
+		m.clientErrors++
+	}
+}
+
+// snapshot returns the current counters with the busiest routes first.
+func (m *apiMetrics) snapshot() APIUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage := APIUsage{
+		Since:        m.since,
+		Requests:     m.requests,
+		ClientErrors: m.clientErrors,
+		ServerErrors: m.serverErrors,
+		TopRoutes:    make([]RouteUsage, 0, len(m.routes)),
+	}
+	if m.requests > 0 {
+		usage.ErrorRate = float64(m.serverErrors) / float64(m.requests)
+	}
+
+	for _, r := range m.routes {
+		usage.TopRoutes = append(usage.TopRoutes, *r)
+	}
+	slices.SortFunc(usage.TopRoutes, func(a, b RouteUsage) int {
+		return cmp.Or(cmp.Compare(b.Requests, a.Requests), cmp.Compare(a.Route, b.Route))
+	})
+	if len(usage.TopRoutes) > maxMetricRoutes {
+		usage.TopRoutes = usage.TopRoutes[:maxMetricRoutes]
+	}
+	return usage
+}
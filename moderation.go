@@ -0,0 +1,241 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// FileReport is a user's report of broken or inappropriate content.
+type FileReport struct {
+	ID         int64     `json:"id"`
+	FileID     string    `json:"file_id"`
+	FileName   string    `json:"file_name"`
+	UserID     *int64    `json:"user_id"`
+	Reason     string    `json:"reason"`
+	Comment    string    `json:"comment,omitempty"`
+	Status     string    `json:"status"` // open, resolved or dismissed
+	Resolution string    `json:"resolution,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ResolvedAt time.Time `json:"resolved_at,omitzero"`
+}
+
+// ReportRequest represents a request to report a file.
+type ReportRequest struct {
+	Reason  string `json:"reason" validate:"required,oneof=broken inappropriate copyright other"`
+	Comment string `json:"comment" validate:"max=1000"`
+}
+
+// ReportsQuery holds the filter of GET /api/admin/reports.
+type ReportsQuery struct {
+	Status string `query:"status" validate:"oneof=open resolved dismissed all"`
+}
+
+// ResolveReportRequest represents a moderator's decision on a report.
+type ResolveReportRequest struct {
+	Status string `json:"status" validate:"required,oneof=resolved dismissed"`
+	Hide   bool   `json:"hide"` // Hide the file from listings
+	Note   string `json:"note" validate:"max=1000"`
+}
+
+// handleReportFile handles POST /api/files/:id/report - flags a file as broken or
+// inappropriate for review in the moderation queue. A reader can have one open
+// report per file; guests are told apart by a hash of their address, as in live activity.
+func (s *Server) handleReportFile(w http.ResponseWriter, r *http.Request) {
+	var req ReportRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+	fileID := chi.URLParam(r, "id")
+	file, err := s.findFile(ctx, fileID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if file == nil {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	var userID sql.NullInt64
+	if user := userFromContext(ctx); user != nil {
+		userID = sql.NullInt64{Int64: user.ID, Valid: true}
+	}
+	_, reporter := readerIdentity(r)
+
+	// Reports filed before reporters were recorded only carry the user ID
+	var open int
+	err = s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM file_reports WHERE file_id = ? AND (reporter = ? OR user_id = ?) AND status = 'open'",
+		fileID, reporter, userID,
+	).Scan(&open)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if open > 0 {
+		writeError(w, http.StatusConflict, "you already reported this file")
+		return
+	}
+
+	result, err := s.execWrite(ctx,
+		"INSERT INTO file_reports (file_id, file_name, user_id, reporter, reason, comment) VALUES (?, ?, ?, ?, ?, ?)",
+		fileID, file.Name, userID, reporter, req.Reason, req.Comment,
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":      id,
+		"message": "report submitted",
+	})
+}
+
+// handleListReports handles GET /api/admin/reports - returns the moderation queue,
+// newest first. Only open reports are listed unless ?status= says otherwise.
+func (s *Server) handleListReports(w http.ResponseWriter, r *http.Request) {
+	filter := ReportsQuery{Status: "open"}
+	if !decodeQuery(w, r, &filter) {
+		return
+	}
+	q, ok := decodePage(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	var total int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM file_reports WHERE ? = 'all' OR status = ?", filter.Status, filter.Status,
+	).Scan(&total)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	where, args := q.keyset("created_at")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, file_id, file_name, user_id, reason, comment, status, resolution, created_at, resolved_at
+		FROM (SELECT * FROM file_reports WHERE ? = 'all' OR status = ?)
+		`+where+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, append(append([]any{filter.Status, filter.Status}, args...), q.Limit+1)...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	reports := make([]FileReport, 0)
+	for rows.Next() {
+		var rep FileReport
+		var userID sql.NullInt64
+		var resolvedAt sql.NullTime
+		if err := rows.Scan(&rep.ID, &rep.FileID, &rep.FileName, &userID, &rep.Reason, &rep.Comment,
+			&rep.Status, &rep.Resolution, &rep.CreatedAt, &resolvedAt); err != nil {
+			continue
+		}
+		if userID.Valid {
+			rep.UserID = &userID.Int64
+		}
+		rep.ResolvedAt = resolvedAt.Time
+		reports = append(reports, rep)
+	}
+
+	if rows.Err() != nil {
+		writeError(w, http.StatusInternalServerError, rows.Err().Error())
+		return
+	}
+
+	reports, next := paginate(reports, q, func(rep FileReport) (time.Time, int64) { return rep.CreatedAt, rep.ID })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"reports":     reports,
+		"count":       len(reports),
+		"total":       total,
+		"next_cursor": next,
+	})
+}
+
+// handleResolveReport handles POST /api/admin/reports/:id/resolve - closes a report as
+// resolved or dismissed, optionally hiding the reported file from listings.
+func (s *Server) handleResolveReport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid report ID")
+		return
+	}
+
+	var req ResolveReportRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+	var fileID string
+	err = s.db.QueryRowContext(ctx, "SELECT file_id FROM file_reports WHERE id = ?", id).Scan(&fileID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "report not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = s.writeTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE file_reports SET status = ?, resolution = ?, resolved_at = CURRENT_TIMESTAMP WHERE id = ?",
+			req.Status, req.Note, id,
+		); err != nil {
+			return err
+		}
+
+		if !req.Hide {
+			return nil
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO file_visibility (file_id, hidden, reason, updated_at)
+			VALUES (?, 1, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(file_id) DO UPDATE SET hidden = 1, reason = excluded.reason, updated_at = excluded.updated_at
+		`, fileID, fmt.Sprintf("report %d", id))
+		return err
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if req.Hide {
+		s.invalidateVisibility(ctx)
+	}
+
+	detail := req.Status
+	if req.Hide {
+		detail += ", file hidden"
+	}
+	s.audit(r, "report.resolve", fileID, fmt.Sprintf("report %d: %s", id, detail))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":      id,
+		"status":  req.Status,
+		"hidden":  req.Hide,
+		"message": "report " + req.Status,
+	})
+}
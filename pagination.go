@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPageLimit is the page size of paginated listings when no limit is given.
+	DefaultPageLimit = 50
+
+	// sqliteTimeLayout is the format of SQLite CURRENT_TIMESTAMP values.
+	sqliteTimeLayout = "2006-01-02 15:04:05"
+)
+
+// PageQuery holds the pagination parameters of list endpoints. Cursor is the
+// next_cursor of the previous page; pages are ordered newest first.
+type PageQuery struct {
+	Cursor string `query:"cursor"`
+	Limit  int    `query:"limit" validate:"min=1,max=500"`
+
+	after     string // created_at of the last row of the previous page
+	afterID   int64
+	hasCursor bool
+}
+
+// encodeCursor returns an opaque cursor pointing after the row with the given timestamp and ID.
+func encodeCursor(createdAt time.Time, id int64) string {
+	raw := createdAt.UTC().Format(sqliteTimeLayout) + "|" + strconv.FormatInt(id, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a cursor produced by encodeCursor.
+func decodeCursor(cursor string) (string, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, err
+	}
+
+	createdAt, idStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return "", 0, errors.New("malformed cursor")
+	}
+	if _, err := time.Parse(sqliteTimeLayout, createdAt); err != nil {
+		return "", 0, err
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return "", 0, err
+	}
+	return createdAt, id, nil
+}
+
+// decodePage decodes the pagination parameters of a request.
+// On failure the error response is written and false is returned.
+func decodePage(w http.ResponseWriter, r *http.Request) (PageQuery, bool) {
+	q := PageQuery{Limit: DefaultPageLimit}
+	if !decodeQuery(w, r, &q) {
+		return q, false
+	}
+
+	if q.Cursor != "" {
+		after, afterID, err := decodeCursor(q.Cursor)
+		if err != nil {
+			writeValidationError(w, FieldError{Field: "cursor", Message: "is invalid"})
+			return q, false
+		}
+		q.after, q.afterID, q.hasCursor = after, afterID, true
+	}
+	return q, true
+}
+
+// keyset returns a WHERE clause (possibly empty) and its arguments selecting the
+// rows after the cursor, for a table ordered by timeColumn DESC, id DESC.
+func (q PageQuery) keyset(timeColumn string) (string, []any) {
+	if !q.hasCursor {
+		return "", nil
+	}
+	return "WHERE (" + timeColumn + ", id) < (?, ?)", []any{q.after, q.afterID}
+}
+
+// paginate trims rows, fetched with a limit of q.Limit+1, to one page and returns
+// the cursor of the next page, or "" if this is the last page.
+func paginate[T any](rows []T, q PageQuery, key func(T) (time.Time, int64)) ([]T, string) {
+	if len(rows) <= q.Limit {
+		return rows, ""
+	}
+
+	rows = rows[:q.Limit]
+	createdAt, id := key(rows[len(rows)-1])
+	return rows, encodeCursor(createdAt, id)
+}
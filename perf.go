@@ -0,0 +1,123 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	// perfWindow is the sliding window over which handler latencies are reported.
+	perfWindow = 5 * time.Minute
+
+	// perfMaxSamples is the number of latency samples kept per route. Busy routes report
+	// on their most recent requests only.
+	perfMaxSamples = 2048
+)
+
+// RouteLatency reports the latency and error rate of a route over the sliding window.
+type RouteLatency struct {
+	Route     string  `json:"route"`
+	Requests  int     `json:"requests"`
+	Errors    int     `json:"errors"` // Responses with a 5xx status
+	ErrorRate float64 `json:"error_rate"`
+	P50       float64 `json:"p50_ms"`
+	P95       float64 `json:"p95_ms"`
+	P99       float64 `json:"p99_ms"`
+	Max       float64 `json:"max_ms"`
+}
+
+// latencySample is the outcome of one request.
+type latencySample struct {
+	at      time.Time
+	elapsed time.Duration
+	failed  bool
+}
+
+// latencyWindow is a ring buffer of a route's most recent latency samples.
+type latencyWindow struct {
+	samples []latencySample
+	next    int
+}
+
+// add records a sample, overwriting the oldest once the buffer is full.
+func (lw *latencyWindow) add(sample latencySample) {
+	if len(lw.samples) < perfMaxSamples {
+		lw.samples = append(lw.samples, sample)
+		return
+	}
+	lw.samples[lw.next] = sample
+	lw.next = (lw.next + 1) % perfMaxSamples
+}
+
+// stats summarizes the samples taken after since. ok is false when there are none.
+func (lw *latencyWindow) stats(route string, since time.Time) (stats RouteLatency, ok bool) {
+	stats.Route = route
+	durations := make([]time.Duration, 0, len(lw.samples))
+	for _, s := range lw.samples {
+		if s.at.Before(since) {
+			continue
+		}
+		durations = append(durations, s.elapsed)
+		if s.failed {
+			stats.Errors++
+		}
+	}
+	if len(durations) == 0 {
+		return stats, false
+	}
+
+	slices.Sort(durations)
+	stats.Requests = len(durations)
+	stats.ErrorRate = float64(stats.Errors) / float64(stats.Requests)
+	stats.P50 = percentile(durations, 0.50)
+	stats.P95 = percentile(durations, 0.95)
+	stats.P99 = percentile(durations, 0.99)
+	stats.Max = milliseconds(durations[len(durations)-1])
+	return stats, true
+}
+
+// percentile returns the nearest-rank percentile p of sorted durations in milliseconds.
+func percentile(sorted []time.Duration, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return milliseconds(sorted[max(rank, 0)])
+}
+
+// milliseconds converts d to fractional milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// latencies returns the latency of every route served within the window, slowest first.
+func (m *apiMetrics) latencies() []RouteLatency {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	since := time.Now().Add(-perfWindow)
+	routes := make([]RouteLatency, 0, len(m.latency))
+	for route, lw := range m.latency {
+		if stats, ok := lw.stats(route, since); ok {
+			routes = append(routes, stats)
+		}
+	}
+	slices.SortFunc(routes, func(a, b RouteLatency) int {
+		return cmp.Or(cmp.Compare(b.P95, a.P95), cmp.Compare(a.Route, b.Route))
+	})
+	return routes
+}
+
+// handleGetPerf handles GET /api/admin/perf - returns p50/p95/p99 latencies and error
+// rates per route over the last five minutes, for deployments without Prometheus.
+func (s *Server) handleGetPerf(w http.ResponseWriter, r *http.Request) {
+	routes := s.metrics.latencies()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"window": perfWindow.String(),
+		"routes": routes,
+		"count":  len(routes),
+	})
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/drive/v3"
+)
+
+// pickerStateKeyPrefix prefixes the Redis keys holding pending Drive connection states.
+const pickerStateKeyPrefix = "gdrive:picker:state:"
+
+// PickerConfig configures the Google Picker used to choose files from a user's own Drive.
+type PickerConfig struct {
+	ClientID     string // OAuth client of the Google Cloud project; the picker is disabled when empty
+	ClientSecret string
+	APIKey       string // Browser API key enabled for the Picker API
+	AppID        string // Google Cloud project number
+}
+
+// PickerToken is a short-lived access token for the Google Picker.
+type PickerToken struct {
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Scope       string    `json:"scope"`
+	ClientID    string    `json:"client_id"`
+	APIKey      string    `json:"api_key"`
+	AppID       string    `json:"app_id"`
+}
+
+// loadPickerConfig reads the Google Picker settings from the environment.
+func loadPickerConfig() PickerConfig {
+	return PickerConfig{
+		ClientID:     os.Getenv("PICKER_CLIENT_ID"),
+		ClientSecret: os.Getenv("PICKER_CLIENT_SECRET"),
+		APIKey:       os.Getenv("PICKER_API_KEY"),
+		AppID:        os.Getenv("PICKER_APP_ID"),
+	}
+}
+
+// pickerOAuth returns the OAuth configuration of Drive connections. The drive.file
+// scope only grants access to the files a user picks.
+func (s *Server) pickerOAuth() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     s.cfg.Picker.ClientID,
+		ClientSecret: s.cfg.Picker.ClientSecret,
+		RedirectURL:  strings.TrimSuffix(s.cfg.PublicURL, "/") + "/api/me/picker/callback",
+		Scopes:       []string{drive.DriveFileScope},
+		Endpoint:     google.Endpoint,
+	}
+}
+
+// handlePickerConnect handles GET /api/me/picker/connect - redirects the signed-in
+// user to Google to allow the library to open the picker on their Drive.
+func (s *Server) handlePickerConnect(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.Picker.ClientID == "" {
+		writeError(w, http.StatusNotImplemented, "the Drive picker is not enabled")
+		return
+	}
+
+	user := userFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+
+	state := randomToken()
+	if err := s.redis.Set(r.Context(), pickerStateKeyPrefix+state, user.ID, oauthStateTTL).Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Offline access with forced consent, so Google returns a refresh token
+	url := s.pickerOAuth().AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce)
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// handlePickerCallback handles GET /api/me/picker/callback - stores the refresh token
+// of a Drive connection and returns to the frontend.
+func (s *Server) handlePickerCallback(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.Picker.ClientID == "" {
+		writeError(w, http.StatusNotImplemented, "the Drive picker is not enabled")
+		return
+	}
+
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		writeError(w, http.StatusUnauthorized, "Drive connection failed: "+e)
+		return
+	}
+
+	// States are single use and bound to the user who started the connection
+	ctx := r.Context()
+	userID, err := s.redis.GetDel(ctx, pickerStateKeyPrefix+query.Get("state")).Int64()
+	user := userFromContext(ctx)
+	if err != nil || user == nil || user.ID != userID {
+		writeError(w, http.StatusBadRequest, "invalid or expired connection state")
+		return
+	}
+
+	token, err := s.pickerOAuth().Exchange(ctx, query.Get("code"))
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unable to exchange code: "+err.Error())
+		return
+	}
+	if token.RefreshToken == "" {
+		writeError(w, http.StatusBadGateway, "Google did not return a refresh token")
+		return
+	}
+
+	_, err = s.execWrite(ctx, `
+		INSERT INTO picker_tokens (user_id, refresh_token, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id) DO UPDATE SET refresh_token = excluded.refresh_token, updated_at = excluded.updated_at
+	`, user.ID, token.RefreshToken)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// handlePickerToken handles GET /api/me/picker/token - mints a short-lived access token
+// for opening the Google Picker on the signed-in user's Drive. Responds 409 with the
+// code drive_not_connected when the user has not connected their Drive yet.
+func (s *Server) handlePickerToken(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.Picker.ClientID == "" {
+		writeError(w, http.StatusNotImplemented, "the Drive picker is not enabled")
+		return
+	}
+
+	ctx := r.Context()
+	user := userFromContext(ctx)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+
+	var refreshToken string
+	err := s.db.QueryRowContext(ctx, "SELECT refresh_token FROM picker_tokens WHERE user_id = ?", user.ID).Scan(&refreshToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		writePickerNotConnected(w)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	token, err := s.pickerOAuth().TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant" {
+		// The user revoked access, so the grant has to be renewed
+		if _, err := s.execWrite(ctx, "DELETE FROM picker_tokens WHERE user_id = ?", user.ID); err != nil {
+			logf(ctx, "Warning: unable to remove picker token of user %d: %v", user.ID, err)
+		}
+		writePickerNotConnected(w)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "unable to refresh Drive access: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(PickerToken{
+		AccessToken: token.AccessToken,
+		ExpiresAt:   token.Expiry,
+		Scope:       drive.DriveFileScope,
+		ClientID:    s.cfg.Picker.ClientID,
+		APIKey:      s.cfg.Picker.APIKey,
+		AppID:       s.cfg.Picker.AppID,
+	})
+}
+
+// writePickerNotConnected responds 409, pointing to the URL connecting the user's Drive.
+func writePickerNotConnected(w http.ResponseWriter) {
+	writeAPIError(w, http.StatusConflict, APIError{
+		Code:    "drive_not_connected",
+		Message: "connect your Drive at /api/me/picker/connect first",
+	})
+}
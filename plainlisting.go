@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	textTemplate "text/template"
+
+	"github.com/abiiranathan/gdrive"
+)
+
+// defaultPlainPageSize is the number of files per page of the plain listings.
+const defaultPlainPageSize = 100
+
+// PlainListingQuery holds the query parameters of GET /catalog.txt and /catalog.html.
+type PlainListingQuery struct {
+	Page  int    `query:"page" validate:"min=1"`
+	Limit int    `query:"limit" validate:"min=1,max=500"`
+	Q     string `query:"q" validate:"max=200"`
+}
+
+// PlainEntry is a file on a page of the plain listings.
+type PlainEntry struct {
+	Name        string
+	Folder      string
+	Size        int64
+	DownloadURL string
+}
+
+// PlainPage is the data rendered into a page of the plain listings.
+type PlainPage struct {
+	Query   string
+	Page    int
+	Pages   int
+	Total   int
+	Files   []PlainEntry
+	PrevURL string
+	NextURL string
+}
+
+// plainTextTemplate renders /catalog.txt.
+var plainTextTemplate = textTemplate.Must(textTemplate.New("catalog.txt").Funcs(textTemplate.FuncMap{
+	"bytes": formatBytes,
+}).Parse(`E-Library catalog - page {{.Page}} of {{.Pages}} ({{.Total}} files{{if .Query}} matching "{{.Query}}"{{end}})
+
+{{range .Files}}{{.Name}}
+  Folder: {{.Folder}}
+  Size: {{bytes .Size}}
+  Download: {{.DownloadURL}}
+
+{{else}}No files.
+
+{{end}}
+{{- if .PrevURL}}Previous page: {{.PrevURL}}
+{{end}}
+{{- if .NextURL}}Next page: {{.NextURL}}
+{{end}}`))
+
+// plainHTMLTemplate renders /catalog.html as a single list without scripts or
+// styles, so it stays light and reads linearly in screen readers.
+var plainHTMLTemplate = template.Must(template.New("catalog.html").Funcs(template.FuncMap{
+	"bytes": formatBytes,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>E-Library catalog, page {{.Page}} of {{.Pages}}</title>
+</head>
+<body>
+<main>
+<h1>E-Library catalog</h1>
+<form action="catalog.html" method="get" role="search">
+<label for="q">Search files</label>
+<input id="q" name="q" type="search" value="{{.Query}}">
+<button type="submit">Search</button>
+</form>
+<p>Page {{.Page}} of {{.Pages}}, {{.Total}} files{{if .Query}} matching &ldquo;{{.Query}}&rdquo;{{end}}.</p>
+{{if .Files}}<ul>
+{{- range .Files}}
+<li><a href="{{.DownloadURL}}">{{.Name}}</a>, {{bytes .Size}}, in {{.Folder}}</li>
+{{- end}}
+</ul>{{else}}<p>No files.</p>{{end}}
+<nav aria-label="Pages">
+{{- if .PrevURL}} <a href="{{.PrevURL}}" rel="prev">Previous page</a>{{end}}
+{{- if .NextURL}} <a href="{{.NextURL}}" rel="next">Next page</a>{{end}}
+</nav>
+</main>
+</body>
+</html>
+`))
+
+// plainPage builds one page of the plain listings from the cached index.
+// Page links are relative to path, e.g. "/catalog.txt".
+func (s *Server) plainPage(r *http.Request, q PlainListingQuery, path string) (*PlainPage, error) {
+	files, err := s.getFiles(r.Context(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	overlay, err := s.loadOverlay(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	// The cached listing is shared, so it is filtered and sorted in a copy
+	files = applyOverlay(files, overlay, func(f gdrive.FileInfo) string { return f.ID })
+	if q.Q != "" {
+		needle := strings.ToLower(q.Q)
+		files = slices.DeleteFunc(files, func(f gdrive.FileInfo) bool {
+			return !strings.Contains(strings.ToLower(f.Name), needle)
+		})
+	}
+	c := s.collator()
+	slices.SortFunc(files, func(a, b gdrive.FileInfo) int {
+		return compareNames(c, a.FolderPath, a.Name, b.FolderPath, b.Name)
+	})
+
+	page := &PlainPage{
+		Query: q.Q,
+		Page:  q.Page,
+		Pages: max((len(files)+q.Limit-1)/q.Limit, 1),
+		Total: len(files),
+		Files: make([]PlainEntry, 0, q.Limit),
+	}
+
+	// Links use the configured public URL, which holds behind TLS-terminating proxies
+	// and cannot be spoofed with the Host header
+	base := strings.TrimSuffix(s.cfg.PublicURL, "/")
+
+	start := min((q.Page-1)*q.Limit, len(files))
+	end := min(start+q.Limit, len(files))
+	for _, f := range files[start:end] {
+		page.Files = append(page.Files, PlainEntry{
+			Name:        f.Name,
+			Folder:      f.FolderPath,
+			Size:        f.Size,
+			DownloadURL: base + "/api/files/" + url.PathEscape(f.ID) + "/download",
+		})
+	}
+
+	pageURL := func(n int) string {
+		v := url.Values{"page": {fmt.Sprint(n)}}
+		if q.Limit != defaultPlainPageSize {
+			v.Set("limit", fmt.Sprint(q.Limit))
+		}
+		if q.Q != "" {
+			v.Set("q", q.Q)
+		}
+		return base + path + "?" + v.Encode()
+	}
+	if q.Page > 1 {
+		page.PrevURL = pageURL(min(q.Page-1, page.Pages))
+	}
+	if q.Page < page.Pages {
+		page.NextURL = pageURL(q.Page + 1)
+	}
+	return page, nil
+}
+
+// handlePlainCatalog handles GET /catalog.txt and GET /catalog.html - server-rendered
+// listings of the library for low-bandwidth clients and screen readers, paginated
+// with ?page= and ?limit= and filtered by name with ?q=.
+func (s *Server) handlePlainCatalog(w http.ResponseWriter, r *http.Request) {
+	q := PlainListingQuery{Page: 1, Limit: defaultPlainPageSize}
+	if !decodeQuery(w, r, &q) {
+		return
+	}
+
+	page, err := s.plainPage(r, q, r.URL.Path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var buf strings.Builder
+	if strings.HasSuffix(r.URL.Path, ".txt") {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		err = plainTextTemplate.Execute(&buf, page)
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = plainHTMLTemplate.Execute(&buf, page)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Write([]byte(buf.String()))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+const (
+	// LiteFilesCacheKey is the Redis key for the cached lite file list.
+	LiteFilesCacheKey = "gdrive:files:lite"
+
+	// LiteCacheTimestampKey is the Redis key for the lite cache timestamp.
+	LiteCacheTimestampKey = "gdrive:files:lite:timestamp"
+)
+
+// ListProfile selects which file fields a listing includes.
+type ListProfile string
+
+const (
+	// ProfileFull includes every field, including web links, parents and folder paths.
+	ProfileFull ListProfile = "full"
+
+	// ProfileLite includes only the ID, name, MIME type and size. It is fetched without
+	// resolving folder paths, so it is smaller to cache and faster to refresh.
+	ProfileLite ListProfile = "lite"
+)
+
+// parseListProfile validates a LIST_PROFILE value.
+func parseListProfile(v string) (ListProfile, error) {
+	switch profile := ListProfile(v); profile {
+	case ProfileFull, ProfileLite:
+		return profile, nil
+	default:
+		return "", fmt.Errorf("invalid list profile %q: must be full or lite", v)
+	}
+}
+
+// LiteFileInfo is a file in the lite listing profile. Field names match
+// gdrive.FileInfo so clients can read both profiles the same way.
+type LiteFileInfo struct {
+	ID       string
+	Name     string
+	MimeType string
+	Size     int64
+}
+
+// getLiteFiles returns the lite file listing from the Redis cache, deriving it from
+// a fresh full listing when one is cached, or fetching it from Drive otherwise.
+func (s *Server) getLiteFiles(ctx context.Context, forceRefresh bool) ([]LiteFileInfo, error) {
+	if !forceRefresh {
+		data, err := s.redis.Get(ctx, LiteFilesCacheKey).Bytes()
+		if err == nil {
+			var files []LiteFileInfo
+			if err := unmarshalCache(data, &files); err == nil {
+				logf(ctx, "Serving lite listing from cache")
+				return files, nil
+			}
+		}
+
+		// A cached full listing already has every lite field
+		if s.redis.Exists(ctx, FilesListCacheKey).Val() > 0 {
+			full, err := s.getFiles(ctx, false)
+			if err != nil {
+				return nil, err
+			}
+
+			files := make([]LiteFileInfo, len(full))
+			for i, f := range full {
+				files[i] = LiteFileInfo{ID: f.ID, Name: f.Name, MimeType: f.MimeType, Size: f.Size}
+			}
+			timestamp, _ := s.redis.Get(ctx, CacheTimestampKey).Int64()
+			s.cacheLiteFiles(ctx, files, time.Unix(timestamp, 0))
+			return files, nil
+		}
+	}
+
+	logf(ctx, "Fetching lite listing from Google Drive API...")
+	files := make([]LiteFileInfo, 0)
+	err := s.driveService.Files.List().
+		Context(ctx).
+		Q("mimeType != 'application/vnd.google-apps.folder'").
+		PageSize(1000).
+		Fields("nextPageToken, files(id, name, mimeType, size)").
+		Pages(ctx, func(page *drive.FileList) error {
+			for _, f := range page.Files {
+				// Skip zero-byte files, as the full listing does, unless they are enabled Google-native files
+				if _, native := s.cfg.WorkspaceTypes[f.MimeType]; f.Size == 0 && !native {
+					continue
+				}
+				files = append(files, LiteFileInfo{ID: f.Id, Name: f.Name, MimeType: f.MimeType, Size: f.Size})
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list files: %w", err)
+	}
+
+	logf(ctx, "Fetched %d files from Google Drive", len(files))
+	s.cacheLiteFiles(ctx, files, time.Now())
+	return files, nil
+}
+
+// cacheLiteFiles stores the lite listing fetched at fetchedAt in Redis, with the
+// same expiration as the full listing.
+func (s *Server) cacheLiteFiles(ctx context.Context, files []LiteFileInfo, fetchedAt time.Time) {
+	data, err := marshalCache(files)
+	if err != nil {
+		logf(ctx, "Warning: Failed to marshal lite files for caching: %v", err)
+		return
+	}
+
+	if err := s.redis.Set(ctx, LiteFilesCacheKey, data, CacheExpiration).Err(); err != nil {
+		logf(ctx, "Warning: Failed to cache lite files list: %v", err)
+	}
+	if err := s.redis.Set(ctx, LiteCacheTimestampKey, fetchedAt.Unix(), CacheExpiration).Err(); err != nil {
+		logf(ctx, "Warning: Failed to cache lite timestamp: %v", err)
+	}
+}
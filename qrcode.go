@@ -0,0 +1,445 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// qrVersion describes the level M block structure of a QR code version.
+type qrVersion struct {
+	ecPerBlock int       // Error correction codewords per block
+	blocks     [2][2]int // {count, data codewords} for each block group
+	alignment  []int     // Alignment pattern center coordinates
+}
+
+// qrVersions holds versions 1-10 at error correction level M, which is
+// enough for share URLs of up to 213 bytes.
+var qrVersions = []qrVersion{
+	{10, [2][2]int{{1, 16}}, nil},
+	{16, [2][2]int{{1, 28}}, []int{6, 18}},
+	{26, [2][2]int{{1, 44}}, []int{6, 22}},
+	{18, [2][2]int{{2, 32}}, []int{6, 26}},
+	{24, [2][2]int{{2, 43}}, []int{6, 30}},
+	{16, [2][2]int{{4, 27}}, []int{6, 34}},
+	{18, [2][2]int{{4, 31}}, []int{6, 22, 38}},
+	{22, [2][2]int{{2, 38}, {2, 39}}, []int{6, 24, 42}},
+	{22, [2][2]int{{3, 36}, {2, 37}}, []int{6, 26, 46}},
+	{26, [2][2]int{{4, 43}, {1, 44}}, []int{6, 28, 50}},
+}
+
+// errQRTooLong is returned when the data does not fit in the largest supported version.
+var errQRTooLong = errors.New("data too long for QR code")
+
+// qrCode is an encoded QR code symbol.
+type qrCode struct {
+	size     int
+	modules  [][]bool // Dark modules, indexed [y][x]
+	function [][]bool // Modules reserved for function patterns
+}
+
+// encodeQR encodes data in byte mode at error correction level M,
+// choosing the smallest version that fits and the lowest-penalty mask.
+func encodeQR(data []byte) (*qrCode, error) {
+	version := 0
+	for v := range qrVersions {
+		countBits := 8
+		if v+1 >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= 8*qrVersions[v].dataCodewords() {
+			version = v + 1
+			break
+		}
+	}
+	if version == 0 {
+		return nil, errQRTooLong
+	}
+
+	info := qrVersions[version-1]
+	codewords := info.addErrorCorrection(info.encodeData(version, data))
+
+	size := 17 + 4*version
+	qr := &qrCode{size: size, modules: newGrid(size), function: newGrid(size)}
+	qr.drawFunctionPatterns(version, info)
+	qr.drawCodewords(codewords)
+
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		qr.applyMask(mask)
+		qr.drawFormatBits(mask)
+		if p := qr.penalty(); bestPenalty < 0 || p < bestPenalty {
+			bestMask, bestPenalty = mask, p
+		}
+		qr.applyMask(mask) // XOR again to undo
+	}
+	qr.applyMask(bestMask)
+	qr.drawFormatBits(bestMask)
+	return qr, nil
+}
+
+// dataCodewords returns the total number of data codewords of the version.
+func (v qrVersion) dataCodewords() int {
+	return v.blocks[0][0]*v.blocks[0][1] + v.blocks[1][0]*v.blocks[1][1]
+}
+
+// encodeData builds the padded data codeword sequence for byte mode.
+func (v qrVersion) encodeData(version int, data []byte) []byte {
+	var bits []bool
+	appendBits := func(val, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, (val>>i)&1 == 1)
+		}
+	}
+
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	appendBits(0b0100, 4)
+	appendBits(len(data), countBits)
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+
+	capacity := 8 * v.dataCodewords()
+	appendBits(0, min(4, capacity-len(bits)))
+	appendBits(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		appendBits(pad, 8)
+	}
+
+	out := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			out[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return out
+}
+
+// addErrorCorrection splits data into blocks, appends Reed-Solomon codewords
+// and interleaves the result.
+func (v qrVersion) addErrorCorrection(data []byte) []byte {
+	divisor := rsDivisor(v.ecPerBlock)
+
+	var dataBlocks, ecBlocks [][]byte
+	for _, group := range v.blocks {
+		for range group[0] {
+			block := data[:group[1]]
+			data = data[group[1]:]
+			dataBlocks = append(dataBlocks, block)
+			ecBlocks = append(ecBlocks, rsRemainder(block, divisor))
+		}
+	}
+
+	var out []byte
+	for i := 0; i < v.blocks[0][1] || i < v.blocks[1][1]; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				out = append(out, block[i])
+			}
+		}
+	}
+	for i := range v.ecPerBlock {
+		for _, block := range ecBlocks {
+			out = append(out, block[i])
+		}
+	}
+	return out
+}
+
+// drawFunctionPatterns draws finder, timing and alignment patterns and version
+// information, and reserves the format information areas.
+func (qr *qrCode) drawFunctionPatterns(version int, info qrVersion) {
+	for i := 0; i < qr.size; i++ {
+		qr.setFunction(6, i, i%2 == 0)
+		qr.setFunction(i, 6, i%2 == 0)
+	}
+
+	qr.drawFinder(3, 3)
+	qr.drawFinder(qr.size-4, 3)
+	qr.drawFinder(3, qr.size-4)
+
+	last := len(info.alignment) - 1
+	for i, x := range info.alignment {
+		for j, y := range info.alignment {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue // Overlaps a finder pattern
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					qr.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	qr.drawFormatBits(0) // Reserve the area; real bits are drawn after masking
+
+	if version >= 7 {
+		rem := version
+		for range 12 {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := version<<12 | rem
+		for i := range 18 {
+			bit := (bits>>i)&1 == 1
+			a, b := qr.size-11+i%3, i/3
+			qr.setFunction(a, b, bit)
+			qr.setFunction(b, a, bit)
+		}
+	}
+}
+
+// drawFinder draws a finder pattern and its separator centered at (cx, cy).
+func (qr *qrCode) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || x >= qr.size || y < 0 || y >= qr.size {
+				continue
+			}
+			d := max(abs(dx), abs(dy))
+			qr.setFunction(x, y, d != 2 && d != 4)
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the format information for level M and mask.
+func (qr *qrCode) drawFormatBits(mask int) {
+	data := 0<<3 | mask // Level M is encoded as 00
+	rem := data
+	for range 10 {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		qr.setFunction(8, i, bit(i))
+	}
+	qr.setFunction(8, 7, bit(6))
+	qr.setFunction(8, 8, bit(7))
+	qr.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		qr.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		qr.setFunction(qr.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		qr.setFunction(8, qr.size-15+i, bit(i))
+	}
+	qr.setFunction(8, qr.size-8, true) // Dark module
+}
+
+// drawCodewords places the codewords in the zigzag pattern over non-function modules.
+func (qr *qrCode) drawCodewords(codewords []byte) {
+	i := 0
+	for right := qr.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // Skip the vertical timing pattern
+		}
+		for vert := 0; vert < qr.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = qr.size - 1 - vert // Upward column
+				}
+				if !qr.function[y][x] && i < len(codewords)*8 {
+					qr.modules[y][x] = (codewords[i/8]>>(7-i%8))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask XORs the data modules with the given mask pattern.
+func (qr *qrCode) applyMask(mask int) {
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			if qr.function[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			qr.modules[y][x] = qr.modules[y][x] != invert
+		}
+	}
+}
+
+// penalty scores the symbol using the four QR specification penalty rules.
+func (qr *qrCode) penalty() int {
+	score, dark := 0, 0
+	finderA := []bool{true, false, true, true, true, false, true, false, false, false, false}
+	finderB := []bool{false, false, false, false, true, false, true, true, true, false, true}
+
+	at := func(x, y int, horizontal bool) bool {
+		if horizontal {
+			return qr.modules[y][x]
+		}
+		return qr.modules[x][y]
+	}
+
+	for _, horizontal := range []bool{true, false} {
+		for y := 0; y < qr.size; y++ {
+			run := 1
+			for x := 1; x < qr.size; x++ {
+				if at(x, y, horizontal) == at(x-1, y, horizontal) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += run - 2
+				}
+				run = 1
+			}
+			if run >= 5 {
+				score += run - 2
+			}
+
+			for x := 0; x+len(finderA) <= qr.size; x++ {
+				matchA, matchB := true, true
+				for k := range finderA {
+					m := at(x+k, y, horizontal)
+					matchA = matchA && m == finderA[k]
+					matchB = matchB && m == finderB[k]
+				}
+				if matchA || matchB {
+					score += 40
+				}
+			}
+		}
+	}
+
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			if qr.modules[y][x] {
+				dark++
+			}
+			if x > 0 && y > 0 {
+				c := qr.modules[y][x]
+				if c == qr.modules[y-1][x] && c == qr.modules[y][x-1] && c == qr.modules[y-1][x-1] {
+					score += 3
+				}
+			}
+		}
+	}
+
+	total := qr.size * qr.size
+	score += abs(dark*20-total*10) / total * 10
+	return score
+}
+
+// setFunction sets a module and marks it as part of a function pattern.
+func (qr *qrCode) setFunction(x, y int, dark bool) {
+	qr.modules[y][x] = dark
+	qr.function[y][x] = true
+}
+
+// writePNG renders the symbol as a PNG with the given pixels per module
+// and the standard four-module quiet zone.
+func (qr *qrCode) writePNG(w io.Writer, scale int) error {
+	const quiet = 4
+	dim := (qr.size + 2*quiet) * scale
+	img := image.NewGray(image.Rect(0, 0, dim, dim))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			if !qr.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray((x+quiet)*scale+dx, (y+quiet)*scale+dy, color.Gray{Y: 0})
+				}
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// rsDivisor returns the Reed-Solomon generator polynomial of the given degree,
+// without its leading coefficient.
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for range degree {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder returns the Reed-Solomon error correction codewords of data.
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= gfMul(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+// gfMul multiplies two elements of GF(2^8) modulo the QR polynomial 0x11D.
+func gfMul(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+// newGrid allocates a size×size boolean grid.
+func newGrid(size int) [][]bool {
+	grid := make([][]bool, size)
+	for i := range grid {
+		grid[i] = make([]bool, size)
+	}
+	return grid
+}
+
+// abs returns the absolute value of x.
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// Reference values from ISO/IEC 18004 used to check the encoder independently of its
+// own tables and arithmetic.
+var (
+	// qrTestFormatM is the masked 15-bit format information for level M, per mask (Annex C).
+	qrTestFormatM = [8]int{0x5412, 0x5125, 0x5E7C, 0x5B4B, 0x45F9, 0x40CE, 0x4F97, 0x4AA0}
+
+	// qrTestVersionInfo is the 18-bit version information for versions 7-10 (Annex D).
+	qrTestVersionInfo = map[int]int{7: 0x07C94, 8: 0x085BC, 9: 0x09A99, 10: 0x0A4D3}
+
+	// qrTestTotalCodewords is the number of codewords of versions 1-10 (Table 1).
+	qrTestTotalCodewords = []int{26, 44, 70, 100, 134, 172, 196, 242, 292, 346}
+
+	// qrTestRemainderBits is the number of remainder bits of versions 1-10 (Table 1).
+	qrTestRemainderBits = []int{0, 7, 7, 7, 7, 7, 0, 0, 0, 0}
+
+	// qrTestAlignment holds the alignment pattern centers of versions 2-10 (Annex E).
+	qrTestAlignment = [][]int{nil, {6, 18}, {6, 22}, {6, 26}, {6, 30}, {6, 34}, {6, 22, 38}, {6, 24, 42}, {6, 26, 46}, {6, 28, 50}}
+
+	// qrTestBlocksM lists {count, data codewords, EC codewords} per block group at level M (Table 9).
+	qrTestBlocksM = [][][3]int{
+		{{1, 16, 10}},
+		{{1, 28, 16}},
+		{{1, 44, 26}},
+		{{2, 32, 18}},
+		{{2, 43, 24}},
+		{{4, 27, 16}},
+		{{4, 31, 18}},
+		{{2, 38, 22}, {2, 39, 22}},
+		{{3, 36, 22}, {2, 37, 22}},
+		{{4, 43, 26}, {1, 44, 26}},
+	}
+)
+
+func TestRSRemainder(t *testing.T) {
+	// The "HELLO WORLD" 1-M example of the specification
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	if got := rsRemainder(data, rsDivisor(len(want))); !bytes.Equal(got, want) {
+		t.Errorf("rsRemainder = %v, want %v", got, want)
+	}
+}
+
+func TestEncodeData(t *testing.T) {
+	// Mode 0100, count 00000001, "A" 01000001, terminator 0000, then pad codewords
+	want := []byte{0x40, 0x14, 0x10, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC}
+
+	if got := qrVersions[0].encodeData(1, []byte("A")); !bytes.Equal(got, want) {
+		t.Errorf("encodeData = % X, want % X", got, want)
+	}
+}
+
+func TestDrawFormatBits(t *testing.T) {
+	qr, err := encodeQR([]byte("format"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for mask, want := range qrTestFormatM {
+		qr.drawFormatBits(mask)
+		first, second := qrTestReadFormat(qr)
+		if first != want || second != want {
+			t.Errorf("mask %d: format bits = %015b, %015b, want %015b", mask, first, second, want)
+		}
+	}
+}
+
+func TestEncodeQRVersion(t *testing.T) {
+	tests := []struct {
+		length  int
+		version int
+	}{
+		{1, 1}, {14, 1}, {15, 2}, {26, 2}, {27, 3}, {62, 4}, {106, 6},
+		{122, 7}, {123, 8}, {152, 8}, {180, 9}, {181, 10}, {213, 10},
+	}
+
+	for _, tt := range tests {
+		qr, err := encodeQR(bytes.Repeat([]byte("x"), tt.length))
+		if err != nil {
+			t.Errorf("%d bytes: %v", tt.length, err)
+			continue
+		}
+		if got := (qr.size - 17) / 4; got != tt.version {
+			t.Errorf("%d bytes: version %d, want %d", tt.length, got, tt.version)
+		}
+	}
+
+	if _, err := encodeQR(bytes.Repeat([]byte("x"), 214)); !errors.Is(err, errQRTooLong) {
+		t.Errorf("214 bytes: error %v, want %v", err, errQRTooLong)
+	}
+}
+
+// TestEncodeQRDecode decodes symbols of several versions with a decoder written
+// from the specification and checks that the payload and error correction survive.
+func TestEncodeQRDecode(t *testing.T) {
+	payloads := []string{
+		"https://library.example/s/a",
+		strings.Repeat("0123456789", 4),
+		"https://library.example/s/" + strings.Repeat("Ab3_-", 15),
+		strings.Repeat("mixed CASE text, with punctuation! ", 4),
+		"https://library.example/s/" + strings.Repeat("k", 150),
+		strings.Repeat("\x00\xff", 106),
+	}
+
+	for _, payload := range payloads {
+		qr, err := encodeQR([]byte(payload))
+		if err != nil {
+			t.Errorf("%d bytes: %v", len(payload), err)
+			continue
+		}
+
+		got, err := qrTestDecode(qr)
+		if err != nil {
+			t.Errorf("%d bytes (version %d): %v", len(payload), (qr.size-17)/4, err)
+			continue
+		}
+		if got != payload {
+			t.Errorf("%d bytes: decoded %q, want %q", len(payload), got, payload)
+		}
+	}
+}
+
+func TestWritePNG(t *testing.T) {
+	qr, err := encodeQR([]byte("png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := qr.writePNG(&buf, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (qr.size + 8) * 3; img.Bounds().Dx() != want || img.Bounds().Dy() != want {
+		t.Errorf("image is %v, want %dx%d", img.Bounds().Size(), want, want)
+	}
+}
+
+// BenchmarkEncodeQR measures encoding a typical share link.
+func BenchmarkEncodeQR(b *testing.B) {
+	link := []byte("https://library.example/s/" + strings.Repeat("Ab3_-", 9))
+	for b.Loop() {
+		if _, err := encodeQR(link); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// qrTestReadFormat reads both copies of the format information of a symbol.
+func qrTestReadFormat(qr *qrCode) (first, second int) {
+	at := func(x, y int) int {
+		if qr.modules[y][x] {
+			return 1
+		}
+		return 0
+	}
+
+	for i := 0; i <= 5; i++ {
+		first |= at(8, i) << i
+	}
+	first |= at(8, 7)<<6 | at(8, 8)<<7 | at(7, 8)<<8
+	for i := 9; i < 15; i++ {
+		first |= at(14-i, 8) << i
+	}
+
+	for i := 0; i < 8; i++ {
+		second |= at(qr.size-1-i, 8) << i
+	}
+	for i := 8; i < 15; i++ {
+		second |= at(8, qr.size-15+i) << i
+	}
+	return first, second
+}
+
+// qrTestFunctionModules returns the function pattern modules of a version.
+func qrTestFunctionModules(version int) [][]bool {
+	size := 17 + 4*version
+	function := newGrid(size)
+	fill := func(x0, y0, w, h int) {
+		for y := y0; y < y0+h; y++ {
+			for x := x0; x < x0+w; x++ {
+				function[y][x] = true
+			}
+		}
+	}
+
+	// Finder patterns with separators and format information
+	fill(0, 0, 9, 9)
+	fill(size-8, 0, 8, 9)
+	fill(0, size-8, 9, 8)
+	fill(6, 0, 1, size)
+	fill(0, 6, size, 1)
+
+	centers := qrTestAlignment[version-1]
+	for _, x := range centers {
+		for _, y := range centers {
+			inFinder := (x < 9 || x >= size-9) && y < 9 || x < 9 && y >= size-9
+			if !inFinder {
+				fill(x-2, y-2, 5, 5)
+			}
+		}
+	}
+
+	if version >= 7 {
+		fill(size-11, 0, 3, 6)
+		fill(0, size-11, 6, 3)
+	}
+	return function
+}
+
+// qrTestDecode decodes a level M, byte mode symbol and verifies its structure.
+func qrTestDecode(qr *qrCode) (string, error) {
+	size := qr.size
+	version := (size - 17) / 4
+	if version < 1 || version > 10 || size != 17+4*version {
+		return "", errors.New("invalid symbol size")
+	}
+
+	finder := func(x0, y0 int) bool {
+		for dy := range 7 {
+			for dx := range 7 {
+				d := max(abs(dx-3), abs(dy-3))
+				if qr.modules[y0+dy][x0+dx] != (d != 2) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	if !finder(0, 0) || !finder(size-7, 0) || !finder(0, size-7) {
+		return "", errors.New("finder pattern damaged")
+	}
+	for i := 8; i < size-8; i++ {
+		if qr.modules[6][i] != (i%2 == 0) || qr.modules[i][6] != (i%2 == 0) {
+			return "", errors.New("timing pattern damaged")
+		}
+	}
+	if !qr.modules[size-8][8] {
+		return "", errors.New("dark module missing")
+	}
+
+	first, second := qrTestReadFormat(qr)
+	if first != second {
+		return "", errors.New("format information copies differ")
+	}
+	mask := -1
+	for m, bits := range qrTestFormatM {
+		if bits == first {
+			mask = m
+		}
+	}
+	if mask < 0 {
+		return "", errors.New("format information is not level M")
+	}
+
+	if want, ok := qrTestVersionInfo[version]; ok {
+		var bottomLeft, topRight int
+		for i := range 18 {
+			if qr.modules[size-11+i%3][i/3] {
+				bottomLeft |= 1 << i
+			}
+			if qr.modules[i/3][size-11+i%3] {
+				topRight |= 1 << i
+			}
+		}
+		if bottomLeft != want || topRight != want {
+			return "", errors.New("version information damaged")
+		}
+	}
+
+	// Read the data modules in placement order and remove the mask
+	function := qrTestFunctionModules(version)
+	var bits []bool
+	upward := true
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // The vertical timing pattern is skipped
+		}
+		for vert := range size {
+			y := vert
+			if upward {
+				y = size - 1 - vert
+			}
+			for _, x := range []int{right, right - 1} {
+				if function[y][x] {
+					continue
+				}
+				masked := []bool{
+					(x+y)%2 == 0,
+					y%2 == 0,
+					x%3 == 0,
+					(x+y)%3 == 0,
+					(x/3+y/2)%2 == 0,
+					(x*y)%2+(x*y)%3 == 0,
+					((x*y)%2+(x*y)%3)%2 == 0,
+					((x+y)%2+(x*y)%3)%2 == 0,
+				}[mask]
+				bits = append(bits, qr.modules[y][x] != masked)
+			}
+		}
+		upward = !upward
+	}
+
+	total := qrTestTotalCodewords[version-1]
+	if len(bits) != 8*total+qrTestRemainderBits[version-1] {
+		return "", errors.New("wrong number of data modules")
+	}
+	codewords := make([]byte, total)
+	for i := range 8 * total {
+		if bits[i] {
+			codewords[i/8] |= 1 << (7 - i%8)
+		}
+	}
+
+	// De-interleave the blocks and check that every block is a Reed-Solomon codeword
+	var blocks [][]byte
+	var ecLen int
+	for _, group := range qrTestBlocksM[version-1] {
+		for range group[0] {
+			blocks = append(blocks, make([]byte, 0, group[1]+group[2]))
+		}
+		ecLen = group[2]
+	}
+	next := 0
+	for i := 0; ; i++ {
+		placed := false
+		for b := range blocks {
+			if data := qrTestBlockData(version, b); i < data {
+				blocks[b] = append(blocks[b], codewords[next])
+				next++
+				placed = true
+			}
+		}
+		if !placed {
+			break
+		}
+	}
+	var data []byte
+	for b := range blocks {
+		data = append(data, blocks[b]...)
+	}
+	for range ecLen {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], codewords[next])
+			next++
+		}
+	}
+	for b, block := range blocks {
+		if !qrTestSyndromesZero(block, ecLen) {
+			return "", fmt.Errorf("block %d fails error correction", b)
+		}
+	}
+
+	// Parse the byte mode segment
+	bitAt := func(i int) int { return int(data[i/8]>>(7-i%8)) & 1 }
+	read := func(pos, n int) int {
+		v := 0
+		for i := range n {
+			v = v<<1 | bitAt(pos+i)
+		}
+		return v
+	}
+	if read(0, 4) != 0b0100 {
+		return "", errors.New("not byte mode")
+	}
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	n := read(4, countBits)
+	if 4+countBits+8*n > 8*len(data) {
+		return "", errors.New("character count exceeds capacity")
+	}
+	out := make([]byte, n)
+	for i := range n {
+		out[i] = byte(read(4+countBits+8*i, 8))
+	}
+	return string(out), nil
+}
+
+// qrTestBlockData returns the number of data codewords of block b of a level M symbol.
+func qrTestBlockData(version, b int) int {
+	for _, group := range qrTestBlocksM[version-1] {
+		if b < group[0] {
+			return group[1]
+		}
+		b -= group[0]
+	}
+	return 0
+}
+
+// qrTestSyndromesZero reports whether a block evaluates to zero at the first ecLen
+// powers of the generator, i.e. has no detectable errors.
+func qrTestSyndromesZero(block []byte, ecLen int) bool {
+	var exp [255]byte
+	x := 1
+	for i := range exp {
+		exp[i] = byte(x)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	mul := func(a, b byte) byte {
+		var p byte
+		for b != 0 {
+			if b&1 == 1 {
+				p ^= a
+			}
+			carry := a&0x80 != 0
+			a <<= 1
+			if carry {
+				a ^= 0x1D
+			}
+			b >>= 1
+		}
+		return p
+	}
+
+	for i := range ecLen {
+		var s byte
+		for _, c := range block {
+			s = mul(s, exp[i]) ^ c
+		}
+		if s != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// QuotaConfig holds the per-user daily download limits. A zero limit is unlimited.
+type QuotaConfig struct {
+	DailyCount int   // Maximum downloads per user per UTC day
+	DailyBytes int64 // Maximum bytes downloaded per user per UTC day
+}
+
+// QuotaUsage is a user's download usage for the current UTC day.
+type QuotaUsage struct {
+	Count      int       `json:"count"`
+	Bytes      int64     `json:"bytes"`
+	LimitCount int       `json:"limit_count"` // 0 means unlimited
+	LimitBytes int64     `json:"limit_bytes"` // 0 means unlimited
+	Exempt     bool      `json:"exempt"`
+	ResetsAt   time.Time `json:"resets_at"`
+}
+
+// QuotaOverrideRequest represents a request to exempt a user from download limits.
+type QuotaOverrideRequest struct {
+	UserID int64  `json:"user_id" validate:"required"`
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+// quotaDay returns the start of the current UTC day and of the next one.
+func quotaDay() (time.Time, time.Time) {
+	start := time.Now().UTC().Truncate(24 * time.Hour)
+	return start, start.Add(24 * time.Hour)
+}
+
+// quotaUsage returns the download usage of userID for the current UTC day.
+func (s *Server) quotaUsage(ctx context.Context, userID int64) (*QuotaUsage, error) {
+	start, end := quotaDay()
+	usage := &QuotaUsage{
+		LimitCount: s.cfg.Quota.DailyCount,
+		LimitBytes: s.cfg.Quota.DailyBytes,
+		ResetsAt:   end,
+	}
+
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*), COALESCE(SUM(bytes), 0) FROM downloads WHERE user_id = ? AND downloaded_at >= ?",
+		userID, start,
+	).Scan(&usage.Count, &usage.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.QueryRowContext(ctx,
+		"SELECT 1 FROM quota_overrides WHERE user_id = ?", userID,
+	).Scan(new(int))
+	switch {
+	case err == nil:
+		usage.Exempt = true
+	case err != sql.ErrNoRows:
+		return nil, err
+	}
+	return usage, nil
+}
+
+// checkQuota reports whether the signed-in user may download size more bytes today,
+// responding 429 with Retry-After when a limit would be exceeded.
+// Anonymous downloads (public mode) and exempt users are not limited.
+func (s *Server) checkQuota(w http.ResponseWriter, r *http.Request, size int64) bool {
+	quota := s.cfg.Quota
+	user := userFromContext(r.Context())
+	if user == nil || (quota.DailyCount == 0 && quota.DailyBytes == 0) {
+		return true
+	}
+
+	usage, err := s.quotaUsage(r.Context(), user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+
+	if usage.Exempt {
+		return true
+	}
+
+	var reason string
+	switch {
+	case quota.DailyCount > 0 && usage.Count >= quota.DailyCount:
+		reason = fmt.Sprintf("daily download limit of %d files reached", quota.DailyCount)
+	case quota.DailyBytes > 0 && usage.Bytes+size > quota.DailyBytes:
+		reason = fmt.Sprintf("daily download limit of %s would be exceeded (%s used)",
+			formatBytes(quota.DailyBytes), formatBytes(usage.Bytes))
+	default:
+		return true
+	}
+
+	retryAfter := int(time.Until(usage.ResetsAt).Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeError(w, http.StatusTooManyRequests, reason+"; resets at "+usage.ResetsAt.Format(time.RFC3339))
+	return false
+}
+
+// handleGetQuota handles GET /api/me/quota - returns the signed-in user's download usage today.
+func (s *Server) handleGetQuota(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+
+	usage, err := s.quotaUsage(r.Context(), user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
+
+// handleListQuotaOverrides handles GET /api/admin/quota/overrides - lists users exempt from download limits.
+func (s *Server) handleListQuotaOverrides(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.Query(`
+		SELECT q.user_id, u.email, q.reason, q.created_at
+		FROM quota_overrides q
+		JOIN users u ON u.id = q.user_id
+		ORDER BY u.email
+	`)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	type Override struct {
+		UserID    int64     `json:"user_id"`
+		Email     string    `json:"email"`
+		Reason    string    `json:"reason"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	overrides := make([]Override, 0)
+	for rows.Next() {
+		var o Override
+		if err := rows.Scan(&o.UserID, &o.Email, &o.Reason, &o.CreatedAt); err != nil {
+			continue
+		}
+		overrides = append(overrides, o)
+	}
+
+	if rows.Err() != nil {
+		writeError(w, http.StatusInternalServerError, rows.Err().Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"overrides": overrides,
+		"count":     len(overrides),
+	})
+}
+
+// handleAddQuotaOverride handles POST /api/admin/quota/overrides - exempts a user from download limits.
+func (s *Server) handleAddQuotaOverride(w http.ResponseWriter, r *http.Request) {
+	var req QuotaOverrideRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if _, err := s.getUser(r.Context(), req.UserID); err != nil {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	_, err := s.execWrite(r.Context(), `
+		INSERT INTO quota_overrides (user_id, reason) VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET reason = excluded.reason
+	`, req.UserID, req.Reason)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.audit(r, "quota.override.add", "", strconv.FormatInt(req.UserID, 10))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "user exempted from download limits"})
+}
+
+// handleRemoveQuotaOverride handles DELETE /api/admin/quota/overrides/:userID - restores download limits for a user.
+func (s *Server) handleRemoveQuotaOverride(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user ID")
+		return
+	}
+
+	result, err := s.execWrite(r.Context(), "DELETE FROM quota_overrides WHERE user_id = ?", userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		writeError(w, http.StatusNotFound, "override not found")
+		return
+	}
+
+	s.audit(r, "quota.override.remove", "", strconv.FormatInt(userID, 10))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "override removed"})
+}
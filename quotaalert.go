@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abiiranathan/gdrive"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// QuotaAlertInterval is how often the Drive storage quota is checked.
+	QuotaAlertInterval = time.Hour
+
+	// quotaAlertKey is the Redis key set while an alert for the exceeded threshold is
+	// active, so admins are alerted once a day rather than on every check.
+	quotaAlertKey = "gdrive:storage:alerted"
+
+	// quotaHousekeepingKey is the Redis key holding the results of the housekeeping run
+	// for the active alert, so a failed alert is retried without running it again.
+	quotaHousekeepingKey = "gdrive:storage:housekeeping"
+
+	// housekeepingTrashedKey is the Redis key for the set of duplicates trashed by
+	// housekeeping, the only files it ever deletes permanently.
+	housekeepingTrashedKey = "gdrive:housekeeping:trashed"
+
+	// quotaAlertRepeat is how long an alert is not repeated while usage stays high.
+	quotaAlertRepeat = 24 * time.Hour
+
+	// emptyFileChecksum is the MD5 checksum of empty content, shared by unrelated empty files.
+	emptyFileChecksum = "d41d8cd98f00b204e9800998ecf8427e"
+)
+
+// Housekeeping actions run when Drive storage exceeds the alert threshold.
+const (
+	housekeepingEmptyTrash       = "empty-trash"       // Permanently delete duplicates trashed by housekeeping
+	housekeepingRemoveDuplicates = "remove-duplicates" // Trash files whose content is listed elsewhere
+)
+
+// alertClient delivers storage alerts. Unlike subscription webhooks, the alert URL is
+// set by the operator and may point to an internal service.
+var alertClient = &http.Client{Timeout: 10 * time.Second}
+
+// QuotaAlertConfig configures alerts when Drive storage runs low.
+type QuotaAlertConfig struct {
+	Percent      int64    // Usage of the storage quota, in percent, triggering alerts; disabled when zero
+	Emails       []string // Addresses alerted by email
+	WebhookURL   string   // URL receiving alerts as JSON
+	Housekeeping []string // Housekeeping actions run when the threshold is exceeded, in order
+	Apply        bool     // Whether housekeeping changes files; otherwise it only reports what it would do
+}
+
+// QuotaAlert is the alert sent when Drive storage exceeds the threshold.
+type QuotaAlert struct {
+	Type         string               `json:"type"` // Always "quota.exceeded"
+	Usage        int64                `json:"usage"`
+	Limit        int64                `json:"limit"`
+	Percent      float64              `json:"percent"`
+	Threshold    int64                `json:"threshold"`
+	Housekeeping []HousekeepingResult `json:"housekeeping,omitempty"`
+	Time         time.Time            `json:"time"`
+}
+
+// HousekeepingResult reports the outcome of a housekeeping action. In a dry run, the
+// counts are of the files that would have been trashed or deleted.
+type HousekeepingResult struct {
+	Action  string `json:"action"`
+	DryRun  bool   `json:"dry_run,omitempty"`
+	Trashed int    `json:"trashed,omitempty"` // Duplicate files moved to the trash
+	Deleted int    `json:"deleted,omitempty"` // Trashed duplicates deleted permanently
+	Error   string `json:"error,omitempty"`
+}
+
+// loadQuotaAlertConfig reads the storage alert settings from the environment.
+func loadQuotaAlertConfig() (QuotaAlertConfig, error) {
+	cfg := QuotaAlertConfig{WebhookURL: os.Getenv("QUOTA_ALERT_WEBHOOK")}
+	if v := os.Getenv("QUOTA_ALERT_PERCENT"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 || n > 100 {
+			return cfg, fmt.Errorf("invalid QUOTA_ALERT_PERCENT %q: must be between 0 and 100", v)
+		}
+		cfg.Percent = n
+	}
+	if v := os.Getenv("QUOTA_HOUSEKEEPING_APPLY"); v != "" {
+		apply, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid QUOTA_HOUSEKEEPING_APPLY %q: must be true or false", v)
+		}
+		cfg.Apply = apply
+	}
+
+	for email := range strings.SplitSeq(os.Getenv("QUOTA_ALERT_EMAIL"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			cfg.Emails = append(cfg.Emails, email)
+		}
+	}
+
+	actions := make(map[string]bool)
+	for action := range strings.SplitSeq(os.Getenv("QUOTA_HOUSEKEEPING"), ",") {
+		action = strings.TrimSpace(action)
+		switch action {
+		case "":
+		case housekeepingEmptyTrash, housekeepingRemoveDuplicates:
+			actions[action] = true
+		default:
+			return cfg, fmt.Errorf("invalid housekeeping action %q: must be %s or %s", action, housekeepingEmptyTrash, housekeepingRemoveDuplicates)
+		}
+	}
+
+	// Duplicates are only trashed, so emptying the trash afterwards frees their space
+	for _, action := range []string{housekeepingRemoveDuplicates, housekeepingEmptyTrash} {
+		if actions[action] {
+			cfg.Housekeeping = append(cfg.Housekeeping, action)
+		}
+	}
+	return cfg, nil
+}
+
+// checkStorageQuota is the scheduled job alerting admins when Drive storage usage exceeds the
+// configured threshold, after running the configured housekeeping actions. Housekeeping
+// runs once per alert, even when delivering the alert fails and is retried.
+func (s *Server) checkStorageQuota(ctx context.Context) error {
+	cfg := s.cfg.QuotaAlert
+	if cfg.Percent == 0 {
+		return nil
+	}
+
+	about, err := s.driveService.About.Get().Context(ctx).Fields("storageQuota").Do()
+	if err != nil {
+		return fmt.Errorf("unable to fetch storage quota: %w", err)
+	}
+	// Accounts with unlimited storage have no limit
+	if about.StorageQuota == nil || about.StorageQuota.Limit == 0 {
+		return nil
+	}
+
+	usage, limit := about.StorageQuota.Usage, about.StorageQuota.Limit
+	percent := float64(usage) * 100 / float64(limit)
+	if percent < float64(cfg.Percent) {
+		return s.redis.Del(ctx, quotaAlertKey, quotaHousekeepingKey).Err()
+	}
+
+	if n, _ := s.redis.Exists(ctx, quotaAlertKey).Result(); n > 0 {
+		return nil
+	}
+
+	alert := QuotaAlert{
+		Type:      "quota.exceeded",
+		Usage:     usage,
+		Limit:     limit,
+		Percent:   percent,
+		Threshold: cfg.Percent,
+		Time:      time.Now(),
+	}
+	if data, err := s.redis.Get(ctx, quotaHousekeepingKey).Bytes(); err == nil {
+		if err := json.Unmarshal(data, &alert.Housekeeping); err != nil {
+			log.Printf("Warning: Failed to decode housekeeping results: %v", err)
+		}
+	} else {
+		for _, action := range cfg.Housekeeping {
+			alert.Housekeeping = append(alert.Housekeeping, s.runHousekeeping(ctx, action))
+		}
+		data, _ := json.Marshal(alert.Housekeeping)
+		if err := s.redis.Set(ctx, quotaHousekeepingKey, data, quotaAlertRepeat).Err(); err != nil {
+			log.Printf("Warning: Failed to record housekeeping results: %v", err)
+		}
+	}
+	log.Printf("Warning: Drive storage at %.1f%% of quota (%s of %s)", percent, formatBytes(usage), formatBytes(limit))
+
+	if err := s.sendQuotaAlert(ctx, alert); err != nil {
+		return err
+	}
+	return s.redis.Set(ctx, quotaAlertKey, time.Now().Unix(), quotaAlertRepeat).Err()
+}
+
+// runHousekeeping runs a housekeeping action, recording it in the audit log. Unless
+// housekeeping is configured to apply its changes, the action is a dry run.
+func (s *Server) runHousekeeping(ctx context.Context, action string) HousekeepingResult {
+	dryRun := !s.cfg.QuotaAlert.Apply
+	result := HousekeepingResult{Action: action, DryRun: dryRun}
+
+	var err error
+	switch action {
+	case housekeepingEmptyTrash:
+		result.Deleted, err = s.deleteTrashedDuplicates(ctx, dryRun)
+	case housekeepingRemoveDuplicates:
+		result.Trashed, err = s.trashDuplicates(ctx, dryRun)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		log.Printf("Warning: Housekeeping %s failed: %v", action, err)
+	}
+
+	detail := "storage quota exceeded"
+	switch {
+	case dryRun && action == housekeepingRemoveDuplicates:
+		detail += fmt.Sprintf("; dry run, %d duplicates would be trashed", result.Trashed)
+	case dryRun:
+		detail += fmt.Sprintf("; dry run, %d trashed duplicates would be deleted", result.Deleted)
+	case action == housekeepingRemoveDuplicates:
+		detail += fmt.Sprintf("; %d duplicates trashed", result.Trashed)
+	default:
+		detail += fmt.Sprintf("; %d trashed duplicates deleted", result.Deleted)
+	}
+	if _, err := s.execWrite(ctx, "INSERT INTO audit_log (action, detail) VALUES (?, ?)", "housekeeping."+action, detail); err != nil {
+		log.Printf("Failed to record audit entry for housekeeping %s: %v", action, err)
+	}
+	return result
+}
+
+// duplicateKey identifies files that are copies of each other.
+type duplicateKey struct {
+	checksum string
+	name     string
+	size     int64
+}
+
+// findDuplicates returns the library files whose content, name and size match another
+// library file, leaving one copy of each. A visible copy is kept over a hidden one, then
+// a bookmarked, featured or pinned copy, then the one with the lowest ID. Bookmarked,
+// featured and pinned files are never returned, and empty files are not compared.
+func (s *Server) findDuplicates(ctx context.Context) ([]gdrive.FileInfo, error) {
+	files, err := s.getFiles(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	checksums, err := s.listChecksums(ctx)
+	if err != nil {
+		return nil, err
+	}
+	overlay, err := s.loadOverlay(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	bookmarked := make(map[string]bool)
+	rows, err := s.db.QueryContext(ctx, "SELECT file_id FROM bookmarks")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		bookmarked[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	protected := func(id string) bool {
+		return bookmarked[id] || overlay.featured[id] || overlay.pinned[id]
+	}
+	// rank orders the copies of a file from the most to the least worth keeping
+	rank := func(f gdrive.FileInfo) int {
+		r := 0
+		if overlay.hidden[f.ID] {
+			r += 2
+		}
+		if !protected(f.ID) {
+			r++
+		}
+		return r
+	}
+
+	groups := make(map[duplicateKey][]gdrive.FileInfo)
+	seen := make(map[string]bool) // Files with several parents are listed once per parent
+	for _, f := range files {
+		sum := checksums[f.ID]
+		if sum == "" || sum == emptyFileChecksum || f.Size == 0 || seen[f.ID] {
+			continue
+		}
+		seen[f.ID] = true
+
+		key := duplicateKey{checksum: sum, name: f.Name, size: f.Size}
+		groups[key] = append(groups[key], f)
+	}
+
+	var duplicates []gdrive.FileInfo
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		slices.SortFunc(group, func(a, b gdrive.FileInfo) int {
+			return cmp.Or(cmp.Compare(rank(a), rank(b)), strings.Compare(a.ID, b.ID))
+		})
+		for _, f := range group[1:] {
+			if !protected(f.ID) {
+				duplicates = append(duplicates, f)
+			}
+		}
+	}
+	return duplicates, nil
+}
+
+// trashDuplicates moves the duplicates found by findDuplicates to the trash and records
+// them for deleteTrashedDuplicates. Returns the number of files trashed, or that would be
+// trashed in a dry run.
+func (s *Server) trashDuplicates(ctx context.Context, dryRun bool) (int, error) {
+	duplicates, err := s.findDuplicates(ctx)
+	if err != nil || dryRun {
+		return len(duplicates), err
+	}
+
+	trashed := 0
+	var errs []error
+	for _, f := range duplicates {
+		if err := s.setTrashed(ctx, f.ID, true); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.ID, err))
+			continue
+		}
+		trashed++
+		if err := s.redis.SAdd(ctx, housekeepingTrashedKey, f.ID).Err(); err != nil {
+			log.Printf("Warning: Failed to record trashed duplicate %s: %v", f.ID, err)
+		}
+	}
+
+	if trashed > 0 {
+		if err := s.invalidateCache(ctx); err != nil {
+			log.Printf("Warning: Failed to invalidate cache: %v", err)
+		}
+	}
+	return trashed, errors.Join(errs...)
+}
+
+// deleteTrashedDuplicates permanently deletes the duplicates trashDuplicates trashed
+// that are still in the trash. Files trashed any other way, and duplicates restored
+// since, are left alone. Returns the number of files deleted, or that would be
+// deleted in a dry run.
+func (s *Server) deleteTrashedDuplicates(ctx context.Context, dryRun bool) (int, error) {
+	ids, err := s.redis.SMembers(ctx, housekeepingTrashedKey).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	var errs []error
+	for _, id := range ids {
+		f, err := s.driveService.Files.Get(id).Context(ctx).SupportsAllDrives(true).Fields("trashed").Do()
+		var apiErr *googleapi.Error
+		switch {
+		case errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound:
+			s.redis.SRem(ctx, housekeepingTrashedKey, id)
+			continue
+		case err != nil:
+			errs = append(errs, fmt.Errorf("%s: %w", id, err))
+			continue
+		case !f.Trashed:
+			s.redis.SRem(ctx, housekeepingTrashedKey, id)
+			continue
+		}
+
+		if !dryRun {
+			if err := s.deleteFile(ctx, id); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", id, err))
+				continue
+			}
+			s.redis.SRem(ctx, housekeepingTrashedKey, id)
+		}
+		deleted++
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// sendQuotaAlert delivers a storage alert by email and webhook, as configured.
+func (s *Server) sendQuotaAlert(ctx context.Context, alert QuotaAlert) error {
+	cfg := s.cfg.QuotaAlert
+	var errs []error
+
+	if len(cfg.Emails) > 0 && s.cfg.SMTP.Host != "" {
+		var body strings.Builder
+		fmt.Fprintf(&body, "Drive storage is at %.1f%% of its quota (%s of %s), above the alert threshold of %d%%.\n",
+			alert.Percent, formatBytes(alert.Usage), formatBytes(alert.Limit), alert.Threshold)
+		for _, h := range alert.Housekeeping {
+			switch {
+			case h.Error != "":
+				fmt.Fprintf(&body, "\nHousekeeping %s failed: %s", h.Action, h.Error)
+			case h.DryRun && h.Action == housekeepingRemoveDuplicates:
+				fmt.Fprintf(&body, "\nHousekeeping %s (dry run): %d files would be trashed", h.Action, h.Trashed)
+			case h.DryRun:
+				fmt.Fprintf(&body, "\nHousekeeping %s (dry run): %d files would be deleted", h.Action, h.Deleted)
+			case h.Action == housekeepingRemoveDuplicates:
+				fmt.Fprintf(&body, "\nHousekeeping %s: %d files trashed", h.Action, h.Trashed)
+			default:
+				fmt.Fprintf(&body, "\nHousekeeping %s: %d files deleted", h.Action, h.Deleted)
+			}
+		}
+		if err := s.sendMail(cfg.Emails, "E-Library: Drive storage running low", body.String()); err != nil {
+			errs = append(errs, fmt.Errorf("email: %w", err))
+		}
+	}
+
+	if cfg.WebhookURL != "" {
+		payload, err := json.Marshal(alert)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.WebhookURL, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := alertClient.Do(req)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("webhook: %w", err))
+		} else {
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				errs = append(errs, fmt.Errorf("webhook returned %s", resp.Status))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
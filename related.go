@@ -0,0 +1,182 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Weights of the signals ranking related files.
+const (
+	relatedFolderWeight = 3.0 // Applied to the folder path similarity, from 0 to 1
+	relatedTagWeight    = 2.0 // Per shared tag
+	relatedReaderWeight = 1.0 // Per reader who downloaded both files
+)
+
+// RelatedQuery holds the query parameters of GET /api/files/:id/related.
+type RelatedQuery struct {
+	Limit int `query:"limit" validate:"min=1,max=50"`
+}
+
+// RelatedFile is a file recommended alongside another, with the reasons it was picked.
+type RelatedFile struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	FolderPath string   `json:"folder_path"`
+	Score      float64  `json:"score"`
+	Reasons    []string `json:"reasons"`
+}
+
+// folderSimilarity compares two folder paths by their common leading segments below
+// the root, from 0 (nothing in common) to 1 (the same folder). Every path starts with
+// the root, such as "My Drive", so it is left out of the comparison.
+func folderSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	as, bs := folderSegments(a), folderSegments(b)
+	common := 0
+	for common < min(len(as), len(bs)) && as[common] == bs[common] {
+		common++
+	}
+	return 2 * float64(common) / float64(len(as)+len(bs))
+}
+
+// folderSegments returns the segments of a folder path below its root.
+func folderSegments(path string) []string {
+	_, below, ok := strings.Cut(path, "/")
+	if !ok {
+		return nil
+	}
+	return strings.Split(below, "/")
+}
+
+// coReaders returns, for every other file, the number of distinct readers who
+// downloaded it as well as fileID.
+func (s *Server) coReaders(ctx context.Context, fileID string) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT other.file_id, COUNT(DISTINCT other.user_id)
+		FROM downloads d
+		JOIN downloads other ON other.user_id = d.user_id AND other.file_id != d.file_id
+		WHERE d.file_id = ? AND d.user_id IS NOT NULL
+		GROUP BY other.file_id
+	`, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readers := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			continue
+		}
+		readers[id] = n
+	}
+	return readers, rows.Err()
+}
+
+// handleRelatedFiles handles GET /api/files/:id/related - returns files related to a
+// title, ranked by folder proximity, shared tags and how many readers downloaded both.
+func (s *Server) handleRelatedFiles(w http.ResponseWriter, r *http.Request) {
+	q := RelatedQuery{Limit: 10}
+	if !decodeQuery(w, r, &q) {
+		return
+	}
+
+	ctx := r.Context()
+	fileID := chi.URLParam(r, "id")
+	file, err := s.findFile(ctx, fileID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if file == nil {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	files, err := s.getFiles(ctx, false)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	overlay, err := s.loadOverlay(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	tags, _, err := s.fileLabels(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	readers, err := s.coReaders(ctx, fileID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	related := make([]RelatedFile, 0)
+	seen := map[string]bool{fileID: true}
+	for _, f := range files {
+		if seen[f.ID] || overlay.hidden[f.ID] {
+			continue
+		}
+		seen[f.ID] = true
+
+		var score float64
+		var reasons []string
+		if sim := folderSimilarity(file.FolderPath, f.FolderPath); sim > 0 {
+			score += relatedFolderWeight * sim
+			if sim == 1 {
+				reasons = append(reasons, "same folder")
+			} else {
+				reasons = append(reasons, "nearby folder")
+			}
+		}
+
+		var shared []string
+		for _, tag := range tags[f.ID] {
+			if slices.Contains(tags[fileID], tag) {
+				shared = append(shared, tag)
+			}
+		}
+		if len(shared) > 0 {
+			score += relatedTagWeight * float64(len(shared))
+			reasons = append(reasons, "tags: "+strings.Join(shared, ", "))
+		}
+
+		if n := readers[f.ID]; n > 0 {
+			score += relatedReaderWeight * float64(n)
+			reasons = append(reasons, fmt.Sprintf("downloaded together by %d readers", n))
+		}
+
+		if score > 0 {
+			related = append(related, RelatedFile{ID: f.ID, Name: f.Name, FolderPath: f.FolderPath, Score: score, Reasons: reasons})
+		}
+	}
+
+	c := s.collator()
+	slices.SortFunc(related, func(a, b RelatedFile) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), c.CompareString(a.Name, b.Name))
+	})
+	if len(related) > q.Limit {
+		related = related[:q.Limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"file_id": fileID,
+		"related": related,
+		"count":   len(related),
+	})
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/abiiranathan/gdrive"
+)
+
+// RenameRequest describes a bulk rename operation.
+// Pattern is a regular expression matched against the file name (without extension)
+// and replaced with Replacement; Case then normalizes the result.
+type RenameRequest struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+	Case        string `json:"case" validate:"omitempty,oneof=lower upper title"`
+	FolderPath  string `json:"folder_path"` // Only rename files in this folder and its subfolders
+	Apply       bool   `json:"apply"`       // Rename the files; otherwise the renames are only previewed
+}
+
+// RenamePlan is a single planned (or applied) rename.
+type RenamePlan struct {
+	FileID     string `json:"file_id"`
+	FolderPath string `json:"folder_path"`
+	OldName    string `json:"old_name"`
+	NewName    string `json:"new_name"`
+	Error      string `json:"error,omitempty"`
+}
+
+// planRenames computes the renames that req would apply to files.
+// Files whose name would not change are omitted.
+func planRenames(files []gdrive.FileInfo, req RenameRequest) ([]RenamePlan, error) {
+	if req.Pattern == "" && req.Case == "" {
+		return nil, errors.New("pattern or case required")
+	}
+
+	var re *regexp.Regexp
+	if req.Pattern != "" {
+		var err error
+		if re, err = regexp.Compile(req.Pattern); err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+
+	var normalize func(string) string
+	switch req.Case {
+	case "":
+	case "lower":
+		normalize = strings.ToLower
+	case "upper":
+		normalize = strings.ToUpper
+	case "title":
+		normalize = titleCase
+	default:
+		return nil, fmt.Errorf("invalid case %q: must be lower, upper or title", req.Case)
+	}
+
+	plans := make([]RenamePlan, 0)
+	for _, f := range files {
+		if p := strings.TrimSuffix(req.FolderPath, "/"); p != "" && f.FolderPath != p && !strings.HasPrefix(f.FolderPath, p+"/") {
+			continue
+		}
+
+		ext := path.Ext(f.Name)
+		stem := strings.TrimSuffix(f.Name, ext)
+		if re != nil {
+			stem = re.ReplaceAllString(stem, req.Replacement)
+		}
+		if normalize != nil {
+			stem = normalize(stem)
+		}
+		stem = strings.TrimSpace(stem)
+
+		newName := stem + ext
+		if stem == "" || newName == f.Name {
+			continue
+		}
+
+		plans = append(plans, RenamePlan{
+			FileID:     f.ID,
+			FolderPath: f.FolderPath,
+			OldName:    f.Name,
+			NewName:    newName,
+		})
+	}
+	return plans, nil
+}
+
+// applyRenames executes plans against Drive, recording per-file errors in the plans.
+// Returns the number of files renamed successfully.
+func (s *Server) applyRenames(ctx context.Context, plans []RenamePlan) int {
+	updates := make([]MetadataUpdate, len(plans))
+	for i, p := range plans {
+		updates[i] = MetadataUpdate{FileID: p.FileID, Name: p.NewName}
+	}
+
+	renamed := 0
+	for i, err := range s.updateMetadataBatch(ctx, updates) {
+		if err != nil {
+			plans[i].Error = err.Error()
+			continue
+		}
+		renamed++
+	}
+	return renamed
+}
+
+// titleCase upper-cases the first letter of every word and lower-cases the rest.
+func titleCase(s string) string {
+	var b strings.Builder
+	start := true
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r) && start:
+			b.WriteRune(unicode.ToUpper(r))
+			start = false
+		case unicode.IsLetter(r):
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+			start = unicode.IsSpace(r) || r == '_' || r == '-'
+		}
+	}
+	return b.String()
+}
+
+// handleBulkRename handles POST /api/admin/rename - previews a bulk rename, or applies it
+// when called with "apply": true, like the rename command's -apply flag.
+func (s *Server) handleBulkRename(w http.ResponseWriter, r *http.Request) {
+	var req RenameRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+	files, err := s.getFiles(ctx, false)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	plans, err := planRenames(files, req)
+	if err != nil {
+		writeValidationError(w, FieldError{Field: "pattern", Message: err.Error()})
+		return
+	}
+
+	renamed := 0
+	if req.Apply && len(plans) > 0 {
+		renamed = s.applyRenames(ctx, plans)
+		s.audit(r, "file.bulk_rename", "", fmt.Sprintf("pattern=%q case=%q renamed=%d", req.Pattern, req.Case, renamed))
+		if err := s.invalidateCache(ctx); err != nil {
+			logf(ctx, "Warning: Failed to invalidate cache: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"dry_run": !req.Apply,
+		"renames": plans,
+		"count":   len(plans),
+		"renamed": renamed,
+	})
+}
+
+// runRenameCommand implements the "rename" CLI subcommand.
+// Without -apply it only prints the planned renames.
+func runRenameCommand(ctx context.Context, cfg Config, args []string) error {
+	fs := flag.NewFlagSet("rename", flag.ExitOnError)
+	var req RenameRequest
+	fs.StringVar(&req.Pattern, "pattern", "", "regular expression matched against file names (without extension)")
+	fs.StringVar(&req.Replacement, "replace", "", "replacement for pattern matches ($1 etc. expand groups)")
+	fs.StringVar(&req.Case, "case", "", "normalize case: lower, upper or title")
+	fs.StringVar(&req.FolderPath, "folder", "", "only rename files under this folder path")
+	fs.BoolVar(&req.Apply, "apply", false, "apply the renames instead of previewing them")
+	fs.Parse(args)
+
+	server, err := NewServer(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+
+	files, err := server.getFiles(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	plans, err := planRenames(files, req)
+	if err != nil {
+		return err
+	}
+
+	if req.Apply && len(plans) > 0 {
+		renamed := server.applyRenames(ctx, plans)
+		if err := server.invalidateCache(ctx); err != nil {
+			log.Printf("Warning: Failed to invalidate cache: %v", err)
+		}
+		defer fmt.Fprintf(os.Stdout, "Renamed %d of %d files\n", renamed, len(plans))
+	}
+
+	for _, p := range plans {
+		status := ""
+		if p.Error != "" {
+			status = " (failed: " + p.Error + ")"
+		}
+		fmt.Fprintf(os.Stdout, "%s/%s -> %s%s\n", p.FolderPath, p.OldName, p.NewName, status)
+	}
+
+	if !req.Apply {
+		fmt.Fprintf(os.Stdout, "%d files would be renamed; re-run with -apply to rename them\n", len(plans))
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"golang.org/x/oauth2"
+)
+
+// RequestIDHeader carries the request ID on responses and outgoing Drive calls.
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDPattern matches client-supplied request IDs that are safe to echo and log.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestID is middleware assigning every request an ID, reusing a well-formed
+// X-Request-ID sent by the client (e.g. a reverse proxy). The ID is returned in
+// the response header and stored in the context under chi's request ID key, so
+// the request logger, logf and Drive calls made with the request context include it.
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = randomToken()[:22]
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), middleware.RequestIDKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// logf logs a message with the request ID stored in ctx, if any. Messages starting
+// with "Warning:" are logged at warning level, failures and errors at error level.
+func logf(ctx context.Context, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	var attrs []slog.Attr
+	if id := middleware.GetReqID(ctx); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	slog.LogAttrs(ctx, messageLevel(msg), msg, attrs...)
+}
+
+// requestIDTransport is an http.RoundTripper forwarding the request ID of the
+// request context to outgoing calls.
+type requestIDTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip adds the X-Request-ID header when the request context carries an ID.
+func (t requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := middleware.GetReqID(req.Context()); id != "" {
+		// RoundTrippers must not modify the caller's request
+		req = req.Clone(req.Context())
+		req.Header.Set(RequestIDHeader, id)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// withRequestIDTransport returns a context making OAuth2 clients created from it
+// send the request ID of each call's context to Google.
+func withRequestIDTransport(ctx context.Context) context.Context {
+	client := &http.Client{Transport: requestIDTransport{base: http.DefaultTransport}}
+	return context.WithValue(ctx, oauth2.HTTPClient, client)
+}
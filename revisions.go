@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/api/drive/v3"
+)
+
+// NamedRevision is a revision of a book labeled by an admin, e.g. "1st edition".
+type NamedRevision struct {
+	RevisionID   string    `json:"revision_id"`
+	Label        string    `json:"label"`
+	Pinned       bool      `json:"pinned"`
+	ModifiedTime time.Time `json:"modified_time"`
+	Size         int64     `json:"size"`
+}
+
+// NameRevisionRequest represents a request to label (and optionally pin) a revision.
+type NameRevisionRequest struct {
+	RevisionID string `json:"revision_id" validate:"required"`
+	Label      string `json:"label" validate:"required,max=100"`
+	Pin        bool   `json:"pin"`
+}
+
+// setKeepForever pins or unpins a revision so Drive does not purge it.
+func (s *Server) setKeepForever(ctx context.Context, fileID, revisionID string, keep bool) (*drive.Revision, error) {
+	rev, err := s.driveService.Revisions.Update(fileID, revisionID, &drive.Revision{
+		KeepForever:     keep,
+		ForceSendFields: []string{"KeepForever"},
+	}).
+		Context(ctx).
+		Fields("id, modifiedTime, size, keepForever").
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to update revision: %w", err)
+	}
+	return rev, nil
+}
+
+// findNamedRevision returns the named revision of a file matching a revision ID or label,
+// or nil if there is none.
+func (s *Server) findNamedRevision(ctx context.Context, fileID, revision string) (*NamedRevision, error) {
+	var rev NamedRevision
+	err := s.db.QueryRowContext(ctx, `
+		SELECT revision_id, label, pinned, modified_time, size
+		FROM revision_labels
+		WHERE file_id = ? AND (revision_id = ? OR label = ? COLLATE NOCASE)
+		ORDER BY revision_id = ? DESC
+		LIMIT 1
+	`, fileID, revision, revision, revision).Scan(&rev.RevisionID, &rev.Label, &rev.Pinned, &rev.ModifiedTime, &rev.Size)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// handleListNamedRevisions handles GET /api/files/:id/revisions - returns the
+// named revisions of a file that readers can download with ?revision=.
+func (s *Server) handleListNamedRevisions(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.QueryContext(r.Context(), `
+		SELECT revision_id, label, pinned, modified_time, size
+		FROM revision_labels
+		WHERE file_id = ?
+		ORDER BY modified_time DESC
+	`, chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	revisions := make([]NamedRevision, 0)
+	for rows.Next() {
+		var rev NamedRevision
+		if err := rows.Scan(&rev.RevisionID, &rev.Label, &rev.Pinned, &rev.ModifiedTime, &rev.Size); err != nil {
+			continue
+		}
+		revisions = append(revisions, rev)
+	}
+
+	if rows.Err() != nil {
+		writeError(w, http.StatusInternalServerError, rows.Err().Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"revisions": revisions,
+		"count":     len(revisions),
+	})
+}
+
+// handleNameRevision handles POST /api/files/:id/revisions - labels a revision of a
+// file, making it selectable at download time. Pinned revisions are marked
+// keepForever so Drive does not purge them.
+func (s *Server) handleNameRevision(w http.ResponseWriter, r *http.Request) {
+	var req NameRevisionRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+	fileID := chi.URLParam(r, "id")
+
+	var rev *drive.Revision
+	var err error
+	if req.Pin {
+		rev, err = s.setKeepForever(ctx, fileID, req.RevisionID, true)
+	} else {
+		rev, err = s.driveService.Revisions.Get(fileID, req.RevisionID).
+			Context(ctx).
+			Fields("id, modifiedTime, size, keepForever").
+			Do()
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	named := NamedRevision{RevisionID: rev.Id, Label: req.Label, Pinned: rev.KeepForever, Size: rev.Size}
+	named.ModifiedTime, _ = time.Parse(time.RFC3339Nano, rev.ModifiedTime)
+
+	_, err = s.execWrite(ctx, `
+		INSERT INTO revision_labels (file_id, revision_id, label, pinned, modified_time, size)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(file_id, revision_id) DO UPDATE SET
+			label = excluded.label,
+			pinned = excluded.pinned,
+			modified_time = excluded.modified_time,
+			size = excluded.size
+	`, fileID, named.RevisionID, named.Label, named.Pinned, named.ModifiedTime, named.Size)
+	if err != nil {
+		writeError(w, http.StatusConflict, "another revision of this file has the same label")
+		return
+	}
+
+	s.audit(r, "revision.name", fileID, fmt.Sprintf("%s: %s", named.RevisionID, named.Label))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(named)
+}
+
+// handleRemoveNamedRevision handles DELETE /api/files/:id/revisions/:revisionID -
+// removes a revision's label and unpins it.
+func (s *Server) handleRemoveNamedRevision(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	fileID := chi.URLParam(r, "id")
+	revisionID := chi.URLParam(r, "revisionID")
+
+	var pinned bool
+	err := s.db.QueryRowContext(ctx,
+		"SELECT pinned FROM revision_labels WHERE file_id = ? AND revision_id = ?",
+		fileID, revisionID,
+	).Scan(&pinned)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "named revision not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if pinned {
+		if _, err := s.setKeepForever(ctx, fileID, revisionID, false); err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+	}
+
+	if _, err := s.execWrite(ctx,
+		"DELETE FROM revision_labels WHERE file_id = ? AND revision_id = ?", fileID, revisionID,
+	); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.audit(r, "revision.unname", fileID, revisionID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "named revision removed"})
+}
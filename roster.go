@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// rosterConcurrency bounds the number of concurrent permission grants.
+	rosterConcurrency = 4
+
+	// rosterInterval is the minimum delay between two permission grants, keeping
+	// large rosters under Drive's sharing rate limits.
+	rosterInterval = 200 * time.Millisecond
+
+	// rosterMaxAttempts is the number of attempts per email before it is reported as failed.
+	rosterMaxAttempts = 5
+)
+
+// ShareRosterRequest represents a request to share a folder with a class roster.
+type ShareRosterRequest struct {
+	Emails  []string `json:"emails" validate:"min=1,max=2000"`
+	Role    string   `json:"role" validate:"omitempty,oneof=reader commenter"`
+	Notify  bool     `json:"notify"`
+	Message string   `json:"message" validate:"max=1000"`
+}
+
+// ShareRosterQuery holds the query parameters of CSV roster uploads.
+type ShareRosterQuery struct {
+	Role    string `query:"role" validate:"oneof=reader commenter"`
+	Notify  bool   `query:"notify"`
+	Message string `query:"message" validate:"max=1000"`
+}
+
+// RosterResult is the outcome of sharing with a single roster email.
+type RosterResult struct {
+	Email        string `json:"email"`
+	Status       string `json:"status"` // granted, invalid, duplicate or failed
+	PermissionID string `json:"permission_id,omitempty"`
+	Attempts     int    `json:"attempts,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// parseRoster reads email addresses from a roster CSV. The column named
+// "email" is used when there is a header row, otherwise the first column.
+func parseRoster(body io.Reader) ([]string, error) {
+	cr := csv.NewReader(body)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	col := 0
+	for i, name := range records[0] {
+		if strings.EqualFold(strings.TrimSpace(name), "email") {
+			col, records = i, records[1:]
+			break
+		}
+	}
+
+	var emails []string
+	for _, record := range records {
+		if col < len(record) && strings.TrimSpace(record[col]) != "" {
+			emails = append(emails, strings.TrimSpace(record[col]))
+		}
+	}
+	return emails, nil
+}
+
+// retryableDriveError reports whether a Drive call failed because of rate
+// limiting or a transient server error.
+func retryableDriveError(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= 500 {
+		return true
+	}
+	for _, e := range apiErr.Errors {
+		switch e.Reason {
+		case "rateLimitExceeded", "userRateLimitExceeded", "sharingRateLimitExceeded":
+			return true
+		}
+	}
+	return false
+}
+
+// grantRosterAccess creates a permission for email on folderID, retrying rate-limited and
+// transient failures with exponential backoff. pace is received from before each attempt.
+func (s *Server) grantRosterAccess(ctx context.Context, pace <-chan time.Time, folderID, email string, req ShareRosterRequest) RosterResult {
+	result := RosterResult{Email: email}
+	backoff := time.Second
+	for result.Attempts < rosterMaxAttempts {
+		select {
+		case <-ctx.Done():
+			result.Status, result.Error = "failed", ctx.Err().Error()
+			return result
+		case <-pace:
+		}
+
+		result.Attempts++
+		call := s.driveService.Permissions.Create(folderID, &drive.Permission{
+			Type:         "user",
+			Role:         req.Role,
+			EmailAddress: email,
+		}).Context(ctx).SupportsAllDrives(true).SendNotificationEmail(req.Notify).Fields("id")
+		if req.Notify && req.Message != "" {
+			call = call.EmailMessage(req.Message)
+		}
+
+		perm, err := call.Do()
+		if err == nil {
+			result.Status, result.PermissionID, result.Error = "granted", perm.Id, ""
+			return result
+		}
+
+		result.Status, result.Error = "failed", err.Error()
+		if !retryableDriveError(err) {
+			return result
+		}
+
+		select {
+		case <-ctx.Done():
+			return result
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return result
+}
+
+// handleShareRoster handles POST /api/admin/folders/:id/share - grants a class roster
+// reader (or commenter) access to a folder. The body is either JSON with an "emails"
+// list or a roster CSV (Content-Type: text/csv, options in the query string).
+// Grants are throttled and retried; the response reports the outcome per email.
+func (s *Server) handleShareRoster(w http.ResponseWriter, r *http.Request) {
+	var req ShareRosterRequest
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/csv" {
+		q := ShareRosterQuery{Role: "reader"}
+		if !decodeQuery(w, r, &q) {
+			return
+		}
+
+		emails, err := parseRoster(http.MaxBytesReader(w, r.Body, maxImportBytes))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req = ShareRosterRequest{Emails: emails, Role: q.Role, Notify: q.Notify, Message: q.Message}
+		if details := validateStruct(&req, "json"); len(details) > 0 {
+			writeValidationError(w, details...)
+			return
+		}
+	} else if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = "reader"
+	}
+
+	ctx := r.Context()
+	folderID := chi.URLParam(r, "id")
+	results := make([]RosterResult, len(req.Emails))
+	seen := make(map[string]bool, len(req.Emails))
+
+	pace := time.NewTicker(rosterInterval)
+	defer pace.Stop()
+
+	sem := make(chan struct{}, rosterConcurrency)
+	var wg sync.WaitGroup
+	for i, email := range req.Emails {
+		addr, err := mail.ParseAddress(email)
+		if err != nil || addr.Name != "" {
+			results[i] = RosterResult{Email: email, Status: "invalid", Error: "invalid email address"}
+			continue
+		}
+
+		key := strings.ToLower(addr.Address)
+		if seen[key] {
+			results[i] = RosterResult{Email: email, Status: "duplicate"}
+			continue
+		}
+		seen[key] = true
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = s.grantRosterAccess(ctx, pace.C, folderID, addr.Address, req)
+		}()
+	}
+	wg.Wait()
+
+	counts := make(map[string]int)
+	for _, res := range results {
+		counts[res.Status]++
+	}
+
+	s.audit(r, "folder.share_roster", folderID, fmt.Sprintf("%s: %d granted, %d failed, %d invalid",
+		req.Role, counts["granted"], counts["failed"], counts["invalid"]))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"folder_id": folderID,
+		"role":      req.Role,
+		"counts":    counts,
+		"results":   results,
+	})
+}
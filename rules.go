@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+
+	"github.com/abiiranathan/gdrive"
+)
+
+// DefaultRulesPath is the path to the file organization rules.
+const DefaultRulesPath = "rules.json"
+
+// Rule moves and tags newly detected files matching all of its criteria.
+// Empty criteria match every file.
+type Rule struct {
+	Name           string   `json:"name"`
+	MimeType       string   `json:"mime_type"`
+	NamePattern    string   `json:"name_pattern"`
+	MinSize        int64    `json:"min_size"`
+	MaxSize        int64    `json:"max_size"`
+	TargetFolderID string   `json:"target_folder_id"`
+	Tags           []string `json:"tags"`
+
+	nameRe *regexp.Regexp
+}
+
+// matches reports whether f satisfies all of the rule's criteria.
+func (rule *Rule) matches(f gdrive.FileInfo) bool {
+	if rule.MimeType != "" && f.MimeType != rule.MimeType {
+		return false
+	}
+	if rule.nameRe != nil && !rule.nameRe.MatchString(f.Name) {
+		return false
+	}
+	if rule.MinSize > 0 && f.Size < rule.MinSize {
+		return false
+	}
+	if rule.MaxSize > 0 && f.Size > rule.MaxSize {
+		return false
+	}
+	return true
+}
+
+// loadRules reads organization rules from a JSON file.
+// A missing file is not an error and yields no rules.
+func loadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read rules: %w", err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("unable to parse rules: %w", err)
+	}
+
+	for i := range rules {
+		if rules[i].NamePattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(rules[i].NamePattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: invalid name_pattern: %w", rules[i].Name, err)
+		}
+		rules[i].nameRe = re
+	}
+	return rules, nil
+}
+
+// detectNewFiles records every file in the listing and returns the ones not seen before.
+// The first run only records a baseline and returns no files, so rules are never
+// applied retroactively to an existing library.
+func (s *Server) detectNewFiles(ctx context.Context, files []gdrive.FileInfo) ([]gdrive.FileInfo, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT file_id FROM known_files")
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		known[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The files of the first listing were not added recently, so the baseline is dated
+	// to the epoch and the digest does not report the whole library as new
+	insert := "INSERT INTO known_files (file_id) VALUES (?)"
+	if len(known) == 0 {
+		insert = "INSERT INTO known_files (file_id, first_seen) VALUES (?, datetime(0, 'unixepoch'))"
+	}
+
+	var newFiles []gdrive.FileInfo
+	err = s.writeTx(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, insert)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		newFiles = make([]gdrive.FileInfo, 0)
+		for _, f := range files {
+			if known[f.ID] {
+				continue
+			}
+			if _, err := stmt.ExecContext(ctx, f.ID); err != nil {
+				return err
+			}
+			newFiles = append(newFiles, f)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(known) == 0 {
+		log.Printf("Recorded baseline of %d known files", len(newFiles))
+		return nil, nil
+	}
+	return newFiles, nil
+}
+
+// applyRules moves and tags files according to the first matching rule for each file.
+func (s *Server) applyRules(ctx context.Context, files []gdrive.FileInfo) error {
+	var errs []error
+	for _, f := range files {
+		for i := range s.rules {
+			rule := &s.rules[i]
+			if !rule.matches(f) {
+				continue
+			}
+
+			if rule.TargetFolderID != "" && !slices.Contains(f.Parents, rule.TargetFolderID) {
+				if _, err := s.updateMetadata(ctx, f.ID, "", rule.TargetFolderID); err != nil {
+					errs = append(errs, fmt.Errorf("rule %q: %s: %w", rule.Name, f.Name, err))
+					break
+				}
+			}
+
+			if err := s.addTags(ctx, f.ID, rule.Tags); err != nil {
+				errs = append(errs, fmt.Errorf("rule %q: %s: %w", rule.Name, f.Name, err))
+			}
+
+			log.Printf("Rule %q applied to %s", rule.Name, f.Name)
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// addTags attaches tags to a file, ignoring tags it already has.
+func (s *Server) addTags(ctx context.Context, fileID string, tags []string) error {
+	for _, tag := range tags {
+		_, err := s.execWrite(ctx,
+			"INSERT OR IGNORE INTO file_tags (file_id, tag) VALUES (?, ?)",
+			fileID, tag,
+		)
+		if err != nil {
+			return fmt.Errorf("unable to add tag %q: %w", tag, err)
+		}
+	}
+	return nil
+}
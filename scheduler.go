@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Job is a named background task run periodically by the Scheduler.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// JobStatus reports the outcome of the most recent run of a job.
+type JobStatus struct {
+	Name         string    `json:"name"`
+	Interval     string    `json:"interval"`
+	Runs         int       `json:"runs"`
+	LastRun      time.Time `json:"last_run"`
+	LastDuration string    `json:"last_duration"`
+	LastError    string    `json:"last_error,omitempty"`
+	Running      bool      `json:"running"`
+}
+
+// Scheduler runs registered jobs on fixed intervals until its context is cancelled.
+// A job never overlaps with itself; a run that is still in progress delays the next one.
+type Scheduler struct {
+	mu     sync.Mutex
+	jobs   []Job
+	status map[string]*JobStatus
+}
+
+// NewScheduler creates an empty Scheduler.
+func NewScheduler() *Scheduler {
+	return &Scheduler{status: make(map[string]*JobStatus)}
+}
+
+// Add registers a job. Jobs must be added before Start is called.
+func (sc *Scheduler) Add(job Job) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.jobs = append(sc.jobs, job)
+	sc.status[job.Name] = &JobStatus{Name: job.Name, Interval: job.Interval.String()}
+}
+
+// Start launches a goroutine per job. Each job first runs after one interval has elapsed.
+func (sc *Scheduler) Start(ctx context.Context) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for _, job := range sc.jobs {
+		go sc.loop(ctx, job)
+	}
+}
+
+// RunNow runs the named job immediately in the background.
+// Returns false if no such job exists.
+func (sc *Scheduler) RunNow(ctx context.Context, name string) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for _, job := range sc.jobs {
+		if job.Name == name {
+			go sc.run(ctx, job)
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns a snapshot of the status of all registered jobs.
+func (sc *Scheduler) Status() []JobStatus {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	statuses := make([]JobStatus, 0, len(sc.jobs))
+	for _, job := range sc.jobs {
+		statuses = append(statuses, *sc.status[job.Name])
+	}
+	return statuses
+}
+
+// loop runs job every interval until ctx is done.
+func (sc *Scheduler) loop(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sc.run(ctx, job)
+		}
+	}
+}
+
+// run executes a single run of job, skipping it if a previous run is still in progress.
+func (sc *Scheduler) run(ctx context.Context, job Job) {
+	sc.mu.Lock()
+	status := sc.status[job.Name]
+	if status.Running {
+		sc.mu.Unlock()
+		log.Printf("Job %s still running, skipping this run", job.Name)
+		return
+	}
+	status.Running = true
+	sc.mu.Unlock()
+
+	start := time.Now()
+	err := job.Run(ctx)
+	elapsed := time.Since(start)
+
+	sc.mu.Lock()
+	status.Running = false
+	status.Runs++
+	status.LastRun = start
+	status.LastDuration = elapsed.Round(time.Millisecond).String()
+	status.LastError = ""
+	if err != nil {
+		status.LastError = err.Error()
+	}
+	sc.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Job %s failed after %v: %v", job.Name, elapsed.Round(time.Millisecond), err)
+		return
+	}
+	log.Printf("Job %s completed in %v", job.Name, elapsed.Round(time.Millisecond))
+}
+
+// handleListJobs handles GET /api/admin/jobs - returns the status of all scheduled jobs.
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	jobs := s.scheduler.Status()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"jobs":  jobs,
+		"count": len(jobs),
+	})
+}
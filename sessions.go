@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// DefaultSessionTTL is how long a session stays valid without activity.
+	DefaultSessionTTL = 7 * 24 * time.Hour
+
+	// sessionCookieName is the name of the session cookie.
+	sessionCookieName = "elib_session"
+
+	// sessionKeyPrefix prefixes the Redis hashes holding session data.
+	sessionKeyPrefix = "gdrive:session:"
+
+	// userSessionsKeyPrefix prefixes the Redis sets indexing each user's sessions.
+	userSessionsKeyPrefix = "gdrive:user-sessions:"
+
+	// sessionRefreshInterval is the minimum time between sliding expiry extensions,
+	// so active users do not write to Redis on every request.
+	sessionRefreshInterval = time.Hour
+)
+
+// Session is an active login session on one device.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     int64     `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	RemoteAddr string    `json:"remote_addr"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeen   time.Time `json:"last_seen"`
+	Current    bool      `json:"current"`
+}
+
+// sessionContextKey is the context key under which the current session is stored.
+type sessionContextKey struct{}
+
+// sessionFromContext returns the current session stored by loadUser, or nil.
+func sessionFromContext(ctx context.Context) *Session {
+	sess, _ := ctx.Value(sessionContextKey{}).(*Session)
+	return sess
+}
+
+// sessionID derives the session ID from the cookie token. Only the ID is stored,
+// so a Redis dump or a device listing does not reveal usable tokens.
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:16])
+}
+
+// userSessionsKey returns the key of the set indexing the sessions of userID.
+func userSessionsKey(userID int64) string {
+	return userSessionsKeyPrefix + strconv.FormatInt(userID, 10)
+}
+
+// setSessionCookie writes the session cookie, valid for the session TTL.
+func (s *Server) setSessionCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(s.cfg.SessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.cfg.PublicURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// startSession creates a login session for user and sets the session cookie.
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, user *User) error {
+	ctx := r.Context()
+	token := randomToken()
+	id := sessionID(token)
+	now := time.Now().Unix()
+
+	_, err := s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, sessionKeyPrefix+id,
+			"user_id", user.ID,
+			"user_agent", r.UserAgent(),
+			"remote_addr", r.RemoteAddr,
+			"created_at", now,
+			"last_seen", now,
+		)
+		pipe.Expire(ctx, sessionKeyPrefix+id, s.cfg.SessionTTL)
+		pipe.SAdd(ctx, userSessionsKey(user.ID), id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.setSessionCookie(w, token)
+	return nil
+}
+
+// getSession loads a session by ID. Returns nil (and no error) if it does not exist.
+func (s *Server) getSession(ctx context.Context, id string) (*Session, error) {
+	fields, err := s.redis.HGetAll(ctx, sessionKeyPrefix+id).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	userID, err := strconv.ParseInt(fields["user_id"], 10, 64)
+	if err != nil {
+		return nil, nil
+	}
+	created, _ := strconv.ParseInt(fields["created_at"], 10, 64)
+	lastSeen, _ := strconv.ParseInt(fields["last_seen"], 10, 64)
+
+	return &Session{
+		ID:         id,
+		UserID:     userID,
+		UserAgent:  fields["user_agent"],
+		RemoteAddr: fields["remote_addr"],
+		CreatedAt:  time.Unix(created, 0),
+		LastSeen:   time.Unix(lastSeen, 0),
+	}, nil
+}
+
+// loadUser is middleware that resolves the session cookie to a user and stores the
+// user and session in the request context. Active sessions have their expiry extended
+// (sliding expiry). Requests without a valid session pass through anonymously.
+func (s *Server) loadUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(sessionCookieName)
+		if err != nil || cookie.Value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		sess, err := s.getSession(ctx, sessionID(cookie.Value))
+		if err != nil || sess == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := s.getUser(ctx, sess.UserID)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if time.Since(sess.LastSeen) > sessionRefreshInterval {
+			sess.LastSeen = time.Now()
+			_, err := s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.HSet(ctx, sessionKeyPrefix+sess.ID, "last_seen", sess.LastSeen.Unix())
+				pipe.Expire(ctx, sessionKeyPrefix+sess.ID, s.cfg.SessionTTL)
+				return nil
+			})
+			if err == nil {
+				s.setSessionCookie(w, cookie.Value)
+			}
+		}
+
+		sess.Current = true
+		ctx = context.WithValue(ctx, userContextKey{}, user)
+		ctx = context.WithValue(ctx, sessionContextKey{}, sess)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// listSessions returns the active sessions of userID, most recently used first.
+// Index entries of expired sessions are removed along the way.
+func (s *Server) listSessions(ctx context.Context, userID int64) ([]Session, error) {
+	ids, err := s.redis.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(ids))
+	for _, id := range ids {
+		sess, err := s.getSession(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if sess == nil {
+			s.redis.SRem(ctx, userSessionsKey(userID), id)
+			continue
+		}
+		sessions = append(sessions, *sess)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+	return sessions, nil
+}
+
+// revokeSessions deletes the given sessions of userID.
+func (s *Server) revokeSessions(ctx context.Context, userID int64, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	keys := make([]string, len(ids))
+	members := make([]any, len(ids))
+	for i, id := range ids {
+		keys[i] = sessionKeyPrefix + id
+		members[i] = id
+	}
+
+	_, err := s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, keys...)
+		pipe.SRem(ctx, userSessionsKey(userID), members...)
+		return nil
+	})
+	return err
+}
+
+// endSession deletes the request's session and clears the session cookie.
+func (s *Server) endSession(w http.ResponseWriter, r *http.Request) error {
+	if sess := sessionFromContext(r.Context()); sess != nil {
+		if err := s.revokeSessions(r.Context(), sess.UserID, sess.ID); err != nil {
+			return err
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	return nil
+}
+
+// handleListSessions handles GET /api/me/sessions - lists the signed-in user's active devices.
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	current := sessionFromContext(r.Context())
+	if current == nil {
+		writeError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+
+	sessions, err := s.listSessions(r.Context(), current.UserID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current.ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"sessions": sessions,
+		"count":    len(sessions),
+	})
+}
+
+// handleRevokeSession handles DELETE /api/me/sessions/:id - signs out one device.
+func (s *Server) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	current := sessionFromContext(r.Context())
+	if current == nil {
+		writeError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+
+	ctx := r.Context()
+	id := chi.URLParam(r, "id")
+	sess, err := s.getSession(ctx, id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Sessions of other users are reported as missing rather than forbidden
+	if sess == nil || sess.UserID != current.UserID {
+		writeError(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	if err := s.revokeSessions(ctx, current.UserID, id); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "session revoked"})
+}
+
+// handleRevokeOtherSessions handles DELETE /api/me/sessions - signs out every
+// device except the current one.
+func (s *Server) handleRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	current := sessionFromContext(r.Context())
+	if current == nil {
+		writeError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+
+	ctx := r.Context()
+	sessions, err := s.listSessions(ctx, current.UserID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var ids []string
+	for _, sess := range sessions {
+		if sess.ID != current.ID {
+			ids = append(ids, sess.ID)
+		}
+	}
+
+	if err := s.revokeSessions(ctx, current.UserID, ids...); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"message": "other sessions revoked",
+		"revoked": len(ids),
+	})
+}
+
+// handleRevokeUserSessions handles DELETE /api/admin/users/:id/sessions - signs a user
+// out of every device, for example after an account is compromised.
+func (s *Server) handleRevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user ID")
+		return
+	}
+
+	ctx := r.Context()
+	sessions, err := s.listSessions(ctx, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ids := make([]string, len(sessions))
+	for i, sess := range sessions {
+		ids[i] = sess.ID
+	}
+
+	if err := s.revokeSessions(ctx, userID, ids...); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.audit(r, "user.sessions.revoke", "", strconv.FormatInt(userID, 10))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"message": "sessions revoked",
+		"revoked": len(ids),
+	})
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// DefaultShareLinkTTL is the validity of share links when SHARE_LINK_TTL is not set.
+// Links are long-lived because they are often printed as QR codes.
+const DefaultShareLinkTTL = 365 * 24 * time.Hour
+
+// errInvalidShareToken is returned for malformed, tampered or expired share tokens.
+var errInvalidShareToken = errors.New("invalid or expired share link")
+
+// randomToken returns 32 random bytes encoded as unpadded base64url.
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// signShareToken returns a token of the form "<fileID>.<expiry>.<signature>"
+// granting download access to fileID until expires.
+func (s *Server) signShareToken(fileID string, expires time.Time) string {
+	payload := fileID + "." + strconv.FormatInt(expires.Unix(), 36)
+	return payload + "." + s.shareSignature(payload)
+}
+
+// verifyShareToken checks a share token's signature and expiry and returns its file ID.
+func (s *Server) verifyShareToken(token string) (string, error) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return "", errInvalidShareToken
+	}
+
+	payload, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(s.shareSignature(payload))) {
+		return "", errInvalidShareToken
+	}
+
+	fileID, expiry, ok := strings.Cut(payload, ".")
+	if !ok {
+		return "", errInvalidShareToken
+	}
+
+	unix, err := strconv.ParseInt(expiry, 36, 64)
+	if err != nil || time.Now().After(time.Unix(unix, 0)) {
+		return "", errInvalidShareToken
+	}
+	return fileID, nil
+}
+
+// shareSignature returns the truncated HMAC-SHA256 of payload.
+func (s *Server) shareSignature(payload string) string {
+	mac := hmac.New(sha256.New, []byte(s.cfg.ShareSecret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// shareURL issues a signed share URL for fileID.
+func (s *Server) shareURL(fileID string) (string, time.Time) {
+	expires := time.Now().Add(s.cfg.ShareLinkTTL)
+	return strings.TrimSuffix(s.cfg.PublicURL, "/") + "/s/" + s.signShareToken(fileID, expires), expires
+}
+
+// handleShareLink handles GET /api/files/:id/share - issues a signed share URL.
+func (s *Server) handleShareLink(w http.ResponseWriter, r *http.Request) {
+	fileID := chi.URLParam(r, "id")
+	file, err := s.findFile(r.Context(), fileID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if file == nil {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	url, expires := s.shareURL(file.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"url":        url,
+		"file_name":  file.Name,
+		"expires_at": expires.Format(time.RFC3339),
+	})
+}
+
+// ShareQRQuery holds the query parameters of GET /api/files/:id/share/qr.
+type ShareQRQuery struct {
+	Scale int `query:"scale" validate:"min=1,max=32"` // Pixels per module
+}
+
+// handleShareQR handles GET /api/files/:id/share/qr - returns a PNG QR code of a signed share URL.
+// The optional scale parameter sets the pixels per module (default 8).
+func (s *Server) handleShareQR(w http.ResponseWriter, r *http.Request) {
+	fileID := chi.URLParam(r, "id")
+	file, err := s.findFile(r.Context(), fileID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if file == nil {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	q := ShareQRQuery{Scale: 8}
+	if !decodeQuery(w, r, &q) {
+		return
+	}
+
+	url, _ := s.shareURL(file.ID)
+	qr, err := encodeQR([]byte(url))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Rendered to a buffer so encoding failures still get an error response
+	var buf bytes.Buffer
+	if err := qr.writePNG(&buf, q.Scale); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	buf.WriteTo(w)
+}
+
+// handleSharedDownload handles GET /s/:token - downloads the file a signed share link points to.
+func (s *Server) handleSharedDownload(w http.ResponseWriter, r *http.Request) {
+	fileID, err := s.verifyShareToken(chi.URLParam(r, "token"))
+	if err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	file, err := s.findFile(r.Context(), fileID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if file == nil {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	s.serveDownload(w, r, file.ID, "", file.Name, file.FolderPath, file.MimeType, file.Size)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// SharedItem is a file or folder shared directly with the service account.
+type SharedItem struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	MimeType   string `json:"mime_type"`
+	Size       int64  `json:"size"`
+	SharedBy   string `json:"shared_by,omitempty"` // Email of the contributor who shared it
+	SharedTime string `json:"shared_time,omitempty"`
+	OwnedByMe  bool   `json:"owned_by_me"` // Owned by the service account, so already importable as is
+	Modified   string `json:"modified_time,omitempty"`
+	CanCopy    bool   `json:"can_copy"`
+}
+
+// SharedQuery selects which of the service account's files are listed.
+type SharedQuery struct {
+	Source string `query:"source" validate:"oneof=shared owned recent"`
+}
+
+// sharedSources maps each listing source to its Drive query and sort order.
+var sharedSources = map[string]struct{ q, orderBy string }{
+	"shared": {"sharedWithMe and trashed=false", "sharedWithMeTime desc"},
+	"owned":  {"'me' in owners and trashed=false", "name"},
+	"recent": {"trashed=false", "modifiedTime desc"},
+}
+
+// recentSharedLimit is the number of items listed by the "recent" source.
+const recentSharedLimit = 100
+
+// ImportSharedRequest represents a request to import items shared with the service account.
+type ImportSharedRequest struct {
+	FileIDs  []string `json:"file_ids" validate:"min=1,max=100"`
+	Mode     string   `json:"mode" validate:"omitempty,oneof=copy shortcut"` // Defaults to copy
+	FolderID string   `json:"folder_id" validate:"max=200"`                  // Defaults to the library root
+}
+
+// ImportResult is the outcome of importing a single shared item.
+type ImportResult struct {
+	FileID   string `json:"file_id"`
+	Status   string `json:"status"` // imported or failed
+	NewID    string `json:"new_id,omitempty"`
+	Unshared bool   `json:"unshared"` // The original was removed from "Shared with me"
+	Error    string `json:"error,omitempty"`
+}
+
+// handleListShared handles GET /api/admin/shared - returns the items contributors
+// shared directly with the service account, which are not part of the library yet.
+// With source=owned it lists the files the service account owns instead, and with
+// source=recent the most recently modified files it can see, whoever owns them.
+func (s *Server) handleListShared(w http.ResponseWriter, r *http.Request) {
+	q := SharedQuery{Source: "shared"}
+	if !decodeQuery(w, r, &q) {
+		return
+	}
+	source := sharedSources[q.Source]
+
+	ctx := r.Context()
+	items := make([]SharedItem, 0)
+	collect := func(list *drive.FileList) error {
+		for _, f := range list.Files {
+			item := SharedItem{
+				ID:         f.Id,
+				Name:       f.Name,
+				MimeType:   f.MimeType,
+				Size:       f.Size,
+				SharedTime: f.SharedWithMeTime,
+				OwnedByMe:  f.OwnedByMe,
+				Modified:   f.ModifiedTime,
+				CanCopy:    f.Capabilities != nil && f.Capabilities.CanCopy,
+			}
+			if f.SharingUser != nil {
+				item.SharedBy = f.SharingUser.EmailAddress
+			}
+			items = append(items, item)
+		}
+		return nil
+	}
+
+	call := s.driveService.Files.List().
+		Context(ctx).
+		Q(source.q).
+		OrderBy(source.orderBy).
+		Fields("nextPageToken, files(id, name, mimeType, size, sharingUser(emailAddress), sharedWithMeTime, ownedByMe, modifiedTime, capabilities(canCopy))")
+	var err error
+	if q.Source == "recent" {
+		var list *drive.FileList
+		if list, err = call.PageSize(recentSharedLimit).Do(); err == nil {
+			err = collect(list)
+		}
+	} else {
+		err = call.PageSize(1000).Pages(ctx, collect)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("unable to list shared items: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"source": q.Source,
+		"items":  items,
+		"count":  len(items),
+	})
+}
+
+// handleImportShared handles POST /api/admin/shared/import - imports items shared with
+// the service account into the library. Files are copied by default, after which the
+// service account's access to the original is removed so it leaves "Shared with me".
+// Folders, which cannot be copied, and items imported with mode "shortcut" are linked
+// by a shortcut instead and stay shared.
+func (s *Server) handleImportShared(w http.ResponseWriter, r *http.Request) {
+	var req ImportSharedRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = "copy"
+	}
+	if req.FolderID == "" {
+		req.FolderID = "root"
+	} else if !driveIDPattern.MatchString(req.FolderID) {
+		writeValidationError(w, FieldError{Field: "folder_id", Message: "must be a Drive folder ID"})
+		return
+	}
+
+	ctx := r.Context()
+	about, err := s.driveService.About.Get().Context(ctx).Fields("user(permissionId)").Do()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("unable to identify the service account: %v", err))
+		return
+	}
+
+	results := make([]ImportResult, len(req.FileIDs))
+	imported := 0
+	for i, fileID := range req.FileIDs {
+		results[i] = s.importShared(ctx, fileID, req, about.User.PermissionId)
+		if results[i].Status == "imported" {
+			imported++
+			s.audit(r, "shared.import", fileID, results[i].NewID)
+		}
+	}
+
+	if imported > 0 {
+		if err := s.invalidateCache(ctx); err != nil {
+			logf(ctx, "Warning: Failed to invalidate cache: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"folder_id": req.FolderID,
+		"mode":      req.Mode,
+		"imported":  imported,
+		"failed":    len(results) - imported,
+		"results":   results,
+	})
+}
+
+// importShared copies or shortcuts a single shared item into the import folder.
+// permissionID is the service account's own permission, removed from copied originals.
+func (s *Server) importShared(ctx context.Context, fileID string, req ImportSharedRequest, permissionID string) ImportResult {
+	result := ImportResult{FileID: fileID, Status: "failed"}
+	if !driveIDPattern.MatchString(fileID) {
+		result.Error = "invalid file ID"
+		return result
+	}
+
+	f, err := s.driveService.Files.Get(fileID).Context(ctx).SupportsAllDrives(true).Fields("id, name, mimeType, ownedByMe").Do()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if f.OwnedByMe {
+		result.Error = "already owned by the service account"
+		return result
+	}
+
+	var created *drive.File
+	if req.Mode == "shortcut" || f.MimeType == folderMimeType {
+		created, err = s.driveService.Files.Create(&drive.File{
+			Name:            f.Name,
+			MimeType:        shortcutMimeType,
+			Parents:         []string{req.FolderID},
+			ShortcutDetails: &drive.FileShortcutDetails{TargetId: f.Id},
+		}).Context(ctx).SupportsAllDrives(true).Fields("id").Do()
+	} else {
+		created, err = s.driveService.Files.Copy(f.Id, &drive.File{
+			Name:    f.Name,
+			Parents: []string{req.FolderID},
+		}).Context(ctx).SupportsAllDrives(true).Fields("id").Do()
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Status, result.NewID = "imported", created.Id
+
+	// Shortcuts need the original to stay accessible
+	if req.Mode == "shortcut" || f.MimeType == folderMimeType {
+		return result
+	}
+	err = s.driveService.Permissions.Delete(f.Id, permissionID).Context(ctx).SupportsAllDrives(true).Do()
+	if err != nil {
+		// Access granted through a group or domain cannot be removed individually
+		logf(ctx, "Warning: unable to remove shared original %s: %v", f.Id, err)
+		return result
+	}
+	result.Unshared = true
+	return result
+}
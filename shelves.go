@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Shelf is a curated, ordered list of files shown on the homepage.
+type Shelf struct {
+	ID          int64          `json:"id"`
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Position    int            `json:"position"`
+	Files       []LiteFileInfo `json:"files"`
+}
+
+// ShelfRequest represents a request to create or replace a shelf.
+type ShelfRequest struct {
+	Title       string   `json:"title" validate:"required,max=100"`
+	Description string   `json:"description" validate:"max=500"`
+	Position    int      `json:"position" validate:"min=0"` // Shelves are listed by ascending position
+	FileIDs     []string `json:"file_ids" validate:"max=200"`
+}
+
+// Errors of shelf transactions reported to clients.
+var (
+	errShelfTitleTaken = errors.New("a shelf with this title already exists")
+	errShelfNotFound   = errors.New("shelf not found")
+)
+
+// writeShelfError writes the response for a failed shelf transaction.
+func writeShelfError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errShelfTitleTaken):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, errShelfNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// saveShelfFiles replaces the files of a shelf, keeping their order.
+func saveShelfFiles(ctx context.Context, tx *sql.Tx, shelfID int64, fileIDs []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM shelf_files WHERE shelf_id = ?", shelfID); err != nil {
+		return err
+	}
+	for i, fileID := range fileIDs {
+		_, err := tx.ExecContext(ctx,
+			"INSERT OR IGNORE INTO shelf_files (shelf_id, file_id, position) VALUES (?, ?, ?)",
+			shelfID, fileID, i,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleListShelves handles GET /api/shelves - returns the shelves with their files
+// in order. Files no longer in the library or hidden from listings are left out.
+func (s *Server) handleListShelves(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	files, err := s.getFiles(ctx, false)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	overlay, err := s.loadOverlay(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	byID := make(map[string]LiteFileInfo, len(files))
+	for _, f := range files {
+		if !overlay.hidden[f.ID] {
+			byID[f.ID] = LiteFileInfo{ID: f.ID, Name: f.Name, MimeType: f.MimeType, Size: f.Size}
+		}
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT s.id, s.title, s.description, s.position, COALESCE(sf.file_id, '')
+		FROM shelves s
+		LEFT JOIN shelf_files sf ON sf.shelf_id = s.id
+		ORDER BY s.position, s.id, sf.position
+	`)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	shelves := make([]Shelf, 0)
+	for rows.Next() {
+		var shelf Shelf
+		var fileID string
+		if err := rows.Scan(&shelf.ID, &shelf.Title, &shelf.Description, &shelf.Position, &fileID); err != nil {
+			continue
+		}
+		if n := len(shelves); n == 0 || shelves[n-1].ID != shelf.ID {
+			shelf.Files = make([]LiteFileInfo, 0)
+			shelves = append(shelves, shelf)
+		}
+		if f, ok := byID[fileID]; ok {
+			last := &shelves[len(shelves)-1]
+			last.Files = append(last.Files, f)
+		}
+	}
+
+	if rows.Err() != nil {
+		writeError(w, http.StatusInternalServerError, rows.Err().Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"shelves": shelves,
+		"count":   len(shelves),
+	})
+}
+
+// handleCreateShelf handles POST /api/admin/shelves - creates a shelf.
+func (s *Server) handleCreateShelf(w http.ResponseWriter, r *http.Request) {
+	var req ShelfRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+	var id int64
+	err := s.writeTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx,
+			"INSERT INTO shelves (title, description, position) VALUES (?, ?, ?)",
+			req.Title, req.Description, req.Position,
+		)
+		if constraintError(err) {
+			return errShelfTitleTaken
+		}
+		if err != nil {
+			return err
+		}
+		id, _ = result.LastInsertId()
+		return saveShelfFiles(ctx, tx, id, req.FileIDs)
+	})
+	if err != nil {
+		writeShelfError(w, err)
+		return
+	}
+
+	s.audit(r, "shelf.create", "", req.Title)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":      id,
+		"message": "shelf created",
+	})
+}
+
+// handleUpdateShelf handles PUT /api/admin/shelves/:id - replaces a shelf's title,
+// description, position and files.
+func (s *Server) handleUpdateShelf(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid shelf ID")
+		return
+	}
+
+	var req ShelfRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+	err = s.writeTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx,
+			"UPDATE shelves SET title = ?, description = ?, position = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			req.Title, req.Description, req.Position, id,
+		)
+		if constraintError(err) {
+			return errShelfTitleTaken
+		}
+		if err != nil {
+			return err
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return errShelfNotFound
+		}
+		return saveShelfFiles(ctx, tx, id, req.FileIDs)
+	})
+	if err != nil {
+		writeShelfError(w, err)
+		return
+	}
+
+	s.audit(r, "shelf.update", "", req.Title)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "shelf updated"})
+}
+
+// handleDeleteShelf handles DELETE /api/admin/shelves/:id - removes a shelf.
+func (s *Server) handleDeleteShelf(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid shelf ID")
+		return
+	}
+
+	ctx := r.Context()
+	var title string
+	err = s.writeTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, "SELECT title FROM shelves WHERE id = ?", id).Scan(&title)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errShelfNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM shelf_files WHERE shelf_id = ?", id); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM shelves WHERE id = ?", id)
+		return err
+	})
+	if err != nil {
+		writeShelfError(w, err)
+		return
+	}
+
+	s.audit(r, "shelf.delete", "", title)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "shelf deleted"})
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SnapshotRequest represents a snapshot creation request.
+type SnapshotRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// DiffSnapshotsQuery holds the query parameters of GET /api/admin/snapshots/diff.
+type DiffSnapshotsQuery struct {
+	From string `query:"from" validate:"required"`
+	To   string `query:"to" validate:"required"`
+}
+
+// Snapshot describes a named capture of the library file index.
+type Snapshot struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	FileCount int       `json:"file_count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SnapshotFile is a single file entry recorded in a snapshot.
+type SnapshotFile struct {
+	FileID      string `json:"file_id"`
+	FileName    string `json:"file_name"`
+	MimeType    string `json:"mime_type"`
+	Size        int64  `json:"size"`
+	MD5Checksum string `json:"md5_checksum,omitempty"`
+	FolderPath  string `json:"folder_path"`
+}
+
+// ChangedFile pairs the old and new entries of a file that differs between snapshots.
+type ChangedFile struct {
+	FileID string       `json:"file_id"`
+	Fields []string     `json:"fields"`
+	From   SnapshotFile `json:"from"`
+	To     SnapshotFile `json:"to"`
+}
+
+// handleCreateSnapshot handles POST /api/admin/snapshots - captures the current file index.
+func (s *Server) handleCreateSnapshot(w http.ResponseWriter, r *http.Request) {
+	var req SnapshotRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+	files, err := s.getFiles(ctx, false)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	checksums, err := s.listChecksums(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var id int64
+	err = s.writeTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx,
+			"INSERT INTO snapshots (name, file_count) VALUES (?, ?)",
+			req.Name, len(files),
+		)
+		if err != nil {
+			return err
+		}
+		id, _ = result.LastInsertId()
+
+		stmt, err := tx.PrepareContext(ctx, `
+			INSERT INTO snapshot_files (snapshot_id, file_id, file_name, mime_type, size, md5_checksum, folder_path)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, f := range files {
+			if _, err := stmt.ExecContext(ctx, id, f.ID, f.Name, f.MimeType, f.Size, checksums[f.ID], f.FolderPath); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if constraintError(err) {
+		writeError(w, http.StatusConflict, fmt.Sprintf("unable to create snapshot %q: %v", req.Name, err))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.audit(r, "snapshot.create", "", req.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":         id,
+		"name":       req.Name,
+		"file_count": len(files),
+		"message":    "snapshot created",
+	})
+}
+
+// handleListSnapshots handles GET /api/admin/snapshots - returns all snapshots.
+func (s *Server) handleListSnapshots(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.Query(`
+		SELECT id, name, file_count, created_at
+		FROM snapshots
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	snapshots := make([]Snapshot, 0)
+	for rows.Next() {
+		var sn Snapshot
+		if err := rows.Scan(&sn.ID, &sn.Name, &sn.FileCount, &sn.CreatedAt); err != nil {
+			continue
+		}
+		snapshots = append(snapshots, sn)
+	}
+
+	if rows.Err() != nil {
+		writeError(w, http.StatusInternalServerError, rows.Err().Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"snapshots": snapshots,
+		"count":     len(snapshots),
+	})
+}
+
+// handleDiffSnapshots handles GET /api/admin/snapshots/diff?from=<name>&to=<name> -
+// reports files added, removed and changed between two snapshots.
+func (s *Server) handleDiffSnapshots(w http.ResponseWriter, r *http.Request) {
+	var q DiffSnapshotsQuery
+	if !decodeQuery(w, r, &q) {
+		return
+	}
+	fromName, toName := q.From, q.To
+
+	from, err := s.loadSnapshotFiles(fromName)
+	if err != nil {
+		s.snapshotError(w, fromName, err)
+		return
+	}
+
+	to, err := s.loadSnapshotFiles(toName)
+	if err != nil {
+		s.snapshotError(w, toName, err)
+		return
+	}
+
+	added := make([]SnapshotFile, 0)
+	removed := make([]SnapshotFile, 0)
+	changed := make([]ChangedFile, 0)
+
+	for id, newFile := range to {
+		oldFile, exists := from[id]
+		if !exists {
+			added = append(added, newFile)
+			continue
+		}
+		if fields := diffSnapshotFile(oldFile, newFile); len(fields) > 0 {
+			changed = append(changed, ChangedFile{FileID: id, Fields: fields, From: oldFile, To: newFile})
+		}
+	}
+
+	for id, oldFile := range from {
+		if _, exists := to[id]; !exists {
+			removed = append(removed, oldFile)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"from":    fromName,
+		"to":      toName,
+		"added":   added,
+		"removed": removed,
+		"changed": changed,
+		"summary": map[string]int{
+			"added":   len(added),
+			"removed": len(removed),
+			"changed": len(changed),
+		},
+	})
+}
+
+// loadSnapshotFiles returns the files recorded in the named snapshot, keyed by file ID.
+// Returns sql.ErrNoRows if the snapshot does not exist.
+func (s *Server) loadSnapshotFiles(name string) (map[string]SnapshotFile, error) {
+	var id int64
+	if err := s.db.QueryRow("SELECT id FROM snapshots WHERE name = ?", name).Scan(&id); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT file_id, file_name, mime_type, size, COALESCE(md5_checksum, ''), folder_path
+		FROM snapshot_files
+		WHERE snapshot_id = ?
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := make(map[string]SnapshotFile)
+	for rows.Next() {
+		var f SnapshotFile
+		if err := rows.Scan(&f.FileID, &f.FileName, &f.MimeType, &f.Size, &f.MD5Checksum, &f.FolderPath); err != nil {
+			return nil, err
+		}
+		files[f.FileID] = f
+	}
+	return files, rows.Err()
+}
+
+// snapshotError writes the HTTP error for a failed snapshot lookup.
+func (s *Server) snapshotError(w http.ResponseWriter, name string, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("snapshot %q not found", name))
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+// diffSnapshotFile returns the names of the fields that differ between two entries of the same file.
+func diffSnapshotFile(a, b SnapshotFile) []string {
+	var fields []string
+	if a.FileName != b.FileName {
+		fields = append(fields, "file_name")
+	}
+	if a.FolderPath != b.FolderPath {
+		fields = append(fields, "folder_path")
+	}
+	if a.MimeType != b.MimeType {
+		fields = append(fields, "mime_type")
+	}
+	if a.Size != b.Size {
+		fields = append(fields, "size")
+	}
+	if a.MD5Checksum != b.MD5Checksum {
+		fields = append(fields, "md5_checksum")
+	}
+	return fields
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// DefaultSpoolMaxBytes is the largest file spooled to disk when SPOOL_MAX_BYTES is not set.
+const DefaultSpoolMaxBytes = 512 << 20
+
+// shouldSpool reports whether a download of size bytes is spooled to disk.
+// Spooling is disabled when no spool directory is configured, and files of
+// unknown size or above the limit are always streamed directly.
+func (s *Server) shouldSpool(size int64) bool {
+	return s.cfg.SpoolDir != "" && size > 0 && size <= s.cfg.SpoolMaxBytes
+}
+
+// spoolDownload downloads fileID to a temporary file at full speed, which releases
+// the Drive connection as soon as possible, then copies the file to w at whatever
+// pace the client reads. Drive errors are therefore reported before any byte is written.
+func (s *Server) spoolDownload(ctx context.Context, fileID string, w io.Writer) error {
+	if err := os.MkdirAll(s.cfg.SpoolDir, 0755); err != nil {
+		return fmt.Errorf("unable to create spool directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(s.cfg.SpoolDir, spoolPattern)
+	if err != nil {
+		return fmt.Errorf("unable to create spool file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := s.driveClient.StreamFile(ctx, fileID, f); err != nil {
+		return err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, f)
+	return err
+}
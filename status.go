@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/api/drive/v3"
+)
+
+const (
+	// FileStatusIndexKey is the Redis key for the hash mapping file IDs to their status.
+	FileStatusIndexKey = "gdrive:statuses"
+
+	// statusProperty is the appProperties key holding a file's status in Drive.
+	statusProperty = "status"
+)
+
+// FileStatus is the triage metadata of a file kept in Drive: a short status such as
+// "New" or "Needs review" in its appProperties, and its description.
+type FileStatus struct {
+	Status      string `json:"status,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// FileStatusRequest represents a request to set the status and description of a file.
+// Empty values clear them.
+type FileStatusRequest struct {
+	Status      string `json:"status" validate:"max=50"`
+	Description string `json:"description" validate:"max=2000"`
+}
+
+// fileStatuses returns the status of every file that has one, keyed by file ID. The
+// index is cached in Redis for as long as the file listing.
+func (s *Server) fileStatuses(ctx context.Context) (map[string]FileStatus, error) {
+	cached, err := s.redis.HGetAll(ctx, FileStatusIndexKey).Result()
+	if err == nil && len(cached) > 0 {
+		statuses := make(map[string]FileStatus, len(cached))
+		for id, data := range cached {
+			var status FileStatus
+			if id == "" || json.Unmarshal([]byte(data), &status) != nil {
+				continue
+			}
+			statuses[id] = status
+		}
+		return statuses, nil
+	}
+
+	statuses := make(map[string]FileStatus)
+	err = s.driveService.Files.List().
+		Context(ctx).
+		Q("trashed=false").
+		Fields("nextPageToken, files(id, description, appProperties)").
+		PageSize(1000).
+		Pages(ctx, func(r *drive.FileList) error {
+			for _, f := range r.Files {
+				status := FileStatus{Status: f.AppProperties[statusProperty], Description: f.Description}
+				if status != (FileStatus{}) {
+					statuses[f.Id] = status
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list file statuses: %w", err)
+	}
+
+	// An empty hash cannot be stored, so a placeholder marks the index as built
+	values := []any{"", ""}
+	for id, status := range statuses {
+		data, _ := json.Marshal(status)
+		values = append(values, id, data)
+	}
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, FileStatusIndexKey)
+	pipe.HSet(ctx, FileStatusIndexKey, values...)
+	pipe.Expire(ctx, FileStatusIndexKey, CacheExpiration)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logf(ctx, "Warning: Failed to cache file statuses: %v", err)
+	}
+	return statuses, nil
+}
+
+// listedStatuses returns the statuses of the listed files.
+func listedStatuses[T any](files []T, statuses map[string]FileStatus, id func(T) string) map[string]FileStatus {
+	listed := make(map[string]FileStatus)
+	for _, f := range files {
+		if status, ok := statuses[id(f)]; ok {
+			listed[id(f)] = status
+		}
+	}
+	return listed
+}
+
+// handleSetFileStatus handles PUT /api/admin/files/:id/status - sets the status and
+// description of a file in Drive, for badges in listings.
+func (s *Server) handleSetFileStatus(w http.ResponseWriter, r *http.Request) {
+	var req FileStatusRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+	fileID := chi.URLParam(r, "id")
+	if !driveIDPattern.MatchString(fileID) {
+		writeError(w, http.StatusBadRequest, "invalid file ID")
+		return
+	}
+
+	// Empty values have to be sent explicitly to clear them
+	_, err := s.driveService.Files.Update(fileID, &drive.File{
+		Description:     req.Description,
+		AppProperties:   map[string]string{statusProperty: req.Status},
+		ForceSendFields: []string{"Description"},
+	}).Context(ctx).SupportsAllDrives(true).Fields("id").Do()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("unable to update file status: %v", err))
+		return
+	}
+
+	// Keep a built index current; a missing one is built from Drive on next use
+	status := FileStatus{Status: req.Status, Description: req.Description}
+	if n, _ := s.redis.Exists(ctx, FileStatusIndexKey).Result(); n > 0 {
+		if status == (FileStatus{}) {
+			err = s.redis.HDel(ctx, FileStatusIndexKey, fileID).Err()
+		} else {
+			data, _ := json.Marshal(status)
+			err = s.redis.HSet(ctx, FileStatusIndexKey, fileID, data).Err()
+		}
+		if err != nil {
+			logf(ctx, "Warning: Failed to update cached status of %s: %v", fileID, err)
+		}
+	}
+
+	s.audit(r, "file.status", fileID, req.Status)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"file_id":     fileID,
+		"status":      status.Status,
+		"description": status.Description,
+	})
+}
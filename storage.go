@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	// DefaultBusyTimeout is how long SQLite waits for a lock before failing with SQLITE_BUSY.
+	DefaultBusyTimeout = 5 * time.Second
+
+	// DefaultMaxOpenConns is the default size of the database connection pool. With WAL,
+	// readers no longer block each other or the single writer.
+	DefaultMaxOpenConns = 8
+
+	// DefaultWriteRetries is how often a write failing with SQLITE_BUSY is retried.
+	DefaultWriteRetries = 3
+)
+
+// StorageConfig holds the SQLite connection settings.
+type StorageConfig struct {
+	BusyTimeout  time.Duration // Wait for locks before failing with SQLITE_BUSY
+	MaxOpenConns int           // Maximum open connections
+	MaxIdleConns int           // Maximum idle connections kept in the pool
+	WriteRetries int           // Retries of writes still failing with SQLITE_BUSY or SQLITE_LOCKED
+}
+
+// loadStorageConfig reads the SQLite connection settings from the environment.
+func loadStorageConfig() StorageConfig {
+	maxOpen := int(getEnvInt("DB_MAX_OPEN_CONNS", DefaultMaxOpenConns))
+	if maxOpen == 0 {
+		maxOpen = DefaultMaxOpenConns
+	}
+	return StorageConfig{
+		BusyTimeout:  getEnvDuration("DB_BUSY_TIMEOUT", DefaultBusyTimeout),
+		MaxOpenConns: maxOpen,
+		MaxIdleConns: int(getEnvInt("DB_MAX_IDLE_CONNS", int64(maxOpen))),
+		WriteRetries: int(getEnvInt("DB_WRITE_RETRIES", DefaultWriteRetries)),
+	}
+}
+
+// openDB opens the SQLite database at path in WAL mode with a busy timeout, and sizes
+// the connection pool. In-memory databases are private to a connection, so they keep
+// a single one.
+func openDB(path string, cfg StorageConfig) (*sql.DB, error) {
+	params := url.Values{}
+	params.Set("_journal_mode", "WAL")
+	params.Set("_busy_timeout", fmt.Sprint(cfg.BusyTimeout.Milliseconds()))
+	params.Set("_txlock", "immediate") // Take the write lock up front instead of failing on upgrade
+
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	db, err := sql.Open("sqlite3", path+sep+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	maxOpen, maxIdle := cfg.MaxOpenConns, cfg.MaxIdleConns
+	if path == ":memory:" || strings.Contains(path, "mode=memory") {
+		maxOpen, maxIdle = 1, 1
+	}
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(min(maxIdle, maxOpen))
+	return db, nil
+}
+
+// busyError reports whether a SQLite statement failed because the database was locked.
+func busyError(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
+
+// constraintError reports whether a SQLite statement violated a constraint, such as a
+// unique index.
+func constraintError(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint
+}
+
+// retryBusy runs write, retrying with exponential backoff while the database is still
+// locked after the busy timeout.
+func (s *Server) retryBusy(ctx context.Context, write func() error) error {
+	backoff := 50 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err := write()
+		if err == nil || !busyError(err) || attempt >= s.cfg.Storage.WriteRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// execWrite executes a write statement, retrying it while the database is locked.
+// All writes outside transactions go through it; transactions use writeTx.
+func (s *Server) execWrite(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	var result sql.Result
+	err := s.retryBusy(ctx, func() error {
+		var err error
+		result, err = s.db.ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
+
+// writeTx runs fn in a transaction and commits it, retrying the whole transaction
+// while the database is locked. fn may run more than once, so it must not have
+// effects outside the transaction.
+func (s *Server) writeTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return s.retryBusy(ctx, func() error {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
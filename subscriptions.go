@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/abiiranathan/gdrive"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// subscriptionEventsPrefix prefixes the Redis Pub/Sub channel carrying a user's
+	// subscription events to their open event streams.
+	subscriptionEventsPrefix = "gdrive:events:user:"
+
+	// subscriptionKeepAlive is how often an idle event stream sends a comment line,
+	// so proxies do not close it.
+	subscriptionKeepAlive = 30 * time.Second
+)
+
+// errNonPublicAddress is returned when a webhook resolves to an address that is not
+// publicly routable.
+var errNonPublicAddress = errors.New("webhook address is not public")
+
+// webhookClient delivers subscription events to webhooks. Webhook URLs are chosen by
+// users, so connections are only made to public addresses. The check runs on the
+// resolved address at dial time, which also covers redirects and DNS rebinding, and
+// no proxy is used so the checked address is the one connected to.
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				addr, err := netip.ParseAddrPort(address)
+				if err != nil || !publicAddress(addr.Addr()) {
+					return errNonPublicAddress
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+}
+
+// publicAddress reports whether addr is publicly routable, i.e. not loopback, private,
+// link-local (which includes cloud metadata endpoints), multicast or unspecified.
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !addr.IsLoopback() && !addr.IsLinkLocalUnicast()
+}
+
+// validateWebhookURL checks that a webhook URL uses https and that its host resolves
+// only to public addresses.
+func validateWebhookURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return errors.New("must be an https URL")
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return errors.New("host does not resolve")
+	}
+	for _, addr := range addrs {
+		if !publicAddress(addr) {
+			return errors.New("must not point to a loopback, private or link-local address")
+		}
+	}
+	return nil
+}
+
+// Subscription is a user's subscription to new files in a folder and its subfolders.
+type Subscription struct {
+	ID         int64     `json:"id"`
+	FolderID   string    `json:"folder_id"`
+	Channel    string    `json:"channel"` // email, webhook or sse
+	WebhookURL string    `json:"webhook_url,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// SubscriptionRequest represents a request to subscribe to a folder.
+type SubscriptionRequest struct {
+	FolderID   string `json:"folder_id" validate:"required"`
+	Channel    string `json:"channel" validate:"omitempty,oneof=email webhook sse"`
+	WebhookURL string `json:"webhook_url" validate:"max=2000"`
+}
+
+// SubscriptionEvent is delivered to subscribers when new files appear in a folder.
+type SubscriptionEvent struct {
+	Type     string             `json:"type"` // Always "files.added"
+	FolderID string             `json:"folder_id"`
+	Folder   string             `json:"folder"`
+	Files    []SubscriptionFile `json:"files"`
+	Time     time.Time          `json:"time"`
+}
+
+// SubscriptionFile is a new file as delivered to subscribers. Drive links are left
+// out, so files are opened through the server and its checks.
+type SubscriptionFile struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	MimeType   string `json:"mime_type"`
+	Size       int64  `json:"size"`
+	FolderPath string `json:"folder_path"`
+}
+
+// subscriber is a subscription with the address of its user.
+type subscriber struct {
+	Subscription
+	UserID int64
+	Email  string
+}
+
+// notifySubscribers delivers new files to the users subscribed to the folders they
+// appeared in, directly or in a subfolder. Hidden files are left out. Delivery failures
+// are logged, not returned, so one unreachable webhook does not fail the refresh.
+func (s *Server) notifySubscribers(ctx context.Context, newFiles []gdrive.FileInfo) error {
+	overlay, err := s.loadOverlay(ctx)
+	if err != nil {
+		return err
+	}
+	newFiles = applyOverlay(newFiles, overlay, func(f gdrive.FileInfo) string { return f.ID })
+	if len(newFiles) == 0 {
+		return nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT fs.id, fs.folder_id, fs.channel, fs.webhook_url, fs.created_at, u.id, u.email
+		FROM folder_subscriptions fs
+		JOIN users u ON u.id = fs.user_id
+	`)
+	if err != nil {
+		return err
+	}
+	var subscribers []subscriber
+	for rows.Next() {
+		var sub subscriber
+		if err := rows.Scan(&sub.ID, &sub.FolderID, &sub.Channel, &sub.WebhookURL, &sub.CreatedAt, &sub.UserID, &sub.Email); err != nil {
+			continue
+		}
+		subscribers = append(subscribers, sub)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	if len(subscribers) == 0 {
+		return nil
+	}
+
+	// Paths are resolved now, so subscriptions follow folders that were renamed or moved
+	paths, err := s.folderPaths(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subscribers {
+		folder, ok := paths[sub.FolderID]
+		if !ok {
+			continue
+		}
+
+		event := SubscriptionEvent{Type: "files.added", FolderID: sub.FolderID, Folder: folder, Time: time.Now()}
+		for _, f := range newFiles {
+			if f.FolderPath == folder || strings.HasPrefix(f.FolderPath, folder+"/") {
+				event.Files = append(event.Files, SubscriptionFile{
+					ID:         f.ID,
+					Name:       f.Name,
+					MimeType:   f.MimeType,
+					Size:       f.Size,
+					FolderPath: f.FolderPath,
+				})
+			}
+		}
+		if len(event.Files) == 0 {
+			continue
+		}
+
+		if err := s.deliverEvent(ctx, sub, event); err != nil {
+			logf(ctx, "Warning: unable to notify subscription %d via %s: %v", sub.ID, sub.Channel, err)
+		}
+	}
+	return nil
+}
+
+// deliverEvent sends an event over a subscription's channel.
+func (s *Server) deliverEvent(ctx context.Context, sub subscriber, event SubscriptionEvent) error {
+	switch sub.Channel {
+	case "email":
+		var body strings.Builder
+		fmt.Fprintf(&body, "New files in %s:\n\n", event.Folder)
+		for _, f := range event.Files {
+			fmt.Fprintf(&body, "  - %s (%s)\n", f.Name, formatBytes(f.Size))
+		}
+		return s.sendMail([]string{sub.Email}, fmt.Sprintf("E-Library: %d new files in %s", len(event.Files), event.Folder), body.String())
+
+	case "webhook":
+		// Subscriptions made before https was required are not delivered in the clear
+		if !strings.HasPrefix(sub.WebhookURL, "https://") {
+			return errors.New("webhook URL must use https")
+		}
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.WebhookURL, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := webhookClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook returned %s", resp.Status)
+		}
+		return nil
+
+	default:
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		return s.redis.Publish(ctx, subscriptionEventsPrefix+strconv.FormatInt(sub.UserID, 10), payload).Err()
+	}
+}
+
+// handleListSubscriptions handles GET /api/me/subscriptions - returns the current user's
+// folder subscriptions.
+func (s *Server) handleListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+
+	rows, err := s.db.QueryContext(r.Context(), `
+		SELECT id, folder_id, channel, webhook_url, created_at
+		FROM folder_subscriptions
+		WHERE user_id = ?
+		ORDER BY created_at DESC
+	`, user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	subscriptions := make([]Subscription, 0)
+	for rows.Next() {
+		var sub Subscription
+		if err := rows.Scan(&sub.ID, &sub.FolderID, &sub.Channel, &sub.WebhookURL, &sub.CreatedAt); err != nil {
+			continue
+		}
+		subscriptions = append(subscriptions, sub)
+	}
+
+	if rows.Err() != nil {
+		writeError(w, http.StatusInternalServerError, rows.Err().Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"subscriptions": subscriptions,
+		"count":         len(subscriptions),
+	})
+}
+
+// handleSubscribe handles POST /api/me/subscriptions - subscribes the current user to
+// new files in a folder, by email (the default), webhook or server-sent events.
+func (s *Server) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+
+	var req SubscriptionRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Channel == "" {
+		req.Channel = "email"
+	}
+
+	switch req.Channel {
+	case "email":
+		if s.cfg.SMTP.Host == "" {
+			writeError(w, http.StatusNotImplemented, "SMTP is not configured")
+			return
+		}
+	case "webhook":
+		if err := validateWebhookURL(r.Context(), req.WebhookURL); err != nil {
+			writeValidationError(w, FieldError{Field: "webhook_url", Message: err.Error()})
+			return
+		}
+	}
+	if req.Channel != "webhook" {
+		req.WebhookURL = ""
+	}
+
+	ctx := r.Context()
+	if folder, err := s.libraryFolder(ctx, req.FolderID); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	} else if folder == "" {
+		writeValidationError(w, FieldError{Field: "folder_id", Message: "must be a folder in the library"})
+		return
+	}
+
+	result, err := s.execWrite(ctx,
+		"INSERT INTO folder_subscriptions (user_id, folder_id, channel, webhook_url) VALUES (?, ?, ?, ?)",
+		user.ID, req.FolderID, req.Channel, req.WebhookURL,
+	)
+	if err != nil {
+		writeError(w, http.StatusConflict, "already subscribed to this folder on this channel")
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(Subscription{
+		ID:         id,
+		FolderID:   req.FolderID,
+		Channel:    req.Channel,
+		WebhookURL: req.WebhookURL,
+		CreatedAt:  time.Now(),
+	})
+}
+
+// handleUnsubscribe handles DELETE /api/me/subscriptions/:id - removes one of the
+// current user's subscriptions.
+func (s *Server) handleUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid subscription ID")
+		return
+	}
+
+	result, err := s.execWrite(r.Context(),
+		"DELETE FROM folder_subscriptions WHERE id = ? AND user_id = ?", id, user.ID,
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		writeError(w, http.StatusNotFound, "subscription not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "unsubscribed"})
+}
+
+// handleSubscriptionEvents handles GET /api/me/subscriptions/events - streams the
+// current user's "sse" subscription events as server-sent events until the client
+// disconnects.
+func (s *Server) handleSubscriptionEvents(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	ctx := r.Context()
+	pubsub := s.redis.Subscribe(ctx, subscriptionEventsPrefix+strconv.FormatInt(user.ID, 10))
+	defer pubsub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(subscriptionKeepAlive)
+	defer keepAlive.Stop()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "event: files.added\ndata: %s\n\n", msg.Payload)
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/abiiranathan/gdrive"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// SuggestQuery holds the query parameters of GET /api/search/suggest.
+type SuggestQuery struct {
+	Q     string `query:"q" validate:"required,max=100"`
+	Limit int    `query:"limit" validate:"min=1,max=20"`
+}
+
+// Suggestion is a file offered while a search is typed.
+type Suggestion struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	FolderPath string `json:"folder_path"`
+}
+
+// suggestKey is an entry of the prefix index: the normalized name, or the part of it
+// starting at a later word, and the file it belongs to.
+type suggestKey struct {
+	key   string
+	whole bool // key starts at the beginning of the name
+	file  int  // Index into suggestIndex.files
+}
+
+// suggestIndex is a sorted prefix index over file names. It is rebuilt whenever the
+// cached listing changes.
+type suggestIndex struct {
+	mu       sync.RWMutex
+	builtAt  int64 // Cache timestamp of the listing the index was built from
+	files    []gdrive.FileInfo
+	keys     []suggestKey
+	building sync.Mutex
+}
+
+// foldName lowercases a name and strips its diacritics, so "Élan" matches "elan".
+func foldName(name string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, name)
+	if err != nil {
+		folded = name
+	}
+	return strings.ToLower(folded)
+}
+
+// build replaces the index with one over files.
+func (idx *suggestIndex) build(files []gdrive.FileInfo, builtAt int64) {
+	keys := make([]suggestKey, 0, len(files)*3)
+	for i, f := range files {
+		name := foldName(f.Name)
+		keys = append(keys, suggestKey{key: name, whole: true, file: i})
+
+		// Later words are indexed too, so "war" finds "The Art of War"
+		for j := 1; j < len(name); j++ {
+			if name[j-1] == ' ' && name[j] != ' ' {
+				keys = append(keys, suggestKey{key: name[j:], file: i})
+			}
+		}
+	}
+	slices.SortFunc(keys, func(a, b suggestKey) int { return strings.Compare(a.key, b.key) })
+
+	idx.mu.Lock()
+	idx.files, idx.keys, idx.builtAt = files, keys, builtAt
+	idx.mu.Unlock()
+}
+
+// lookup returns up to limit files whose name or a word of it starts with prefix, names
+// starting with it first, skipping files for which skip returns true.
+func (idx *suggestIndex) lookup(prefix string, limit int, skip func(id string) bool) []Suggestion {
+	prefix = foldName(prefix)
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	start, _ := slices.BinarySearchFunc(idx.keys, prefix, func(k suggestKey, p string) int {
+		return strings.Compare(k.key, p)
+	})
+	var whole, words []int
+	for _, k := range idx.keys[start:] {
+		if !strings.HasPrefix(k.key, prefix) {
+			break
+		}
+		if k.whole {
+			whole = append(whole, k.file)
+		} else {
+			words = append(words, k.file)
+		}
+	}
+
+	suggestions := make([]Suggestion, 0, limit)
+	seen := make(map[string]bool)
+	for _, i := range append(whole, words...) {
+		f := idx.files[i]
+		if seen[f.ID] || skip(f.ID) {
+			continue
+		}
+		seen[f.ID] = true
+		suggestions = append(suggestions, Suggestion{ID: f.ID, Name: f.Name, FolderPath: f.FolderPath})
+		if len(suggestions) == limit {
+			break
+		}
+	}
+	return suggestions
+}
+
+// suggestions returns the index, rebuilding it first if the cached listing changed
+// since it was built.
+func (s *Server) suggestions(ctx context.Context) (*suggestIndex, error) {
+	idx := s.suggest
+	timestamp, _ := s.redis.Get(ctx, CacheTimestampKey).Int64()
+
+	idx.mu.RLock()
+	current := idx.keys != nil && idx.builtAt == timestamp
+	idx.mu.RUnlock()
+	if current {
+		return idx, nil
+	}
+
+	// Concurrent requests wait for a single rebuild
+	idx.building.Lock()
+	defer idx.building.Unlock()
+
+	files, err := s.getFiles(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	timestamp, _ = s.redis.Get(ctx, CacheTimestampKey).Int64()
+
+	idx.mu.RLock()
+	current = idx.keys != nil && idx.builtAt == timestamp
+	idx.mu.RUnlock()
+	if !current {
+		idx.build(files, timestamp)
+	}
+	return idx, nil
+}
+
+// handleSuggest handles GET /api/search/suggest?q= - returns files whose name, or a
+// word of it, starts with q, for search box autocompletion. Hidden files are left out.
+func (s *Server) handleSuggest(w http.ResponseWriter, r *http.Request) {
+	q := SuggestQuery{Limit: 10}
+	if !decodeQuery(w, r, &q) {
+		return
+	}
+
+	ctx := r.Context()
+	idx, err := s.suggestions(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	overlay, err := s.loadOverlay(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	suggestions := idx.lookup(q.Q, q.Limit, func(id string) bool { return overlay.hidden[id] })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"query":       q.Q,
+		"suggestions": suggestions,
+		"count":       len(suggestions),
+	})
+}
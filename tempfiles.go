@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// spoolPattern names the temporary files of spooled downloads.
+	spoolPattern = "download-*"
+
+	// workDirPattern names the work directories of HLS transcodes and ebook conversions.
+	workDirPattern = "*.tmp-*"
+
+	// bundlePattern names the temporary files of catalog site bundles being built.
+	bundlePattern = "gdrive-catalog-*.zip"
+
+	// staleTempAge is the age after which a temporary file left behind by a crash is
+	// removed at startup. Younger files may belong to another server sharing the directory.
+	staleTempAge = time.Hour
+)
+
+// removeStaleTemp removes the entries of dir matching pattern that were last modified
+// more than staleTempAge ago, and returns how many were removed.
+func removeStaleTemp(dir, pattern string) int {
+	if dir == "" {
+		return 0
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return 0
+	}
+
+	removed := 0
+	for _, path := range matches {
+		info, err := os.Lstat(path)
+		if err != nil || time.Since(info.ModTime()) < staleTempAge {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("Warning: unable to remove stale temporary file %s: %v", path, err)
+			continue
+		}
+		removed++
+	}
+	return removed
+}
+
+// tempDir returns the directory for temporary files other than work directories: the
+// spool directory if one is configured, or the system temporary directory.
+func (s *Server) tempDir() string {
+	if s.cfg.SpoolDir != "" {
+		return s.cfg.SpoolDir
+	}
+	return os.TempDir()
+}
+
+// createTemp creates a temporary file in tempDir for data too large to hold in memory.
+// Files left behind by a crash are removed by cleanTempFiles.
+func (s *Server) createTemp(pattern string) (*os.File, error) {
+	if err := os.MkdirAll(s.tempDir(), 0755); err != nil {
+		return nil, fmt.Errorf("unable to create temporary directory: %w", err)
+	}
+	f, err := os.CreateTemp(s.tempDir(), pattern)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create temporary file: %w", err)
+	}
+	return f, nil
+}
+
+// cleanTempFiles removes the spool files and work directories left behind when the
+// server stopped in the middle of a download, transcode, conversion or catalog export.
+func (s *Server) cleanTempFiles() {
+	removed := removeStaleTemp(s.cfg.SpoolDir, spoolPattern)
+	removed += removeStaleTemp(s.tempDir(), bundlePattern)
+	if s.hls != nil {
+		removed += removeStaleTemp(s.hls.cacheDir, workDirPattern)
+	}
+	if s.converter != nil {
+		removed += removeStaleTemp(s.converter.cacheDir, workDirPattern)
+	}
+	if removed > 0 {
+		log.Printf("Removed %d stale temporary files", removed)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+const (
+	// UsageReportInterval is how often the monthly download report job checks whether
+	// last month's report has been stored yet.
+	UsageReportInterval = 24 * time.Hour
+
+	// departmentTagPrefix prefixes the tags assigning files to a department, e.g. "department:Physics".
+	departmentTagPrefix = "department:"
+)
+
+// csvUsageHeader is the header row of CSV download reports.
+var csvUsageHeader = []string{"group", "name", "downloads", "bytes", "users", "files"}
+
+// UsageRow aggregates the downloads of one user, department or folder.
+type UsageRow struct {
+	Name      string `json:"name"`
+	Downloads int64  `json:"downloads"`
+	Bytes     int64  `json:"bytes"` // Bytes actually sent
+	Users     int64  `json:"users"` // Distinct signed-in users
+	Files     int64  `json:"files"` // Distinct files
+}
+
+// UsageReport is the download report of one calendar month (UTC).
+type UsageReport struct {
+	Month        string     `json:"month"` // e.g. "2026-09"
+	Downloads    int64      `json:"downloads"`
+	ByUser       []UsageRow `json:"by_user"`
+	ByDepartment []UsageRow `json:"by_department"`
+	ByFolder     []UsageRow `json:"by_folder"`
+}
+
+// UsageReportQuery holds the query parameters of GET /api/admin/usage.
+type UsageReportQuery struct {
+	Month  string `query:"month"` // YYYY-MM; defaults to the previous month
+	Format string `query:"format" validate:"oneof=json csv xlsx"`
+}
+
+// usageAggregate accumulates a UsageRow.
+type usageAggregate struct {
+	row   UsageRow
+	users map[string]bool
+	files map[string]bool
+}
+
+// parseReportMonth returns the first instant of a YYYY-MM month, or of the previous
+// month when v is empty.
+func parseReportMonth(v string) (time.Time, error) {
+	if v == "" {
+		now := time.Now().UTC()
+		return time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	return time.Parse("2006-01", v)
+}
+
+// buildUsageReport aggregates the downloads of the month starting at start by user,
+// by department (from the files' "department:" tags) and by folder.
+func (s *Server) buildUsageReport(ctx context.Context, start time.Time) (*UsageReport, error) {
+	end := start.AddDate(0, 1, 0)
+
+	files, err := s.getFiles(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	folders := make(map[string]string, len(files))
+	for _, f := range files {
+		folders[f.ID] = f.FolderPath
+	}
+
+	tags, _, err := s.fileLabels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load tags: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT d.file_id, COALESCE(u.email, ''), COALESCE(d.bytes_sent, d.bytes)
+		FROM downloads d
+		LEFT JOIN users u ON u.id = d.user_id
+		WHERE d.downloaded_at >= ? AND d.downloaded_at < ?
+	`, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := map[string]map[string]*usageAggregate{"user": {}, "department": {}, "folder": {}}
+	add := func(group, name, fileID, email string, sent int64) {
+		agg, ok := groups[group][name]
+		if !ok {
+			agg = &usageAggregate{row: UsageRow{Name: name}, users: map[string]bool{}, files: map[string]bool{}}
+			groups[group][name] = agg
+		}
+		agg.row.Downloads++
+		agg.row.Bytes += sent
+		agg.files[fileID] = true
+		if email != "" {
+			agg.users[email] = true
+		}
+	}
+
+	report := &UsageReport{Month: start.Format("2006-01")}
+	for rows.Next() {
+		var fileID, email string
+		var sent int64
+		if err := rows.Scan(&fileID, &email, &sent); err != nil {
+			continue
+		}
+		report.Downloads++
+
+		add("user", cmp.Or(email, "(anonymous)"), fileID, email, sent)
+
+		folder, ok := folders[fileID]
+		if !ok {
+			folder = "(removed)"
+		}
+		add("folder", folder, fileID, email, sent)
+
+		departments := 0
+		for _, tag := range tags[fileID] {
+			if department, ok := strings.CutPrefix(tag, departmentTagPrefix); ok {
+				add("department", department, fileID, email, sent)
+				departments++
+			}
+		}
+		if departments == 0 {
+			add("department", "(none)", fileID, email, sent)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sorted := func(group string) []UsageRow {
+		result := make([]UsageRow, 0, len(groups[group]))
+		for _, agg := range groups[group] {
+			agg.row.Users, agg.row.Files = int64(len(agg.users)), int64(len(agg.files))
+			result = append(result, agg.row)
+		}
+		slices.SortFunc(result, func(a, b UsageRow) int {
+			return cmp.Or(cmp.Compare(b.Downloads, a.Downloads), cmp.Compare(a.Name, b.Name))
+		})
+		return result
+	}
+	report.ByUser = sorted("user")
+	report.ByDepartment = sorted("department")
+	report.ByFolder = sorted("folder")
+	return report, nil
+}
+
+// groups returns the report's sections by group name, in output order.
+func (rep *UsageReport) groups() []struct {
+	name string
+	rows []UsageRow
+} {
+	return []struct {
+		name string
+		rows []UsageRow
+	}{
+		{"user", rep.ByUser},
+		{"department", rep.ByDepartment},
+		{"folder", rep.ByFolder},
+	}
+}
+
+// writeCSV writes every section of the report as rows of a single CSV.
+func (rep *UsageReport) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvUsageHeader)
+	for _, g := range rep.groups() {
+		for _, row := range g.rows {
+			cw.Write([]string{
+				g.name,
+				row.Name,
+				strconv.FormatInt(row.Downloads, 10),
+				strconv.FormatInt(row.Bytes, 10),
+				strconv.FormatInt(row.Users, 10),
+				strconv.FormatInt(row.Files, 10),
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeXLSX writes the report as a workbook with one sheet per section.
+func (rep *UsageReport) writeXLSX(w io.Writer) error {
+	var sheets []xlsxSheet
+	for _, g := range rep.groups() {
+		sheet := xlsxSheet{
+			Name: "By " + g.name,
+			Rows: [][]any{{strings.ToUpper(g.name[:1]) + g.name[1:], "Downloads", "Bytes", "Users", "Files"}},
+		}
+		for _, row := range g.rows {
+			sheet.Rows = append(sheet.Rows, []any{row.Name, row.Downloads, row.Bytes, row.Users, row.Files})
+		}
+		sheets = append(sheets, sheet)
+	}
+	return writeXLSX(w, sheets)
+}
+
+// storeUsageReport is the monthly report job. Once a month has ended, it uploads that
+// month's download report as XLSX and CSV to the reports folder.
+func (s *Server) storeUsageReport(ctx context.Context) error {
+	if s.cfg.ReportsFolder == "" {
+		return nil
+	}
+
+	start, _ := parseReportMonth("")
+	month := start.Format("2006-01")
+
+	var stored string
+	err := s.db.QueryRowContext(ctx, "SELECT month FROM usage_reports WHERE month = ?", month).Scan(&stored)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	report, err := s.buildUsageReport(ctx, start)
+	if err != nil {
+		return err
+	}
+
+	folderID, err := s.childFolder(ctx, "root", s.cfg.ReportsFolder)
+	if err != nil {
+		return err
+	}
+
+	var xlsxData, csvData bytes.Buffer
+	if err := report.writeXLSX(&xlsxData); err != nil {
+		return err
+	}
+	if err := report.writeCSV(&csvData); err != nil {
+		return err
+	}
+
+	name := "Downloads " + month
+	upload := func(fileName, mimeType string, data io.Reader) (string, error) {
+		f, err := s.driveService.Files.Create(&drive.File{
+			Name:     fileName,
+			MimeType: mimeType,
+			Parents:  []string{folderID},
+		}).Context(ctx).SupportsAllDrives(true).Media(data).Fields("id").Do()
+		if err != nil {
+			return "", fmt.Errorf("unable to upload report: %w", err)
+		}
+		return f.Id, nil
+	}
+	xlsxID, err := upload(name+".xlsx", xlsxMimeType, &xlsxData)
+	if err != nil {
+		return err
+	}
+	csvID, err := upload(name+".csv", "text/csv", &csvData)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.execWrite(ctx,
+		"INSERT INTO usage_reports (month, xlsx_file_id, csv_file_id) VALUES (?, ?, ?)",
+		month, xlsxID, csvID,
+	)
+	return err
+}
+
+// handleGetUsageReport handles GET /api/admin/usage - returns the download report of a
+// month (?month=YYYY-MM, by default the previous one) as JSON, CSV or XLSX.
+func (s *Server) handleGetUsageReport(w http.ResponseWriter, r *http.Request) {
+	q := UsageReportQuery{Format: "json"}
+	if !decodeQuery(w, r, &q) {
+		return
+	}
+
+	start, err := parseReportMonth(q.Month)
+	if err != nil {
+		writeValidationError(w, FieldError{Field: "month", Message: "must be formatted as YYYY-MM"})
+		return
+	}
+
+	report, err := s.buildUsageReport(r.Context(), start)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	switch q.Format {
+	case "csv", "xlsx":
+		var buf bytes.Buffer
+		contentType := "text/csv; charset=utf-8"
+		if q.Format == "xlsx" {
+			contentType = xlsxMimeType
+			err = report.writeXLSX(&buf)
+		} else {
+			err = report.writeCSV(&buf)
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="downloads-%s.%s"`, report.Month, q.Format))
+		buf.WriteTo(w)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
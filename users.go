@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User is a library user account.
+type User struct {
+	ID        int64     `json:"id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Provider  string    `json:"provider"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateUserRequest represents a local user creation request.
+type CreateUserRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Name     string `json:"name" validate:"max=100"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
+// userContextKey is the context key under which the authenticated user is stored.
+type userContextKey struct{}
+
+// userFromContext returns the authenticated user stored by loadUser, or nil.
+func userFromContext(ctx context.Context) *User {
+	u, _ := ctx.Value(userContextKey{}).(*User)
+	return u
+}
+
+// getUser loads a user by ID.
+func (s *Server) getUser(ctx context.Context, id int64) (*User, error) {
+	var u User
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, email, name, provider, created_at FROM users WHERE id = ?", id,
+	).Scan(&u.ID, &u.Email, &u.Name, &u.Provider, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// resolveUser returns the user linked to an external identity, creating the account
+// on first login.
+func (s *Server) resolveUser(ctx context.Context, provider string, id *Identity) (*User, error) {
+	_, err := s.execWrite(ctx, `
+		INSERT INTO users (email, name, provider, subject) VALUES (?, ?, ?, ?)
+		ON CONFLICT(provider, subject) DO UPDATE SET email = excluded.email, name = excluded.name
+	`, id.Email, id.Name, provider, id.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	var userID int64
+	err = s.db.QueryRowContext(ctx,
+		"SELECT id FROM users WHERE provider = ? AND subject = ?", provider, id.Subject,
+	).Scan(&userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.getUser(ctx, userID)
+}
+
+// handleMe handles GET /api/me - returns the signed-in user.
+func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
+	u := userFromContext(r.Context())
+	if u == nil {
+		writeError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
+
+// handleCreateUser handles POST /api/admin/users - creates a local password account.
+func (s *Server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req CreateUserRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	// Validation guarantees the address parses
+	addr, _ := mail.ParseAddress(req.Email)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = addr.Address
+	}
+
+	result, err := s.execWrite(r.Context(),
+		"INSERT INTO users (email, name, provider, subject, password_hash) VALUES (?, ?, ?, ?, ?)",
+		addr.Address, name, localProviderName, addr.Address, string(hash),
+	)
+	if err != nil {
+		writeError(w, http.StatusConflict, "user already exists")
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	s.audit(r, "user.create", "", addr.Address)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":      id,
+		"message": "user created",
+	})
+}
+
+// handleListUsers handles GET /api/admin/users - returns all user accounts.
+func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.Query("SELECT id, email, name, provider, created_at FROM users ORDER BY email")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	users := make([]User, 0)
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &u.Provider, &u.CreatedAt); err != nil {
+			continue
+		}
+		users = append(users, u)
+	}
+
+	if rows.Err() != nil {
+		writeError(w, http.StatusInternalServerError, rows.Err().Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"users": users,
+		"count": len(users),
+	})
+}
+
+// errInvalidCredentials is returned when a password login fails.
+var errInvalidCredentials = errors.New("invalid email or password")
+
+// localProviderName is the provider name of password accounts stored in SQLite.
+const localProviderName = "local"
+
+// dummyPasswordHash is compared against when an account does not exist.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte(randomToken()), bcrypt.DefaultCost)
+	return hash
+})
+
+// localProvider authenticates password accounts stored in the users table.
+type localProvider struct {
+	db *sql.DB
+}
+
+// Name returns the provider name.
+func (p *localProvider) Name() string { return localProviderName }
+
+// Authenticate verifies an email and password against the stored bcrypt hash.
+func (p *localProvider) Authenticate(ctx context.Context, email, password string) (*Identity, error) {
+	var name string
+	var hash sql.NullString
+	err := p.db.QueryRowContext(ctx,
+		"SELECT name, password_hash FROM users WHERE provider = ? AND subject = ?",
+		localProviderName, email,
+	).Scan(&name, &hash)
+	if err != nil || !hash.Valid {
+		// Compare anyway so unknown accounts take as long as wrong passwords
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return nil, errInvalidCredentials
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash.String), []byte(password)) != nil {
+		return nil, errInvalidCredentials
+	}
+	return &Identity{Subject: email, Email: email, Name: name}, nil
+}
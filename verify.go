@@ -0,0 +1,262 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// MirrorEntry is a file found in a Drive folder or its local mirror.
+type MirrorEntry struct {
+	Path     string `json:"path"` // Slash-separated, relative to the mirrored folder
+	Size     int64  `json:"size"`
+	Checksum string `json:"md5_checksum,omitempty"`
+	FileID   string `json:"file_id,omitempty"`
+}
+
+// MirrorDiff is a difference between a Drive folder and its local mirror.
+type MirrorDiff struct {
+	Path   string       `json:"path"`
+	Status string       `json:"status"` // missing, extra, corrupted or duplicate
+	Reason string       `json:"reason,omitempty"`
+	Drive  *MirrorEntry `json:"drive,omitempty"`
+	Local  *MirrorEntry `json:"local,omitempty"`
+
+	Duplicates []MirrorEntry `json:"duplicates,omitempty"` // Drive files sharing the path
+}
+
+// MirrorReport is the machine-readable output of the verify command.
+type MirrorReport struct {
+	FolderID string       `json:"folder_id"`
+	Dir      string       `json:"dir"`
+	Checked  int          `json:"checked"`
+	Skipped  []string     `json:"skipped"` // Google Workspace files, which have no checksum
+	Diffs    []MirrorDiff `json:"diffs"`
+}
+
+// walkDriveFolder lists every file under a Drive folder, keyed by path relative to it.
+// Google-native files are returned separately since they have no content to compare.
+// Drive allows several files with the same name in a folder; all files sharing a
+// path are also returned by path.
+func (s *Server) walkDriveFolder(ctx context.Context, folderID string) (map[string]MirrorEntry, []string, map[string][]MirrorEntry, error) {
+	files := make(map[string]MirrorEntry)
+	duplicates := make(map[string][]MirrorEntry)
+	var native []string
+
+	type pending struct{ id, path string }
+	queue := []pending{{id: folderID}}
+	for len(queue) > 0 {
+		folder := queue[0]
+		queue = queue[1:]
+
+		err := s.driveService.Files.List().
+			Context(ctx).
+			SupportsAllDrives(true).
+			IncludeItemsFromAllDrives(true).
+			Q(fmt.Sprintf("'%s' in parents and trashed=false", folder.id)).
+			Fields("nextPageToken, files(id, name, mimeType, size, md5Checksum)").
+			PageSize(1000).
+			Pages(ctx, func(r *drive.FileList) error {
+				for _, f := range r.Files {
+					p := path.Join(folder.path, f.Name)
+					switch {
+					case f.MimeType == "application/vnd.google-apps.folder":
+						queue = append(queue, pending{id: f.Id, path: p})
+					case f.Md5Checksum == "":
+						native = append(native, p)
+					default:
+						entry := MirrorEntry{Path: p, Size: f.Size, Checksum: f.Md5Checksum, FileID: f.Id}
+						if first, ok := files[p]; ok {
+							if len(duplicates[p]) == 0 {
+								duplicates[p] = []MirrorEntry{first}
+							}
+							duplicates[p] = append(duplicates[p], entry)
+							continue
+						}
+						files[p] = entry
+					}
+				}
+				return nil
+			})
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("unable to list folder %s: %w", folder.id, err)
+		}
+	}
+	return files, native, duplicates, nil
+}
+
+// walkLocalMirror lists every regular file under dir, keyed by slash-separated relative path.
+// Checksums are computed later, only for files that also exist in Drive.
+func walkLocalMirror(dir string) (map[string]MirrorEntry, error) {
+	files := make(map[string]MirrorEntry)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		files[rel] = MirrorEntry{Path: rel, Size: info.Size()}
+		return nil
+	})
+	return files, err
+}
+
+// fileMD5 returns the hex-encoded MD5 checksum of a local file.
+func fileMD5(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// compareMirror compares a Drive folder listing with its local mirror, hashing the
+// local copies with the given number of workers. Sizes are compared first, so only
+// files of matching size are hashed. Paths shared by several Drive files are reported
+// as duplicates, since a mirror can hold only one of them.
+func compareMirror(dir string, remote, local map[string]MirrorEntry, duplicates map[string][]MirrorEntry, workers int) []MirrorDiff {
+	var mu sync.Mutex
+	diffs := make([]MirrorDiff, 0)
+	report := func(d MirrorDiff) {
+		mu.Lock()
+		diffs = append(diffs, d)
+		mu.Unlock()
+	}
+
+	for p, entries := range duplicates {
+		d := MirrorDiff{
+			Path:       p,
+			Status:     "duplicate",
+			Reason:     fmt.Sprintf("%d files in Drive share this path", len(entries)),
+			Duplicates: entries,
+		}
+		if l, ok := local[p]; ok {
+			d.Local = &l
+		}
+		report(d)
+	}
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for p, r := range remote {
+		if len(duplicates[p]) > 0 {
+			continue
+		}
+		l, ok := local[p]
+		if !ok {
+			report(MirrorDiff{Path: p, Status: "missing", Drive: &r})
+			continue
+		}
+		if l.Size != r.Size {
+			report(MirrorDiff{Path: p, Status: "corrupted", Reason: "size mismatch", Drive: &r, Local: &l})
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			sum, err := fileMD5(filepath.Join(dir, filepath.FromSlash(p)))
+			l.Checksum = sum
+			switch {
+			case err != nil:
+				report(MirrorDiff{Path: p, Status: "corrupted", Reason: err.Error(), Drive: &r, Local: &l})
+			case sum != r.Checksum:
+				report(MirrorDiff{Path: p, Status: "corrupted", Reason: "checksum mismatch", Drive: &r, Local: &l})
+			}
+		}()
+	}
+
+	for p, l := range local {
+		if _, ok := remote[p]; !ok {
+			report(MirrorDiff{Path: p, Status: "extra", Local: &l})
+		}
+	}
+	wg.Wait()
+
+	slices.SortFunc(diffs, func(a, b MirrorDiff) int {
+		return cmp.Or(cmp.Compare(a.Path, b.Path), cmp.Compare(a.Status, b.Status))
+	})
+	return diffs
+}
+
+// runVerifyCommand compares a Drive folder with a local mirror and prints the
+// differences as JSON. It fails when the mirror differs, so it can gate backup scripts.
+func runVerifyCommand(ctx context.Context, cfg Config, args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	folderID := flags.String("folder", "", "ID of the Drive folder that is mirrored")
+	dir := flags.String("dir", "", "local directory holding the mirror")
+	workers := flags.Int("workers", 8, "number of local files hashed in parallel")
+	flags.Parse(args)
+
+	if *folderID == "" || *dir == "" {
+		return errors.New("-folder and -dir are required")
+	}
+	if *workers < 1 {
+		return errors.New("-workers must be at least 1")
+	}
+
+	server, err := NewServer(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+
+	remote, native, duplicates, err := server.walkDriveFolder(ctx, *folderID)
+	if err != nil {
+		return err
+	}
+	local, err := walkLocalMirror(*dir)
+	if err != nil {
+		return fmt.Errorf("unable to walk %s: %w", *dir, err)
+	}
+
+	slices.Sort(native)
+	report := MirrorReport{
+		FolderID: *folderID,
+		Dir:      *dir,
+		Checked:  len(remote),
+		Skipped:  append([]string{}, native...),
+		Diffs:    compareMirror(*dir, remote, local, duplicates, *workers),
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+
+	if len(report.Diffs) > 0 {
+		return fmt.Errorf("mirror differs from Drive in %d files", len(report.Diffs))
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/abiiranathan/gdrive"
+	"github.com/go-chi/chi/v5"
+)
+
+// Media views the listing can be classified into.
+const (
+	ViewBooks     = "books"
+	ViewDocuments = "documents"
+	ViewAudio     = "audio"
+	ViewVideo     = "video"
+	ViewImages    = "images"
+	ViewOther     = "other"
+)
+
+// viewNames lists the media views in display order.
+var viewNames = []string{ViewBooks, ViewDocuments, ViewAudio, ViewVideo, ViewImages, ViewOther}
+
+// bookMimeTypes are the MIME types classified as books.
+var bookMimeTypes = map[string]bool{
+	"application/pdf":                true,
+	"application/epub+zip":           true,
+	"application/x-mobipocket-ebook": true,
+	"application/vnd.amazon.ebook":   true,
+	"application/x-fictionbook+xml":  true,
+	"image/vnd.djvu":                 true,
+	"application/x-cbz":              true,
+	"application/vnd.comicbook+zip":  true,
+}
+
+// documentMimePrefixes are MIME type prefixes classified as documents.
+var documentMimePrefixes = []string{
+	"text/",
+	"application/msword",
+	"application/rtf",
+	"application/vnd.ms-",
+	"application/vnd.openxmlformats-officedocument.",
+	"application/vnd.oasis.opendocument.",
+	"application/vnd.google-apps.",
+}
+
+// classifyMimeType returns the media view a MIME type belongs to.
+func classifyMimeType(mimeType string) string {
+	if bookMimeTypes[mimeType] {
+		return ViewBooks
+	}
+
+	switch {
+	case strings.HasPrefix(mimeType, "audio/"):
+		return ViewAudio
+	case strings.HasPrefix(mimeType, "video/"):
+		return ViewVideo
+	case strings.HasPrefix(mimeType, "image/"):
+		return ViewImages
+	}
+
+	for _, prefix := range documentMimePrefixes {
+		if strings.HasPrefix(mimeType, prefix) {
+			return ViewDocuments
+		}
+	}
+	return ViewOther
+}
+
+// handleListViews handles GET /api/views - returns the file count of every media view.
+func (s *Server) handleListViews(w http.ResponseWriter, r *http.Request) {
+	files, err := s.visibleFiles(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	counts := make(map[string]int, len(viewNames))
+	for _, name := range viewNames {
+		counts[name] = 0
+	}
+	for _, f := range files {
+		counts[classifyMimeType(f.MimeType)]++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"views":  viewNames,
+		"counts": counts,
+		"total":  len(files),
+	})
+}
+
+// handleGetView handles GET /api/views/:view - returns the files in a media view.
+func (s *Server) handleGetView(w http.ResponseWriter, r *http.Request) {
+	view := chi.URLParam(r, "view")
+	if !slices.Contains(viewNames, view) {
+		writeError(w, http.StatusNotFound, "unknown view")
+		return
+	}
+
+	files, err := s.visibleFiles(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	matched := make([]gdrive.FileInfo, 0)
+	mimeTypes := make(map[string]int)
+	for _, f := range files {
+		if classifyMimeType(f.MimeType) == view {
+			matched = append(matched, f)
+			mimeTypes[f.MimeType]++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"view":       view,
+		"files":      matched,
+		"count":      len(matched),
+		"mime_types": mimeTypes,
+	})
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abiiranathan/gdrive"
+	"github.com/go-chi/chi/v5"
+)
+
+// Visibility is the local curation of a file in listings. Drive is not changed.
+type Visibility struct {
+	FileID    string    `json:"file_id"`
+	Hidden    bool      `json:"hidden"`   // Left out of listings
+	Featured  bool      `json:"featured"` // Highlighted by clients
+	Pinned    bool      `json:"pinned"`   // Listed before all other files
+	Reason    string    `json:"reason,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// VisibilityRequest represents a request to curate a file in listings.
+type VisibilityRequest struct {
+	Hidden   bool   `json:"hidden"`
+	Featured bool   `json:"featured"`
+	Pinned   bool   `json:"pinned"`
+	Reason   string `json:"reason" validate:"max=200"`
+}
+
+// fileOverlay holds the IDs of hidden, featured and pinned files.
+type fileOverlay struct {
+	hidden   map[string]bool
+	featured map[string]bool
+	pinned   map[string]bool
+}
+
+// loadOverlay loads the visibility overlay applied to listings.
+func (s *Server) loadOverlay(ctx context.Context) (fileOverlay, error) {
+	o := fileOverlay{
+		hidden:   make(map[string]bool),
+		featured: make(map[string]bool),
+		pinned:   make(map[string]bool),
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT file_id, hidden, featured, pinned FROM file_visibility")
+	if err != nil {
+		return o, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var hidden, featured, pinned bool
+		if err := rows.Scan(&id, &hidden, &featured, &pinned); err != nil {
+			continue
+		}
+		o.hidden[id], o.featured[id], o.pinned[id] = hidden, featured, pinned
+	}
+	return o, rows.Err()
+}
+
+// isHidden reports whether a file is hidden from listings, by an admin or the
+// moderation queue.
+func (s *Server) isHidden(ctx context.Context, fileID string) (bool, error) {
+	var hidden bool
+	err := s.db.QueryRowContext(ctx, "SELECT hidden FROM file_visibility WHERE file_id = ?", fileID).Scan(&hidden)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return hidden, err
+}
+
+// applyOverlay returns the files that are not hidden, pinned files first, in a new slice.
+// Files otherwise keep their order.
+func applyOverlay[T any](files []T, o fileOverlay, id func(T) string) []T {
+	visible := make([]T, 0, len(files))
+	for _, f := range files {
+		if o.pinned[id(f)] && !o.hidden[id(f)] {
+			visible = append(visible, f)
+		}
+	}
+	for _, f := range files {
+		if !o.pinned[id(f)] && !o.hidden[id(f)] {
+			visible = append(visible, f)
+		}
+	}
+	return visible
+}
+
+// visibleFiles returns the library as readers see it: hidden files left out and
+// pinned files first, in a new slice.
+func (s *Server) visibleFiles(ctx context.Context) ([]gdrive.FileInfo, error) {
+	files, err := s.getFiles(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	overlay, err := s.loadOverlay(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return applyOverlay(files, overlay, func(f gdrive.FileInfo) string { return f.ID }), nil
+}
+
+// invalidateVisibility drops indexes built from the visible files after a file's
+// visibility changes.
+func (s *Server) invalidateVisibility(ctx context.Context) {
+	if err := s.redis.Del(ctx, ChecksumIndexKey).Err(); err != nil {
+		logf(ctx, "Warning: Failed to invalidate checksum index: %v", err)
+	}
+}
+
+// overlayIDs returns the IDs of the files in set, in listing order.
+func overlayIDs[T any](files []T, set map[string]bool, id func(T) string) []string {
+	ids := make([]string, 0)
+	for _, f := range files {
+		if set[id(f)] {
+			ids = append(ids, id(f))
+		}
+	}
+	return ids
+}
+
+// handleListVisibility handles GET /api/admin/visibility - returns every curated file.
+func (s *Server) handleListVisibility(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.QueryContext(r.Context(), `
+		SELECT file_id, hidden, featured, pinned, reason, updated_at
+		FROM file_visibility
+		ORDER BY updated_at DESC
+	`)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	entries := make([]Visibility, 0)
+	for rows.Next() {
+		var v Visibility
+		if err := rows.Scan(&v.FileID, &v.Hidden, &v.Featured, &v.Pinned, &v.Reason, &v.UpdatedAt); err != nil {
+			continue
+		}
+		entries = append(entries, v)
+	}
+
+	if rows.Err() != nil {
+		writeError(w, http.StatusInternalServerError, rows.Err().Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"files": entries,
+		"count": len(entries),
+	})
+}
+
+// handleSetVisibility handles PUT /api/admin/files/:id/visibility - hides, features or
+// pins a file in listings without touching Drive. Clearing all flags removes the entry.
+func (s *Server) handleSetVisibility(w http.ResponseWriter, r *http.Request) {
+	var req VisibilityRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+	fileID := chi.URLParam(r, "id")
+
+	var err error
+	if !req.Hidden && !req.Featured && !req.Pinned {
+		_, err = s.execWrite(ctx, "DELETE FROM file_visibility WHERE file_id = ?", fileID)
+	} else {
+		_, err = s.execWrite(ctx, `
+			INSERT INTO file_visibility (file_id, hidden, featured, pinned, reason, updated_at)
+			VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(file_id) DO UPDATE SET
+				hidden = excluded.hidden,
+				featured = excluded.featured,
+				pinned = excluded.pinned,
+				reason = excluded.reason,
+				updated_at = excluded.updated_at
+		`, fileID, req.Hidden, req.Featured, req.Pinned, req.Reason)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.audit(r, "file.visibility", fileID, describeVisibility(req))
+	s.invalidateVisibility(ctx)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Visibility{
+		FileID:    fileID,
+		Hidden:    req.Hidden,
+		Featured:  req.Featured,
+		Pinned:    req.Pinned,
+		Reason:    req.Reason,
+		UpdatedAt: time.Now(),
+	})
+}
+
+// describeVisibility summarizes visibility flags for the audit log, e.g. "featured, pinned".
+func describeVisibility(req VisibilityRequest) string {
+	var flags []string
+	if req.Hidden {
+		flags = append(flags, "hidden")
+	}
+	if req.Featured {
+		flags = append(flags, "featured")
+	}
+	if req.Pinned {
+		flags = append(flags, "pinned")
+	}
+	if len(flags) == 0 {
+		return "visible"
+	}
+	return strings.Join(flags, ", ")
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/api/drive/v3"
+)
+
+const (
+	// watchChannelTTL is the lifetime requested for Drive push notification channels.
+	watchChannelTTL = 24 * time.Hour
+
+	// WatchRenewInterval is how often the notification channel is replaced, well
+	// before it expires.
+	WatchRenewInterval = watchChannelTTL / 2
+
+	// watchChannelKey is the Redis key holding the active notification channel.
+	watchChannelKey = "gdrive:changes:channel"
+)
+
+// watchChannel is a Drive push notification channel watching for changes.
+type watchChannel struct {
+	ID         string    `json:"id"`
+	ResourceID string    `json:"resource_id"`
+	Expiration time.Time `json:"expiration"`
+}
+
+// activeChannel returns the current notification channel, or nil if there is none.
+func (s *Server) activeChannel(ctx context.Context) (*watchChannel, error) {
+	data, err := s.redis.Get(ctx, watchChannelKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ch watchChannel
+	if err := json.Unmarshal(data, &ch); err != nil {
+		return nil, nil
+	}
+	return &ch, nil
+}
+
+// renewWatch opens a new Drive push notification channel for changes and stops the
+// previous one, so Drive notifies the server the moment files change. Notifications
+// only trigger a changes poll; the poll remains the source of truth.
+func (s *Server) renewWatch(ctx context.Context) error {
+	if s.cfg.WebhookSecret == "" {
+		return nil
+	}
+
+	token, err := s.redis.Get(ctx, changesTokenKey).Result()
+	if errors.Is(err, redis.Nil) {
+		start, err := s.driveService.Changes.GetStartPageToken().Context(ctx).SupportsAllDrives(true).Do()
+		if err != nil {
+			return fmt.Errorf("unable to get start page token: %w", err)
+		}
+		token = start.StartPageToken
+		if err := s.redis.Set(ctx, changesTokenKey, token, 0).Err(); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	previous, err := s.activeChannel(ctx)
+	if err != nil {
+		return err
+	}
+
+	created, err := s.driveService.Changes.Watch(token, &drive.Channel{
+		Id:         randomToken()[:32],
+		Type:       "web_hook",
+		Address:    strings.TrimSuffix(s.cfg.PublicURL, "/") + "/api/drive/notifications",
+		Token:      s.cfg.WebhookSecret,
+		Expiration: time.Now().Add(watchChannelTTL).UnixMilli(),
+	}).Context(ctx).SupportsAllDrives(true).Do()
+	if err != nil {
+		return fmt.Errorf("unable to watch changes: %w", err)
+	}
+
+	data, _ := json.Marshal(watchChannel{
+		ID:         created.Id,
+		ResourceID: created.ResourceId,
+		Expiration: time.UnixMilli(created.Expiration),
+	})
+	if err := s.redis.Set(ctx, watchChannelKey, data, watchChannelTTL).Err(); err != nil {
+		return err
+	}
+
+	if previous != nil {
+		err := s.driveService.Channels.Stop(&drive.Channel{Id: previous.ID, ResourceId: previous.ResourceID}).Context(ctx).Do()
+		if err != nil {
+			log.Printf("Warning: Failed to stop notification channel %s: %v", previous.ID, err)
+		}
+	}
+	return nil
+}
+
+// handleDriveNotification handles POST /api/drive/notifications - receives Drive push
+// notifications. Requests must carry the channel ID of the active channel and the
+// configured token in the X-Goog-Channel-* headers.
+func (s *Server) handleDriveNotification(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.WebhookSecret == "" {
+		writeError(w, http.StatusNotFound, "push notifications are not enabled")
+		return
+	}
+
+	token := r.Header.Get("X-Goog-Channel-Token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.WebhookSecret)) != 1 {
+		writeError(w, http.StatusForbidden, "invalid channel token")
+		return
+	}
+
+	ctx := r.Context()
+	ch, err := s.activeChannel(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if ch == nil || r.Header.Get("X-Goog-Channel-ID") != ch.ID {
+		// Channels replaced by renewWatch may still deliver a last notification
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// The initial "sync" message only confirms the channel
+	if r.Header.Get("X-Goog-Resource-State") != "sync" {
+		s.scheduler.RunNow(context.Background(), "changes")
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
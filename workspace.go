@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/abiiranathan/gdrive"
+	"google.golang.org/api/drive/v3"
+)
+
+const (
+	// workspaceMimePrefix prefixes the MIME types of Google-native files.
+	workspaceMimePrefix = "application/vnd.google-apps."
+
+	// shortcutMimeType is the MIME type of Drive shortcuts.
+	shortcutMimeType = "application/vnd.google-apps.shortcut"
+)
+
+// exportFormats maps WORKSPACE_TYPES format names to Drive export formats.
+var exportFormats = map[string]gdrive.ExportFormat{
+	"pdf":  gdrive.ExportFormatPDF,
+	"docx": gdrive.ExportFormatDOCX,
+	"xlsx": gdrive.ExportFormatXLSX,
+	"pptx": gdrive.ExportFormatPPTX,
+	"odt":  gdrive.ExportFormatODT,
+	"ods":  gdrive.ExportFormatODS,
+	"odp":  gdrive.ExportFormatODP,
+	"rtf":  gdrive.ExportFormatRTF,
+	"txt":  gdrive.ExportFormatTXT,
+	"html": gdrive.ExportFormatHTML,
+	"zip":  gdrive.ExportFormatZIP,
+	"jpeg": gdrive.ExportFormatJPEG,
+	"png":  gdrive.ExportFormatPNG,
+	"svg":  gdrive.ExportFormatSVG,
+	"csv":  gdrive.ExportFormatCSV,
+	"epub": gdrive.ExportFormatEPUB,
+}
+
+// workspaceKind is a Google-native type that can be enabled in WORKSPACE_TYPES.
+type workspaceKind struct {
+	Kind     string
+	MimeType string
+	Formats  []string // Names of the supported export formats
+}
+
+// workspaceKinds lists the Google-native types that can be enabled, with the
+// export formats Drive supports for each. Forms and shortcuts cannot be exported;
+// shortcuts are downloaded as their target.
+var workspaceKinds = []workspaceKind{
+	{"docs", "application/vnd.google-apps.document", []string{"pdf", "docx", "odt", "rtf", "txt", "html", "epub", "zip"}},
+	{"sheets", "application/vnd.google-apps.spreadsheet", []string{"pdf", "xlsx", "ods", "csv", "html", "zip"}},
+	{"slides", "application/vnd.google-apps.presentation", []string{"pdf", "pptx", "odp", "txt", "jpeg", "png"}},
+	{"drawings", "application/vnd.google-apps.drawing", []string{"pdf", "jpeg", "png", "svg"}},
+	{"forms", "application/vnd.google-apps.form", nil},
+	{"shortcuts", shortcutMimeType, nil},
+}
+
+// WorkspaceType is a Google-native type included in listings.
+type WorkspaceType struct {
+	Kind    string                // Name used in WORKSPACE_TYPES, e.g. "docs"
+	Export  gdrive.ExportFormat   // Default download format; downloads are refused when empty
+	Formats []gdrive.ExportFormat // Formats Drive can export this type to
+}
+
+// WorkspaceSet holds the enabled Google-native types, keyed by MIME type.
+type WorkspaceSet map[string]WorkspaceType
+
+// parseWorkspaceTypes parses a WORKSPACE_TYPES value such as "docs,sheets=xlsx,slides=none",
+// listing the Google-native types to include in listings with their default export
+// format. The default is PDF when the type supports it; types with format "none"
+// (and forms) are listed but cannot be downloaded. An empty value enables no types.
+func parseWorkspaceTypes(v string) (WorkspaceSet, error) {
+	types := make(WorkspaceSet)
+	for entry := range strings.SplitSeq(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kind, format, _ := strings.Cut(entry, "=")
+		i := slices.IndexFunc(workspaceKinds, func(k workspaceKind) bool { return k.Kind == kind })
+		if i < 0 {
+			return nil, fmt.Errorf("invalid workspace type %q: must be docs, sheets, slides, drawings, forms or shortcuts", kind)
+		}
+
+		known := workspaceKinds[i]
+		t := WorkspaceType{Kind: kind}
+		for _, name := range known.Formats {
+			t.Formats = append(t.Formats, exportFormats[name])
+		}
+		if format == "" && slices.Contains(known.Formats, "pdf") {
+			format = "pdf"
+		}
+		if format != "" && format != "none" {
+			if !slices.Contains(known.Formats, format) {
+				return nil, fmt.Errorf("invalid export format %q for %s: must be one of %s", format, kind, strings.Join(known.Formats, ", "))
+			}
+			t.Export = exportFormats[format]
+		}
+		types[known.MimeType] = t
+	}
+	return types, nil
+}
+
+// exportExtension returns the file extension for an export format, e.g. ".pdf".
+func exportExtension(format gdrive.ExportFormat) string {
+	for name, f := range exportFormats {
+		if f == format {
+			return "." + name
+		}
+	}
+	return ""
+}
+
+// folderPaths returns the full path of every folder, keyed by folder ID,
+// formatted like gdrive.FileInfo.FolderPath.
+func (s *Server) folderPaths(ctx context.Context) (map[string]string, error) {
+	type folder struct{ name, parent string }
+	folders := make(map[string]folder)
+	err := s.driveService.Files.List().
+		Context(ctx).
+		Q("mimeType='application/vnd.google-apps.folder' and trashed=false").
+		Fields("nextPageToken, files(id, name, parents)").
+		PageSize(1000).
+		Pages(ctx, func(r *drive.FileList) error {
+			for _, f := range r.Files {
+				var parent string
+				if len(f.Parents) > 0 {
+					parent = f.Parents[0]
+				}
+				folders[f.Id] = folder{name: f.Name, parent: parent}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list folders: %w", err)
+	}
+
+	paths := make(map[string]string, len(folders))
+	for id := range folders {
+		var parts []string
+		// Traverse at most 10 levels, as the gdrive package does
+		for current, i := id, 0; i < 10; i++ {
+			f, ok := folders[current]
+			if !ok {
+				break
+			}
+			parts = append([]string{f.name}, parts...)
+			current = f.parent
+		}
+		paths[id] = strings.Join(append([]string{"My Drive"}, parts...), "/")
+	}
+	return paths, nil
+}
+
+// libraryFolder returns the path of a folder listed in the library, formatted like
+// gdrive.FileInfo.FolderPath, or "" if folderID is not the ID of such a folder. Files,
+// trashed folders and folders the service account cannot see are not listed.
+func (s *Server) libraryFolder(ctx context.Context, folderID string) (string, error) {
+	paths, err := s.folderPaths(ctx)
+	if err != nil {
+		return "", err
+	}
+	return paths[folderID], nil
+}
+
+// listWorkspaceFiles lists the files of the enabled Google-native types, which
+// gdrive.DriveClient.ListFiles omits because they have no size.
+func (s *Server) listWorkspaceFiles(ctx context.Context) ([]gdrive.FileInfo, error) {
+	if len(s.cfg.WorkspaceTypes) == 0 {
+		return nil, nil
+	}
+
+	var clauses []string
+	for mimeType := range s.cfg.WorkspaceTypes {
+		clauses = append(clauses, "mimeType='"+mimeType+"'")
+	}
+	slices.Sort(clauses)
+
+	paths, err := s.folderPaths(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]gdrive.FileInfo, 0)
+	err = s.driveService.Files.List().
+		Context(ctx).
+		Q("("+strings.Join(clauses, " or ")+") and trashed=false").
+		Fields("nextPageToken, files(id, name, mimeType, size, webViewLink, parents)").
+		PageSize(1000).
+		Pages(ctx, func(r *drive.FileList) error {
+			for _, f := range r.Files {
+				folderPath := "My Drive"
+				if len(f.Parents) > 0 && paths[f.Parents[0]] != "" {
+					folderPath = paths[f.Parents[0]]
+				}
+				files = append(files, gdrive.FileInfo{
+					ID:          f.Id,
+					Name:        f.Name,
+					MimeType:    f.MimeType,
+					Size:        f.Size,
+					WebViewLink: f.WebViewLink,
+					Parents:     f.Parents,
+					FolderPath:  folderPath,
+				})
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list workspace files: %w", err)
+	}
+	return files, nil
+}
+
+// resolveShortcut returns the ID and MIME type of a shortcut's target.
+func (s *Server) resolveShortcut(ctx context.Context, fileID string) (string, string, error) {
+	f, err := s.driveService.Files.Get(fileID).Context(ctx).SupportsAllDrives(true).Fields("shortcutDetails").Do()
+	if err != nil {
+		return "", "", fmt.Errorf("unable to resolve shortcut: %w", err)
+	}
+	if f.ShortcutDetails == nil || f.ShortcutDetails.TargetId == "" {
+		return "", "", fmt.Errorf("shortcut %s has no target", fileID)
+	}
+	return f.ShortcutDetails.TargetId, f.ShortcutDetails.TargetMimeType, nil
+}
+
+// negotiateExport picks the export format for a download from the Accept header:
+// the supported format with the highest quality value, or the type's default for
+// "*/*", wildcards of the default's type (e.g. "application/*"), browser navigation
+// or no Accept header.
+// It returns false when the Accept header names only unsupported formats.
+func negotiateExport(accept string, t WorkspaceType) (gdrive.ExportFormat, bool) {
+	// Browsers navigating to a link prefer HTML, which is not a useful download format
+	if strings.TrimSpace(accept) == "" || strings.Contains(accept, "application/xhtml+xml") {
+		return t.Export, true
+	}
+
+	var best gdrive.ExportFormat
+	bestQ := 0.0
+	for part := range strings.SplitSeq(accept, ",") {
+		mediaType, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+		q := 1.0
+		for param := range strings.SplitSeq(params, ";") {
+			if k, v, ok := strings.Cut(strings.TrimSpace(param), "="); ok && k == "q" {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+
+		var format gdrive.ExportFormat
+		switch {
+		case mediaType == "*/*":
+			format = t.Export
+		case strings.HasSuffix(mediaType, "/*"):
+			if strings.HasPrefix(string(t.Export), strings.TrimSuffix(mediaType, "*")) {
+				format = t.Export
+			} else if i := slices.IndexFunc(t.Formats, func(f gdrive.ExportFormat) bool {
+				return strings.HasPrefix(string(f), strings.TrimSuffix(mediaType, "*"))
+			}); i >= 0 {
+				format = t.Formats[i]
+			}
+		case slices.Contains(t.Formats, gdrive.ExportFormat(mediaType)):
+			format = gdrive.ExportFormat(mediaType)
+		}
+
+		if format != "" {
+			best, bestQ = format, q
+		}
+	}
+	return best, best != ""
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// xlsxMimeType is the MIME type of Excel workbooks.
+const xlsxMimeType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// xlsxSheet is a worksheet of a workbook written by writeXLSX. Cells holding an
+// int64 or float64 are written as numbers, everything else as text.
+type xlsxSheet struct {
+	Name string
+	Rows [][]any
+}
+
+// xlsxEscape escapes text for use in SpreadsheetML.
+func xlsxEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// xlsxColumn returns the column letters of a zero-based column index, e.g. 27 → "AB".
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// writeXLSX writes a minimal Office Open XML workbook with inline strings, which
+// spreadsheet applications open without a shared strings table or styles.
+func writeXLSX(w io.Writer, sheets []xlsxSheet) error {
+	zw := zip.NewWriter(w)
+	write := func(name, content string) error {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, content)
+		return err
+	}
+
+	var overrides, workbookSheets, rels strings.Builder
+	for i, sheet := range sheets {
+		n := i + 1
+		fmt.Fprintf(&overrides, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&workbookSheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xlsxEscape(sheet.Name), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+	}
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			overrides.String() + `</Types>`},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + workbookSheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() + `</Relationships>`},
+	}
+	for _, p := range parts {
+		if err := write(p.name, p.content); err != nil {
+			return err
+		}
+	}
+
+	for i, sheet := range sheets {
+		var data strings.Builder
+		data.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`)
+		data.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+		for r, row := range sheet.Rows {
+			fmt.Fprintf(&data, `<row r="%d">`, r+1)
+			for c, cell := range row {
+				ref := xlsxColumn(c) + strconv.Itoa(r+1)
+				switch v := cell.(type) {
+				case int64:
+					fmt.Fprintf(&data, `<c r="%s"><v>%d</v></c>`, ref, v)
+				case float64:
+					fmt.Fprintf(&data, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+				default:
+					fmt.Fprintf(&data, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, xlsxEscape(fmt.Sprint(v)))
+				}
+			}
+			data.WriteString(`</row>`)
+		}
+		data.WriteString(`</sheetData></worksheet>`)
+
+		if err := write(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), data.String()); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}